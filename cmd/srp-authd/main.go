@@ -0,0 +1,175 @@
+// Copyright 2013 Tad Glines
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+// Command srp-authd runs SRP handshakes for local services over a Unix
+// socket, so that the verifiers are only readable by the daemon. See the
+// authd package for the protocol and the client used by services.
+//
+// Usage:
+//
+//	srp-authd -records file [-socket path] [-mode 0660] [-group name] [-params k=v,...]
+//	          [-workers n] [-queue n] [-puzzle-difficulty n [-puzzle-capacity n]]
+//	          [-approved]
+//
+// The records file uses the format written by srptool. It is read again on
+// SIGHUP. Access to the daemon is controlled with the permissions of the
+// socket, so it should be run as a dedicated user sharing a group with the
+// services.
+//
+// The exponentiations of logins run on -workers goroutines (GOMAXPROCS by
+// default). Up to -queue logins wait for a worker, and further logins are
+// refused until the queue drains.
+//
+// With -puzzle-difficulty, users must solve client puzzles once logins are
+// in progress, with the difficulty rising to the given maximum as the number
+// of logins approaches -puzzle-capacity.
+//
+// With -approved, the daemon runs the self-tests of the srp package at
+// startup and only accepts records using approved algorithms (see
+// srp.ApprovedPolicy). Records that are not allowed fail to load, and
+// -params must then select an approved KDF, e.g. -params kdf=pbkdf2.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"github.com/lann/go-pkgs/crypto/srp"
+	"github.com/lann/go-pkgs/crypto/srp/authd"
+	"log"
+	"net"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+func main() {
+	socket := flag.String("socket", "/var/run/srp-authd/socket", "path of the Unix socket")
+	mode := flag.String("mode", "0660", "permissions of the socket")
+	records := flag.String("records", "", "file holding the verifier records")
+	group := flag.String("group", "rfc5054.2048", "group used in challenges for unknown users")
+	params := flag.String("params", "", "comma separated key=value parameters used for unknown users")
+	timeout := flag.Duration("timeout", authd.DefaultTimeout, "time allowed for a login")
+	workers := flag.Int("workers", 0, "number of logins computed at once, 0 for GOMAXPROCS")
+	queue := flag.Int("queue", 0, "number of logins waiting for a worker, 0 for 16 per worker")
+	puzzleDifficulty := flag.Int("puzzle-difficulty", 0, "maximum difficulty of client puzzles, 0 disables them")
+	puzzleCapacity := flag.Int("puzzle-capacity", 64, "logins in progress at which puzzles reach the maximum difficulty")
+	approved := flag.Bool("approved", false, "run the self-tests and only allow approved algorithms")
+	flag.Parse()
+
+	logger := log.New(os.Stderr, "srp-authd: ", log.LstdFlags)
+	if *approved {
+		if err := srp.SelfTest(); err != nil {
+			logger.Fatal(err)
+		}
+		srp.SetPolicy(srp.ApprovedPolicy)
+	}
+	if *records == "" {
+		logger.Fatal("Missing -records")
+	}
+	perm, err := strconv.ParseUint(*mode, 8, 32)
+	if err != nil {
+		logger.Fatalf("Invalid mode: %s", *mode)
+	}
+	p, err := parseParams(*params)
+	if err != nil {
+		logger.Fatal(err)
+	}
+	// Unknown users get challenges for -group and -params, which must be
+	// allowed by the policy too.
+	if _, err := srp.NewSRPWithParams(*group, p); err != nil {
+		logger.Fatalf("Invalid -group or -params: %v", err)
+	}
+
+	store, err := authd.NewFileStore(*records)
+	if err != nil {
+		logger.Fatal(err)
+	}
+	s := authd.NewServer(store)
+	s.Group = *group
+	s.Params = p
+	s.Timeout = *timeout
+	s.Logger = logger
+	s.Scheduler = srp.NewScheduler(*workers, *queue)
+	if *puzzleDifficulty > 0 {
+		if *puzzleDifficulty > srp.MaxPuzzleDifficulty || *puzzleCapacity < 1 {
+			logger.Fatal("Invalid -puzzle-difficulty or -puzzle-capacity")
+		}
+		s.Puzzles = srp.NewPuzzleIssuer(nil)
+		s.Puzzles.MaxDifficulty = *puzzleDifficulty
+		s.Puzzles.Replays = srp.NewMemoryReplayCache()
+		s.PuzzleCapacity = *puzzleCapacity
+	}
+
+	l, err := listen(*socket, os.FileMode(perm))
+	if err != nil {
+		logger.Fatal(err)
+	}
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGHUP, syscall.SIGINT, syscall.SIGTERM)
+	go func() {
+		for sig := range signals {
+			if sig != syscall.SIGHUP {
+				// Closing the listener removes the socket and stops Serve.
+				l.Close()
+				return
+			}
+			if err := store.Reload(); err != nil {
+				logger.Printf("Reload failed: %v", err)
+			} else {
+				logger.Printf("Reloaded %s", store.Path)
+			}
+		}
+	}()
+
+	logger.Printf("Listening on %s", *socket)
+	s.Serve(l)
+}
+
+// listen creates the socket, replacing a stale one left by a previous run.
+func listen(path string, perm os.FileMode) (net.Listener, error) {
+	if fi, err := os.Lstat(path); err == nil && fi.Mode()&os.ModeSocket != 0 {
+		if conn, err := net.Dial("unix", path); err == nil {
+			conn.Close()
+			return nil, fmt.Errorf("%s is in use", path)
+		}
+		os.Remove(path)
+	}
+	l, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.Chmod(path, perm); err != nil {
+		l.Close()
+		return nil, err
+	}
+	return l, nil
+}
+
+func parseParams(s string) (map[string]string, error) {
+	if s == "" {
+		return nil, nil
+	}
+	params := make(map[string]string)
+	for _, kv := range strings.Split(s, ",") {
+		i := strings.IndexByte(kv, '=')
+		if i < 1 {
+			return nil, fmt.Errorf("Invalid parameter: %s", kv)
+		}
+		params[kv[:i]] = kv[i+1:]
+	}
+	return params, nil
+}
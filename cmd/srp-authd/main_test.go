@@ -0,0 +1,66 @@
+// Copyright 2013 Tad Glines
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestParseParams(t *testing.T) {
+	p, err := parseParams("hash=sha1,kdf=pbkdf2,iter=5")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]string{"hash": "sha1", "kdf": "pbkdf2", "iter": "5"}
+	if !reflect.DeepEqual(p, expected) {
+		t.Fatalf("Expected %v, got %v", expected, p)
+	}
+	if _, err := parseParams("hash"); err == nil {
+		t.Fatal("Expected a parameter without a value to be rejected")
+	}
+}
+
+func TestListen(t *testing.T) {
+	dir, err := os.MkdirTemp("", "srp-authd")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "socket")
+
+	l, err := listen(path, 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fi, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fi.Mode().Perm() != 0600 {
+		t.Fatalf("Expected mode 0600, got %v", fi.Mode().Perm())
+	}
+	if _, err := listen(path, 0600); err == nil {
+		t.Fatal("Expected a socket in use to be refused")
+	}
+	l.Close()
+	l, err = listen(path, 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	l.Close()
+}
@@ -0,0 +1,238 @@
+// Copyright 2013 Tad Glines
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+// Command srp-vectors writes test vectors for other implementations of SRP.
+// Each vector is a complete handshake run by the ClientSession and
+// ServerSession of the srp package, with the intermediate values.
+//
+// Usage:
+//
+//	srp-vectors [-group name] [-hash name] [-kdf name [-iter n] [-scrypt-N n ...]]
+//	            [-profile name] [-username name] [-password pw] [-seed s] [-n count]
+//
+// The flags selecting the parameters are those of srptool. With -seed the
+// salts and the private values a and b are derived from the seed, so the
+// same vectors are written every time; otherwise they are random.
+//
+// The output is a JSON object holding the group, the parameters and the
+// vectors. All values are hex encoded. The salt, A, B, K, M1 and M2 are the
+// bytes sent or returned by the sessions, while N, g, a, b, k, x, v, u and S
+// are integers in big endian without leading zeros.
+package main
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"github.com/lann/go-pkgs/crypto/srp"
+	"github.com/lann/go-pkgs/crypto/srp/srptest"
+	"io"
+	"math/big"
+	"os"
+	"strconv"
+)
+
+// Output is the document written by srp-vectors.
+type Output struct {
+	Group   string            `json:"group"`
+	Params  map[string]string `json:"params"`
+	N       string            `json:"N"`
+	G       string            `json:"g"`
+	Vectors []*Vector         `json:"vectors"`
+}
+
+// Vector is one handshake.
+type Vector struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+	Salt     string `json:"salt"`
+	A        string `json:"a"`
+	B        string `json:"b"`
+	K        string `json:"k"`
+	X        string `json:"x"`
+	V        string `json:"v"`
+	PublicA  string `json:"A"`
+	PublicB  string `json:"B"`
+	U        string `json:"u"`
+	S        string `json:"S"`
+	Key      string `json:"K"`
+	M1       string `json:"M1"`
+	M2       string `json:"M2"`
+}
+
+func main() {
+	group := flag.String("group", "rfc5054.2048", "SRP group")
+	hash := flag.String("hash", srp.DefaultHash, "hash function")
+	kdf := flag.String("kdf", "default", "key derivation function: default, pbkdf2 or scrypt")
+	iter := flag.Int("iter", srp.DefaultPBKDF2Iter, "pbkdf2 iterations")
+	scryptN := flag.Int("scrypt-N", srp.DefaultScryptN, "scrypt CPU/memory cost")
+	scryptR := flag.Int("scrypt-r", srp.DefaultScryptR, "scrypt block size")
+	scryptP := flag.Int("scrypt-p", srp.DefaultScryptP, "scrypt parallelization")
+	profile := flag.String("profile", "", "SRP profile")
+	username := flag.String("username", srptest.Username, "username of the vectors")
+	password := flag.String("password", srptest.Password, "password of the vectors")
+	seed := flag.String("seed", "", "derive the random values from this seed")
+	count := flag.Int("n", 1, "number of vectors")
+	flag.Parse()
+
+	params := map[string]string{srp.ParamHash: *hash, srp.ParamKDF: *kdf}
+	switch *kdf {
+	case "pbkdf2":
+		params[srp.ParamIter] = strconv.Itoa(*iter)
+	case "scrypt":
+		params[srp.ParamScryptN] = strconv.Itoa(*scryptN)
+		params[srp.ParamScryptR] = strconv.Itoa(*scryptR)
+		params[srp.ParamScryptP] = strconv.Itoa(*scryptP)
+	}
+	if *profile != "" {
+		params[srp.ParamProfile] = *profile
+	}
+	var random io.Reader = rand.Reader
+	if *seed != "" {
+		random = srptest.Rand(*seed)
+	}
+
+	out, err := generate(*group, params, []byte(*username), []byte(*password), random, *count)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "srp-vectors: %v\n", err)
+		os.Exit(1)
+	}
+	data, err := json.MarshalIndent(out, "", "  ")
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "srp-vectors: %v\n", err)
+		os.Exit(1)
+	}
+	os.Stdout.Write(append(data, '\n'))
+}
+
+// generate runs count handshakes with the random values read from random.
+func generate(group string, params map[string]string, username, password []byte, random io.Reader, count int) (*Output, error) {
+	s, err := srp.NewSRPWithParams(group, params)
+	if err != nil {
+		return nil, err
+	}
+	out := &Output{
+		Group:   group,
+		Params:  params,
+		N:       hex.EncodeToString(s.Group.Prime.Bytes()),
+		G:       hex.EncodeToString(s.Group.Generator.Bytes()),
+		Vectors: make([]*Vector, count),
+	}
+	for i := range out.Vectors {
+		if out.Vectors[i], err = vector(s, username, password, random); err != nil {
+			return nil, err
+		}
+	}
+	return out, nil
+}
+
+// recorder keeps a copy of the bytes read from R.
+type recorder struct {
+	R   io.Reader
+	buf bytes.Buffer
+}
+
+func (r *recorder) Read(p []byte) (int, error) {
+	n, err := r.R.Read(p)
+	r.buf.Write(p[:n])
+	return n, err
+}
+
+// private returns the private value read by the session just created with
+// r as its source, by reading it again from the recorded bytes.
+func (r *recorder) private(s *srp.SRP) (*big.Int, error) {
+	x, err := rand.Int(bytes.NewReader(r.buf.Bytes()), new(big.Int).Lsh(big.NewInt(1), s.ABSize))
+	r.buf.Reset()
+	return x, err
+}
+
+// vector runs one handshake and checks the values computed from its private
+// values against those of the sessions.
+func vector(s *srp.SRP, username, password []byte, random io.Reader) (*Vector, error) {
+	rec := &recorder{R: random}
+	s.Rand = rec
+	salt, verifier, err := s.ComputeUserVerifier(username, password)
+	if err != nil {
+		return nil, err
+	}
+	rec.buf.Reset()
+
+	cs := s.NewClientSession(username, password)
+	a, err := rec.private(s)
+	if err != nil {
+		return nil, err
+	}
+	ss := s.NewServerSession(username, salt, verifier)
+	b, err := rec.private(s)
+	if err != nil {
+		return nil, err
+	}
+	skey, err := ss.ComputeKey(cs.GetA())
+	if err != nil {
+		return nil, err
+	}
+	ckey, err := cs.ComputeKey(salt, ss.GetB())
+	if err != nil {
+		return nil, err
+	}
+	M1 := cs.ComputeAuthenticator()
+	if !ss.VerifyClientAuthenticator(M1) {
+		return nil, fmt.Errorf("Client authenticator rejected")
+	}
+	M2 := ss.ComputeAuthenticator(M1)
+	if !cs.VerifyServerAuthenticator(M2) {
+		return nil, fmt.Errorf("Server authenticator rejected")
+	}
+
+	// S = (A * v^u) ^ b % N
+	N := s.Group.Prime
+	A, B := new(big.Int).SetBytes(cs.GetA()), new(big.Int).SetBytes(ss.GetB())
+	v := new(big.Int).SetBytes(verifier)
+	u := s.ComputeU(A, B)
+	S := new(big.Int).Exp(v, u, N)
+	S.Mul(S, A).Mod(S, N).Exp(S, b, N)
+	x := s.ComputeX(username, salt, password)
+	p := &srp.ProofValues{Username: username, Salt: salt, A: A, B: B, S: S, K: ckey}
+	switch {
+	case new(big.Int).Exp(s.Group.Generator, a, N).Cmp(A) != 0:
+		return nil, fmt.Errorf("A does not match a")
+	case new(big.Int).Exp(s.Group.Generator, x, N).Cmp(v) != 0:
+		return nil, fmt.Errorf("v does not match x")
+	case !bytes.Equal(skey, ckey) || !bytes.Equal(s.ComputeSessionKey(S, u), ckey):
+		return nil, fmt.Errorf("K does not match S")
+	case !bytes.Equal(s.ComputeClientAuthenticator(p), M1):
+		return nil, fmt.Errorf("M1 does not match")
+	}
+
+	return &Vector{
+		Username: string(username),
+		Password: string(password),
+		Salt:     hex.EncodeToString(salt),
+		A:        hex.EncodeToString(a.Bytes()),
+		B:        hex.EncodeToString(b.Bytes()),
+		K:        hex.EncodeToString(s.ComputeK().Bytes()),
+		X:        hex.EncodeToString(x.Bytes()),
+		V:        hex.EncodeToString(v.Bytes()),
+		PublicA:  hex.EncodeToString(cs.GetA()),
+		PublicB:  hex.EncodeToString(ss.GetB()),
+		U:        hex.EncodeToString(u.Bytes()),
+		S:        hex.EncodeToString(S.Bytes()),
+		Key:      hex.EncodeToString(ckey),
+		M1:       hex.EncodeToString(M1),
+		M2:       hex.EncodeToString(M2),
+	}, nil
+}
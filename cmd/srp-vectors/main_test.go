@@ -0,0 +1,63 @@
+// Copyright 2013 Tad Glines
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+package main
+
+import (
+	"crypto/rand"
+	"encoding/json"
+	"github.com/lann/go-pkgs/crypto/srp/srptest"
+	"reflect"
+	"testing"
+)
+
+func TestGenerate(t *testing.T) {
+	for _, params := range []map[string]string{
+		{"hash": "sha256"},
+		{"hash": "sha1", "kdf": "pbkdf2", "iter": "10"},
+		{"profile": "srp6"},
+		{"profile": "srp3"},
+	} {
+		out, err := generate("rfc5054.1024", params, []byte("alice"), []byte("password"), srptest.Rand("test"), 2)
+		if err != nil {
+			t.Fatalf("%v: %v", params, err)
+		}
+		again, err := generate("rfc5054.1024", params, []byte("alice"), []byte("password"), srptest.Rand("test"), 2)
+		if err != nil {
+			t.Fatalf("%v: %v", params, err)
+		}
+		if !reflect.DeepEqual(out, again) {
+			t.Fatalf("%v: Expected the same vectors for the same seed", params)
+		}
+		if *out.Vectors[0] == *out.Vectors[1] {
+			t.Fatalf("%v: Expected different vectors", params)
+		}
+	}
+
+	out, err := generate("rfc5054.1024", nil, []byte("alice"), []byte("password"), rand.Reader, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := json.Marshal(out.Vectors[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	var fields map[string]string
+	json.Unmarshal(data, &fields)
+	for _, name := range []string{"username", "password", "salt", "a", "b", "k", "x", "v", "A", "B", "u", "S", "K", "M1", "M2"} {
+		if fields[name] == "" {
+			t.Errorf("Missing %s", name)
+		}
+	}
+}
@@ -0,0 +1,166 @@
+// Copyright 2013 Tad Glines
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+package main
+
+import (
+	"bufio"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"github.com/lann/go-pkgs/crypto/srp"
+	"io"
+	"os"
+	"strings"
+	"sync"
+)
+
+// transcriptLog appends transcripts to a file, one JSON object per line.
+type transcriptLog struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+// openTranscriptLog opens file for appending, or returns nil if file is
+// empty.
+func openTranscriptLog(file string) (*transcriptLog, error) {
+	if file == "" {
+		return nil, nil
+	}
+	f, err := os.OpenFile(file, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, err
+	}
+	return &transcriptLog{w: f}, nil
+}
+
+// write appends t and wipes its secrets. It does nothing on a nil
+// transcriptLog.
+func (l *transcriptLog) write(t *srp.Transcript) {
+	if l == nil || t == nil {
+		return
+	}
+	defer t.Wipe()
+	data, err := json.Marshal(t)
+	if err != nil {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.w.Write(append(data, '\n'))
+}
+
+func runDiagnose(args []string) error {
+	fs := flag.NewFlagSet("diagnose", flag.ExitOnError)
+	index := fs.Int("n", -1, "index of the transcript in the file, negative values count from the end")
+	fs.Parse(args)
+	if fs.NArg() != 2 {
+		return fmt.Errorf("Expected a transcript file and a values file")
+	}
+	t, err := readTranscript(fs.Arg(0), *index)
+	if err != nil {
+		return err
+	}
+	peer, err := readPeerValues(fs.Arg(1))
+	if err != nil {
+		return err
+	}
+
+	fmt.Println(t)
+	fmt.Println()
+	if d := srp.Diagnose(t, peer); d != nil {
+		fmt.Println(d)
+	} else {
+		fmt.Println("No divergent value found")
+	}
+	return nil
+}
+
+// readTranscript reads the transcript at index from a file written with
+// -transcript.
+func readTranscript(file string, index int) (*srp.Transcript, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var lines []string
+	s := bufio.NewScanner(f)
+	s.Buffer(nil, 4*srp.MaxMessageSize)
+	for s.Scan() {
+		if line := strings.TrimSpace(s.Text()); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	if err := s.Err(); err != nil {
+		return nil, err
+	}
+	if index < 0 {
+		index += len(lines)
+	}
+	if index < 0 || index >= len(lines) {
+		return nil, fmt.Errorf("%s: no transcript %d", file, index)
+	}
+	t := new(srp.Transcript)
+	if err := json.Unmarshal([]byte(lines[index]), t); err != nil {
+		return nil, fmt.Errorf("%s: %v", file, err)
+	}
+	return t, nil
+}
+
+// readPeerValues reads the values reported by a peer: a JSON object mapping
+// the names used by srp.Transcript to hex strings, except for the username
+// and the password which are plain strings. The output of srp-vectors is
+// accepted too, in which case its first vector is used.
+func readPeerValues(file string) (map[string][]byte, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil, fmt.Errorf("%s: %v", file, err)
+	}
+	if raw, ok := fields["vectors"]; ok {
+		var vectors []map[string]json.RawMessage
+		if err := json.Unmarshal(raw, &vectors); err != nil || len(vectors) == 0 {
+			return nil, fmt.Errorf("%s: no vectors", file)
+		}
+		delete(fields, "vectors")
+		for name, v := range vectors[0] {
+			fields[name] = v
+		}
+	}
+
+	values := make(map[string][]byte)
+	for name, raw := range fields {
+		var s string
+		if name == "group" || json.Unmarshal(raw, &s) != nil {
+			// The group and parameters of srp-vectors.
+			continue
+		}
+		switch name {
+		case "username", "password":
+			values[name] = []byte(s)
+		default:
+			v, err := hex.DecodeString(s)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %s is not hex encoded", file, name)
+			}
+			values[name] = v
+		}
+	}
+	return values, nil
+}
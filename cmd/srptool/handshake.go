@@ -0,0 +1,327 @@
+// Copyright 2013 Tad Glines
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"github.com/lann/go-pkgs/crypto/srp"
+	"io"
+	"log"
+	"net"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+type stdio struct {
+	io.Reader
+	io.Writer
+}
+
+func runServer(args []string) error {
+	fs := flag.NewFlagSet("server", flag.ExitOnError)
+	listen := fs.String("listen", "", "TCP address to listen on instead of using stdin and stdout")
+	recordsFile := fs.String("records", "", "file holding the verifier records")
+	showKey := fs.Bool("show-key", false, "log the session keys")
+	transcriptFile := fs.String("transcript", "", "append the transcripts of the handshakes, secrets included, to this file")
+	fs.Parse(args)
+	if *recordsFile == "" {
+		return fmt.Errorf("Missing -records")
+	}
+	records, err := loadRecords(*recordsFile)
+	if err != nil {
+		return err
+	}
+	transcripts, err := openTranscriptLog(*transcriptFile)
+	if err != nil {
+		return err
+	}
+	logger := log.New(os.Stderr, "", log.LstdFlags)
+
+	if *listen == "" {
+		username, key, err := serve(stdio{os.Stdin, os.Stdout}, records, transcripts)
+		if err != nil {
+			return err
+		}
+		logResult(logger, "stdio", username, key, *showKey)
+		return nil
+	}
+
+	l, err := net.Listen("tcp", *listen)
+	if err != nil {
+		return err
+	}
+	logger.Printf("Listening on %s", l.Addr())
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			return err
+		}
+		go func() {
+			defer conn.Close()
+			username, key, err := serve(conn, records, transcripts)
+			if err != nil {
+				logger.Printf("%s: %v", conn.RemoteAddr(), err)
+				return
+			}
+			logResult(logger, conn.RemoteAddr().String(), username, key, *showKey)
+		}()
+	}
+}
+
+func logResult(logger *log.Logger, peer, username string, key []byte, showKey bool) {
+	if showKey {
+		logger.Printf("%s: %s authenticated, K=%x", peer, username, key)
+	} else {
+		logger.Printf("%s: %s authenticated", peer, username)
+	}
+}
+
+// serve runs the server side of a handshake. It returns the username and the
+// session key once the client has been authenticated. The transcript of the
+// handshake is written to transcripts, if not nil.
+func serve(rw io.ReadWriter, records map[string]*srp.VerifierRecord, transcripts *transcriptLog) (string, []byte, error) {
+	hello := new(srp.ClientHello)
+	if err := srp.ReadMessage(rw, hello); err != nil {
+		return "", nil, err
+	}
+	username := string(hello.Username)
+	rec, ok := records[username]
+	if !ok {
+		return username, nil, fmt.Errorf("Unknown user: %s", username)
+	}
+	if hello.Offer != nil {
+		if err := hello.Offer.Allows(rec.Group, rec.Params); err != nil {
+			return username, nil, err
+		}
+	}
+	s, err := rec.NewSRP()
+	if err != nil {
+		return username, nil, err
+	}
+	s.Debug = transcripts != nil
+	ss := s.NewServerSession(rec.Username, rec.Salt, rec.Verifier)
+	defer ss.Destroy()
+	defer transcripts.write(ss.Transcript())
+	if err := hello.Validate(s); err != nil {
+		return username, nil, err
+	}
+	if hello.Offer != nil {
+		ss.BindNegotiation(hello.Offer, rec.Group, rec.Params)
+	}
+
+	challenge := &srp.ServerChallenge{
+		Salt:   rec.Salt,
+		B:      ss.GetB(),
+		Group:  rec.Group,
+		Params: rec.Params,
+	}
+	if hello.A == nil && hello.Offer == nil {
+		challenge.Prime = s.Group.Prime.Bytes()
+		challenge.Generator = s.Group.Generator.Bytes()
+	}
+	if err := srp.WriteMessage(rw, challenge); err != nil {
+		return username, nil, err
+	}
+
+	proof := new(srp.ClientProof)
+	if err := srp.ReadMessage(rw, proof); err != nil {
+		return username, nil, err
+	}
+	if err := proof.Validate(s); err != nil {
+		return username, nil, err
+	}
+	A := hello.A
+	if A == nil {
+		// The client sends A once it knows the group.
+		A = proof.A
+	} else if proof.A != nil {
+		return username, nil, fmt.Errorf("Unexpected A in the proof")
+	}
+	key, err := ss.ComputeKey(A)
+	if err != nil {
+		return username, nil, err
+	}
+	if !ss.VerifyClientAuthenticator(proof.M1) {
+		return username, nil, fmt.Errorf("Client authenticator for %s is not valid", username)
+	}
+	err = srp.WriteMessage(rw, &srp.ServerProof{M2: ss.ComputeAuthenticator(proof.M1)})
+	return username, append([]byte{}, key...), err
+}
+
+func runClient(args []string) error {
+	fs := flag.NewFlagSet("client", flag.ExitOnError)
+	c := configFlags(fs)
+	connect := fs.String("connect", "", "TCP address of the server instead of using stdin and stdout")
+	passwordFile := fs.String("password-file", "", "read the password from this file")
+	showKey := fs.Bool("show-key", false, "print the session key")
+	transcriptFile := fs.String("transcript", "", "append the transcript of the handshake, secrets included, to this file")
+	offer := fs.String("offer", "", "comma separated groups to offer, letting the server choose the group and the parameters other than -hash, -kdf and -profile")
+	acceptGroups := fs.String("accept-groups", "", "use the group and parameters sent by the server if the group is one of these comma separated groups, or any registered group of 2048 bits or more for \"any\"")
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		return fmt.Errorf("Expected a username")
+	}
+
+	var rw io.ReadWriter = stdio{os.Stdin, os.Stdout}
+	if *connect != "" {
+		conn, err := net.Dial("tcp", *connect)
+		if err != nil {
+			return err
+		}
+		defer conn.Close()
+		rw = conn
+	}
+	password, err := readPassword(*passwordFile, *connect == "")
+	if err != nil {
+		return err
+	}
+	transcripts, err := openTranscriptLog(*transcriptFile)
+	if err != nil {
+		return err
+	}
+	var key []byte
+	switch {
+	case *offer != "":
+		key, err = negotiate(rw, c.offer(*offer), nil, []byte(fs.Arg(0)), password, transcripts)
+	case *acceptGroups != "":
+		allow := new(srp.GroupAllowList)
+		if *acceptGroups != "any" {
+			allow.Names = strings.Split(*acceptGroups, ",")
+		}
+		key, err = negotiate(rw, nil, allow, []byte(fs.Arg(0)), password, transcripts)
+	default:
+		var s *srp.SRP
+		if s, err = srp.NewSRPWithParams(c.group, c.params()); err != nil {
+			return err
+		}
+		s.Debug = transcripts != nil
+		key, err = authenticate(rw, s, c.params(), []byte(fs.Arg(0)), password, transcripts)
+	}
+	if err != nil {
+		return err
+	}
+	// stdout may be carrying the handshake.
+	fmt.Fprintln(os.Stderr, "Authenticated")
+	if *showKey {
+		fmt.Fprintf(os.Stderr, "K=%x\n", key)
+	}
+	return nil
+}
+
+// authenticate runs the client side of a handshake and returns the session
+// key. The server must use the same group and parameters as s. The
+// transcript of the handshake is written to transcripts, if not nil.
+func authenticate(rw io.ReadWriter, s *srp.SRP, params map[string]string, username, password []byte, transcripts *transcriptLog) ([]byte, error) {
+	cs := s.NewClientSession(username, password)
+	defer cs.Destroy()
+	defer transcripts.write(cs.Transcript())
+	if err := srp.WriteMessage(rw, &srp.ClientHello{Username: username, A: cs.GetA()}); err != nil {
+		return nil, err
+	}
+
+	challenge := new(srp.ServerChallenge)
+	if err := srp.ReadMessage(rw, challenge); err != nil {
+		return nil, err
+	}
+	if err := challenge.Validate(s); err != nil {
+		return nil, err
+	}
+	if !reflect.DeepEqual(normalizeParams(challenge.Params), normalizeParams(params)) {
+		return nil, fmt.Errorf("Server parameters %v do not match %v", challenge.Params, params)
+	}
+	return prove(rw, cs, challenge, nil)
+}
+
+// negotiate runs the client side of a handshake in which the server chooses
+// the group and parameters, within offer if it is not nil and otherwise
+// among the groups accepted by allow, and returns the session key.
+func negotiate(rw io.ReadWriter, offer *srp.Offer, allow *srp.GroupAllowList, username, password []byte, transcripts *transcriptLog) ([]byte, error) {
+	if err := srp.WriteMessage(rw, &srp.ClientHello{Username: username, Offer: offer}); err != nil {
+		return nil, err
+	}
+	challenge := new(srp.ServerChallenge)
+	if err := srp.ReadMessage(rw, challenge); err != nil {
+		return nil, err
+	}
+	var s *srp.SRP
+	var err error
+	if offer != nil {
+		s, err = offer.NewSRP(challenge)
+	} else {
+		s, err = allow.NewSRP(challenge)
+	}
+	if err != nil {
+		return nil, err
+	}
+	s.Debug = transcripts != nil
+	cs := s.NewClientSession(username, password)
+	defer cs.Destroy()
+	defer transcripts.write(cs.Transcript())
+	if offer != nil {
+		cs.BindNegotiation(offer, challenge.Group, challenge.Params)
+	}
+	return prove(rw, cs, challenge, cs.GetA())
+}
+
+// prove completes a handshake from the server's challenge, sending A with
+// the proof if it is not nil, and returns the session key.
+func prove(rw io.ReadWriter, cs *srp.ClientSession, challenge *srp.ServerChallenge, A []byte) ([]byte, error) {
+	s := cs.SRP
+	key, err := cs.ComputeKey(challenge.Salt, challenge.B)
+	if err != nil {
+		return nil, err
+	}
+	if err := srp.WriteMessage(rw, &srp.ClientProof{M1: cs.ComputeAuthenticator(), A: A}); err != nil {
+		return nil, err
+	}
+
+	proof := new(srp.ServerProof)
+	if err := srp.ReadMessage(rw, proof); err != nil {
+		if err == io.EOF {
+			return nil, fmt.Errorf("Authentication failed")
+		}
+		return nil, err
+	}
+	if err := proof.Validate(s); err != nil {
+		return nil, err
+	}
+	if !cs.VerifyServerAuthenticator(proof.M2) {
+		return nil, fmt.Errorf("Server authenticator is not valid")
+	}
+	return append([]byte{}, key...), nil
+}
+
+// normalizeParams fills in the defaults of srp.NewSRPWithParams so that
+// equivalent parameters compare equal.
+func normalizeParams(params map[string]string) map[string]string {
+	n := map[string]string{srp.ParamHash: srp.DefaultHash, srp.ParamKDF: "default"}
+	switch params[srp.ParamKDF] {
+	case "pbkdf2":
+		n[srp.ParamIter] = strconv.Itoa(srp.DefaultPBKDF2Iter)
+	case "scrypt":
+		n[srp.ParamScryptN] = strconv.Itoa(srp.DefaultScryptN)
+		n[srp.ParamScryptR] = strconv.Itoa(srp.DefaultScryptR)
+		n[srp.ParamScryptP] = strconv.Itoa(srp.DefaultScryptP)
+	}
+	for k, v := range params {
+		if v != "" {
+			n[k] = v
+		}
+	}
+	return n
+}
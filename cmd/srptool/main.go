@@ -0,0 +1,353 @@
+// Copyright 2013 Tad Glines
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+// Command srptool creates verifier records, inspects groups and runs SRP
+// handshakes for testing.
+//
+// Usage:
+//
+//	srptool verifier [flags] username   Create a verifier record
+//	srptool groups                      List the registered groups
+//	srptool group name                  Dump a registered group
+//	srptool server [flags]              Run the server side of handshakes
+//	srptool client [flags] username     Run the client side of a handshake
+//	srptool decode [file ...]           Decode and check verifier records
+//	srptool diagnose [-n i] transcript values
+//	                                    Find where a peer diverges from a transcript
+//
+// Records are written one per line, either as JSON or as the base64 of the
+// binary encoding (-format binary). Both forms are accepted wherever records
+// are read. The handshake uses the messages of the srp package framed with
+// srp.WriteMessage, over TCP (-connect, -listen) or stdin and stdout. With
+// -offer, the client lets the server choose among the given groups and
+// choose the parameters of the KDF (see srp.Offer). With -accept-groups, it
+// uses the N, g and parameters sent by the server if N and g are those of an
+// accepted group (see srp.GroupAllowList).
+//
+// With -transcript, server and client append the transcripts of their
+// handshakes to a file (see srp.Transcript). diagnose compares one of them
+// with the values reported by a peer that failed to authenticate, given as
+// a JSON object in the format written by srp-vectors, and points to the first
+// value that differs.
+//
+// Passwords are read from the terminal when there is one, otherwise from the
+// first line of stdin or of the file given with -password-file.
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"code.google.com/p/go.crypto/ssh/terminal"
+	"encoding/base64"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"github.com/lann/go-pkgs/crypto/srp"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+)
+
+type command struct {
+	run   func(args []string) error
+	usage string
+}
+
+var commands map[string]command
+
+func init() {
+	commands = map[string]command{
+		"verifier": {runVerifier, "[flags] username"},
+		"groups":   {runGroups, ""},
+		"group":    {runGroup, "name"},
+		"server":   {runServer, "[flags]"},
+		"client":   {runClient, "[flags] username"},
+		"decode":   {runDecode, "[file ...]"},
+		"diagnose": {runDiagnose, "[-n index] transcript values"},
+	}
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage: srptool command [arguments]")
+	fmt.Fprintln(os.Stderr, "commands:")
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(os.Stderr, "\t%s %s\n", name, commands[name].usage)
+	}
+	os.Exit(2)
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+	}
+	cmd, ok := commands[os.Args[1]]
+	if !ok {
+		usage()
+	}
+	if err := cmd.run(os.Args[2:]); err != nil {
+		fmt.Fprintf(os.Stderr, "srptool %s: %v\n", os.Args[1], err)
+		os.Exit(1)
+	}
+}
+
+// config holds the flags that select the SRP parameters.
+type config struct {
+	group   string
+	hash    string
+	kdf     string
+	iter    int
+	N, r, p int
+	profile string
+}
+
+func configFlags(fs *flag.FlagSet) *config {
+	c := new(config)
+	fs.StringVar(&c.group, "group", "rfc5054.2048", "SRP group")
+	fs.StringVar(&c.hash, "hash", srp.DefaultHash, "hash function")
+	fs.StringVar(&c.kdf, "kdf", "default", "key derivation function: default, pbkdf2 or scrypt")
+	fs.IntVar(&c.iter, "iter", srp.DefaultPBKDF2Iter, "pbkdf2 iterations")
+	fs.IntVar(&c.N, "scrypt-N", srp.DefaultScryptN, "scrypt CPU/memory cost")
+	fs.IntVar(&c.r, "scrypt-r", srp.DefaultScryptR, "scrypt block size")
+	fs.IntVar(&c.p, "scrypt-p", srp.DefaultScryptP, "scrypt parallelization")
+	fs.StringVar(&c.profile, "profile", "", "SRP profile")
+	return c
+}
+
+// params returns the parameters selected by the flags, as accepted by
+// srp.NewSRPWithParams.
+func (c *config) params() map[string]string {
+	p := map[string]string{srp.ParamHash: c.hash, srp.ParamKDF: c.kdf}
+	switch c.kdf {
+	case "pbkdf2":
+		p[srp.ParamIter] = strconv.Itoa(c.iter)
+	case "scrypt":
+		p[srp.ParamScryptN] = strconv.Itoa(c.N)
+		p[srp.ParamScryptR] = strconv.Itoa(c.r)
+		p[srp.ParamScryptP] = strconv.Itoa(c.p)
+	}
+	if c.profile != "" {
+		p[srp.ParamProfile] = c.profile
+	}
+	return p
+}
+
+// offer returns an offer of the comma separated groups with the hash, KDF
+// and profile selected by the flags.
+func (c *config) offer(groups string) *srp.Offer {
+	o := &srp.Offer{
+		Groups: strings.Split(groups, ","),
+		Hashes: []string{c.hash},
+		KDFs:   []string{c.kdf},
+	}
+	if c.profile != "" {
+		o.Profiles = []string{c.profile}
+	}
+	return o
+}
+
+// readPassword reads a password from file, the terminal or stdin, in that
+// order of preference. With tty set the terminal is opened directly, which
+// is needed when stdin carries the handshake.
+func readPassword(file string, tty bool) ([]byte, error) {
+	if file != "" {
+		f, err := os.Open(file)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		return readLine(f)
+	}
+	in := os.Stdin
+	if tty {
+		f, err := os.Open("/dev/tty")
+		if err != nil {
+			return nil, fmt.Errorf("No terminal to read the password from, use -password-file")
+		}
+		defer f.Close()
+		in = f
+	}
+	if !terminal.IsTerminal(int(in.Fd())) {
+		return readLine(in)
+	}
+	fmt.Fprint(os.Stderr, "Password: ")
+	password, err := terminal.ReadPassword(int(in.Fd()))
+	fmt.Fprintln(os.Stderr)
+	return password, err
+}
+
+func readLine(r io.Reader) ([]byte, error) {
+	line, err := bufio.NewReader(r).ReadBytes('\n')
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+	line = bytes.TrimRight(line, "\r\n")
+	if len(line) == 0 {
+		return nil, fmt.Errorf("Empty password")
+	}
+	return line, nil
+}
+
+func runVerifier(args []string) error {
+	fs := flag.NewFlagSet("verifier", flag.ExitOnError)
+	c := configFlags(fs)
+	format := fs.String("format", "json", "output format: json or binary")
+	passwordFile := fs.String("password-file", "", "read the password from this file")
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		return fmt.Errorf("Expected a username")
+	}
+
+	password, err := readPassword(*passwordFile, false)
+	if err != nil {
+		return err
+	}
+	r, err := srp.NewVerifierRecord(c.group, c.params(), []byte(fs.Arg(0)), password)
+	if err != nil {
+		return err
+	}
+	line, err := encodeRecord(r, *format)
+	if err != nil {
+		return err
+	}
+	fmt.Println(line)
+	return nil
+}
+
+func encodeRecord(r *srp.VerifierRecord, format string) (string, error) {
+	switch format {
+	case "json":
+		data, err := json.Marshal(r)
+		return string(data), err
+	case "binary":
+		data, err := r.MarshalBinary()
+		return base64.StdEncoding.EncodeToString(data), err
+	}
+	return "", fmt.Errorf("Invalid format: %s", format)
+}
+
+func loadRecords(file string) (map[string]*srp.VerifierRecord, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	records, err := srp.ReadVerifierRecords(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", file, err)
+	}
+	return records, nil
+}
+
+func runGroups(args []string) error {
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(w, "NAME\tBITS\tGENERATOR")
+	for _, name := range srp.GroupNames() {
+		grp, err := srp.GetGroup(name)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(w, "%s\t%d\t%s\n", name, grp.Size, grp.Generator)
+	}
+	return w.Flush()
+}
+
+func runGroup(args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("Expected a group name")
+	}
+	grp, err := srp.GetGroup(args[0])
+	if err != nil {
+		return err
+	}
+	fmt.Printf("name:      %s\n", args[0])
+	fmt.Printf("bits:      %d\n", grp.Size)
+	fmt.Printf("generator: %s\n", grp.Generator)
+	fmt.Println("prime:")
+	N := fmt.Sprintf("%X", grp.Prime)
+	for len(N) > 0 {
+		n := 64
+		if n > len(N) {
+			n = len(N)
+		}
+		fmt.Printf("  %s\n", N[:n])
+		N = N[n:]
+	}
+	return nil
+}
+
+func runDecode(args []string) error {
+	var files []io.Reader
+	names := args
+	if len(args) == 0 {
+		files = append(files, os.Stdin)
+		names = []string{"-"}
+	}
+	for _, name := range args {
+		f, err := os.Open(name)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		files = append(files, f)
+	}
+
+	invalid := 0
+	for i, f := range files {
+		err := srp.ScanVerifierRecords(f, func(lineno int, r *srp.VerifierRecord, err error) {
+			fmt.Printf("%s:%d:\n", names[i], lineno)
+			if err != nil {
+				invalid++
+				fmt.Printf("  error:    %v\n", err)
+				return
+			}
+			printRecord(r)
+			if err := r.Validate(); err != nil {
+				invalid++
+				fmt.Printf("  invalid:  %v\n", err)
+			}
+		})
+		if err != nil {
+			return err
+		}
+	}
+	if invalid > 0 {
+		return fmt.Errorf("%d invalid records", invalid)
+	}
+	return nil
+}
+
+func printRecord(r *srp.VerifierRecord) {
+	keys := make([]string, 0, len(r.Params))
+	for k := range r.Params {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	params := make([]string, len(keys))
+	for i, k := range keys {
+		params[i] = k + "=" + r.Params[k]
+	}
+	fmt.Printf("  username: %s\n", r.Username)
+	fmt.Printf("  group:    %s\n", r.Group)
+	fmt.Printf("  params:   %s\n", strings.Join(params, " "))
+	fmt.Printf("  salt:     %x\n", r.Salt)
+	fmt.Printf("  verifier: %x\n", r.Verifier)
+}
@@ -0,0 +1,198 @@
+// Copyright 2013 Tad Glines
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"github.com/lann/go-pkgs/crypto/srp"
+	"net"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestRecordFormats(t *testing.T) {
+	c := configFlags(flag.NewFlagSet("test", flag.PanicOnError))
+	c.group, c.kdf, c.iter = "rfc5054.1024", "pbkdf2", 10
+	r, err := srp.NewVerifierRecord(c.group, c.params(), []byte("test"), []byte("password"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, format := range []string{"json", "binary"} {
+		line, err := encodeRecord(r, format)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got []*srp.VerifierRecord
+		in := "# comment\n\n" + line + "\n"
+		err = srp.ScanVerifierRecords(strings.NewReader(in), func(lineno int, rec *srp.VerifierRecord, err error) {
+			if err != nil {
+				t.Fatalf("%s: line %d: %v", format, lineno, err)
+			}
+			got = append(got, rec)
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(got) != 1 || !reflect.DeepEqual(got[0], r) {
+			t.Fatalf("%s: record changed: %#v", format, got)
+		}
+	}
+	if _, err := srp.ParseVerifierRecord("not base64"); err == nil {
+		t.Fatal("Expected an invalid record to be rejected")
+	}
+}
+
+// testHandshake runs a handshake with the client configured by c, which
+// negotiates if offer is not empty, or accepts the group of the server if
+// offer is "accept".
+func testHandshake(t *testing.T, c *config, offer string, password []byte) ([]byte, []byte, error, error) {
+	r, err := srp.NewVerifierRecord("rfc5054.1024", map[string]string{srp.ParamKDF: "pbkdf2", srp.ParamIter: "10"},
+		[]byte("test"), []byte("password"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	records := map[string]*srp.VerifierRecord{"test": r}
+
+	s, err := srp.NewSRPWithParams(c.group, c.params())
+	if err != nil {
+		t.Fatal(err)
+	}
+	cconn, sconn := net.Pipe()
+	done := make(chan error)
+	var skey []byte
+	go func() {
+		var err error
+		_, skey, err = serve(sconn, records, nil)
+		sconn.Close()
+		done <- err
+	}()
+	var ckey []byte
+	var cerr error
+	switch offer {
+	case "":
+		ckey, cerr = authenticate(cconn, s, c.params(), []byte("test"), password, nil)
+	case "accept":
+		ckey, cerr = negotiate(cconn, nil, &srp.GroupAllowList{MinSize: 1024}, []byte("test"), password, nil)
+	default:
+		ckey, cerr = negotiate(cconn, c.offer(offer), nil, []byte("test"), password, nil)
+	}
+	cconn.Close()
+	serr := <-done
+	return ckey, skey, cerr, serr
+}
+
+func TestHandshake(t *testing.T) {
+	c := configFlags(flag.NewFlagSet("test", flag.PanicOnError))
+	c.group, c.kdf, c.iter = "rfc5054.1024", "pbkdf2", 10
+
+	ckey, skey, cerr, serr := testHandshake(t, c, "", []byte("password"))
+	if cerr != nil || serr != nil {
+		t.Fatalf("Handshake failed: client: %v, server: %v", cerr, serr)
+	}
+	if !bytes.Equal(ckey, skey) {
+		t.Fatal("Keys don't match")
+	}
+
+	_, _, cerr, serr = testHandshake(t, c, "", []byte("wrong"))
+	if cerr == nil || serr == nil {
+		t.Fatal("Expected a wrong password to be rejected")
+	}
+
+	c.iter = 20
+	_, _, cerr, _ = testHandshake(t, c, "", []byte("password"))
+	if cerr == nil {
+		t.Fatal("Expected mismatched parameters to be rejected")
+	}
+
+	// The server chooses the iterations of the record.
+	ckey, skey, cerr, serr = testHandshake(t, c, "rfc5054.2048,rfc5054.1024", []byte("password"))
+	if cerr != nil || serr != nil || !bytes.Equal(ckey, skey) {
+		t.Fatalf("Negotiated handshake failed: client: %v, server: %v", cerr, serr)
+	}
+	ckey, skey, cerr, serr = testHandshake(t, c, "accept", []byte("password"))
+	if cerr != nil || serr != nil || !bytes.Equal(ckey, skey) {
+		t.Fatalf("Handshake with the group of the server failed: client: %v, server: %v", cerr, serr)
+	}
+	_, _, _, serr = testHandshake(t, c, "rfc5054.2048", []byte("password"))
+	if _, ok := serr.(*srp.NegotiationError); !ok {
+		t.Fatalf("Expected a NegotiationError, got %v", serr)
+	}
+}
+
+func TestDiagnose(t *testing.T) {
+	dir := t.TempDir()
+	r, err := srp.NewVerifierRecord("rfc5054.1024", nil, []byte("test"), []byte("password"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := srp.NewSRPWithParams("rfc5054.1024", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Debug = true
+	var cbuf, sbuf bytes.Buffer
+	cconn, sconn := net.Pipe()
+	go func() {
+		serve(sconn, map[string]*srp.VerifierRecord{"test": r}, &transcriptLog{w: &sbuf})
+		sconn.Close()
+	}()
+	if _, err := authenticate(cconn, s, nil, []byte("test"), []byte("wrong"), &transcriptLog{w: &cbuf}); err == nil {
+		t.Fatal("Expected the wrong password to be rejected")
+	}
+	cconn.Close()
+
+	// The client reports its values as srp-vectors would.
+	client := new(srp.Transcript)
+	if err := json.Unmarshal(cbuf.Bytes(), client); err != nil {
+		t.Fatal(err)
+	}
+	fields := map[string]string{"group": "rfc5054.1024", "username": "test", "password": "wrong"}
+	for _, v := range client.Values {
+		if v.Name != "username" {
+			fields[v.Name] = hex.EncodeToString(v.Value)
+		}
+	}
+	data, _ := json.Marshal(map[string]interface{}{"group": "rfc5054.1024", "vectors": []interface{}{fields}})
+	os.WriteFile(filepath.Join(dir, "values"), data, 0600)
+	os.WriteFile(filepath.Join(dir, "transcripts"), append([]byte("\n"), sbuf.Bytes()...), 0600)
+
+	server, err := readTranscript(filepath.Join(dir, "transcripts"), -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if server.Role != srp.RoleServer || server.Get("b") == nil {
+		t.Fatalf("Unexpected transcript: %v", server)
+	}
+	peer, err := readPeerValues(filepath.Join(dir, "values"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(peer["password"]) != "wrong" || peer["group"] != nil || len(peer["A"]) == 0 {
+		t.Fatalf("Unexpected values: %v", peer)
+	}
+	// The client's S is that of a verifier made from the wrong password.
+	if d := srp.Diagnose(server, peer); d == nil || d.Name != "S" || len(d.Matches) == 0 {
+		t.Fatalf("Expected S to differ, got %v", d)
+	}
+	if _, err := readTranscript(filepath.Join(dir, "transcripts"), 1); err == nil {
+		t.Fatal("Expected a missing transcript to be reported")
+	}
+}
@@ -0,0 +1,141 @@
+// Copyright 2013 Tad Glines
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+package srp
+
+/*
+	A client that knows neither the group nor the parameters of a server
+	can have the server send N and g, as in RFC 5054. It sends a ClientHello
+	with neither A nor an Offer, and A with M1:
+
+		client                            server
+		ClientHello{I}            ->
+		                          <-      ServerChallenge{s, B, group, params, N, g}
+		ClientProof{M1, A}        ->
+		                          <-      ServerProof{M2}
+
+	N and g must not be used as they are: with a composite N, or a prime
+	for which N-1 has only small factors, the password can be recovered
+	from M1 by a malicious server, and checking that N is a safe prime and
+	g a generator is too expensive to do on every login. A GroupAllowList
+	therefore only accepts the N and g of registered groups, which are known
+	to be good, whatever name the server gives them. A group vetted by the
+	caller can be accepted by registering it with RegisterGroup and listing
+	it in Names.
+*/
+
+import (
+	"fmt"
+	"math/big"
+)
+
+// DefaultMinGroupSize is the size in bits of the smallest group accepted from
+// a server unless GroupAllowList.MinSize is set.
+const DefaultMinGroupSize = 2048
+
+// Reasons of a GroupError.
+const (
+	ReasonUnknownGroup    = "not a registered group"
+	ReasonGroupTooSmall   = "group too small"
+	ReasonGroupNotAllowed = "group not allowed"
+)
+
+// GroupError is returned when the N and g sent by a server are not accepted.
+type GroupError struct {
+	Name   string // The name of the registered group, if N and g are known
+	Size   int    // The size of N in bits
+	Reason string // One of the Reason constants
+}
+
+func (e *GroupError) Error() string {
+	if e.Name != "" {
+		return fmt.Sprintf("Server group %s (%d bits) rejected: %s", e.Name, e.Size, e.Reason)
+	}
+	return fmt.Sprintf("Server group (%d bits) rejected: %s", e.Size, e.Reason)
+}
+
+// GroupAllowList lists the groups a client accepts from a server. The zero
+// value accepts every registered group of at least DefaultMinGroupSize bits.
+// The cost bounds are those of Offer.
+type GroupAllowList struct {
+	Names      []string // Names of the registered groups accepted; all if empty
+	MinSize    int      // Minimum size of N in bits; DefaultMinGroupSize if 0
+	MinIter    int      // Bounds on the PBKDF2 iteration count
+	MaxIter    int      //
+	MinScryptN int      // Bounds on the scrypt N
+	MaxScryptN int      //
+}
+
+// Match returns the name of the registered group with the prime N and the
+// generator g, or a *GroupError if the group is not accepted.
+// This function must be called by only one goroutine at a time.
+func (l *GroupAllowList) Match(N, g []byte) (string, error) {
+	p, gen := new(big.Int).SetBytes(N), new(big.Int).SetBytes(g)
+	names := l.Names
+	if len(names) == 0 {
+		names = GroupNames()
+	}
+	var known string
+	for _, name := range GroupNames() {
+		grp := srp_groups[name]
+		if grp.Prime.Cmp(p) != 0 || grp.Generator.Cmp(gen) != 0 {
+			continue
+		}
+		if contains(names, name) {
+			if grp.Prime.BitLen() < l.minSize() {
+				return "", &GroupError{name, grp.Prime.BitLen(), ReasonGroupTooSmall}
+			}
+			return name, nil
+		}
+		if known == "" {
+			known = name
+		}
+	}
+	if known != "" {
+		return "", &GroupError{known, p.BitLen(), ReasonGroupNotAllowed}
+	}
+	return "", &GroupError{"", p.BitLen(), ReasonUnknownGroup}
+}
+
+// NewSRP returns the SRP context for a challenge carrying N and g, using the
+// params of the challenge, if the group and the costs are accepted. The
+// challenge is validated as well.
+// This function must be called by only one goroutine at a time.
+func (l *GroupAllowList) NewSRP(challenge *ServerChallenge) (*SRP, error) {
+	if challenge.Prime == nil {
+		return nil, fmt.Errorf("The challenge has no group parameters")
+	}
+	name, err := l.Match(challenge.Prime, challenge.Generator)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkCosts(challenge.Params, l.MinIter, l.MaxIter, l.MinScryptN, l.MaxScryptN); err != nil {
+		return nil, err
+	}
+	s, err := NewSRPWithParams(name, challenge.Params)
+	if err != nil {
+		return nil, err
+	}
+	if err := challenge.Validate(s); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (l *GroupAllowList) minSize() int {
+	if l.MinSize != 0 {
+		return l.MinSize
+	}
+	return DefaultMinGroupSize
+}
@@ -0,0 +1,137 @@
+// Copyright 2013 Tad Glines
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+package srp
+
+import (
+	"math/big"
+	"reflect"
+	"testing"
+)
+
+func TestGroupAllowList(t *testing.T) {
+	group := func(name string) ([]byte, []byte) {
+		grp := srp_groups[name]
+		return grp.Prime.Bytes(), grp.Generator.Bytes()
+	}
+	N, g := group("rfc5054.2048")
+	if name, err := new(GroupAllowList).Match(N, g); err != nil || srp_groups[name].Prime.Cmp(srp_groups["rfc5054.2048"].Prime) != 0 {
+		t.Fatalf("Expected rfc5054.2048 to be accepted, got %s, %v", name, err)
+	}
+	N1024, g1024 := group("rfc5054.1024")
+	if _, err := (&GroupAllowList{MinSize: 1024}).Match(N1024, g1024); err != nil {
+		t.Fatal(err)
+	}
+	bad := new(big.Int).Add(srp_groups["rfc5054.2048"].Prime, big.NewInt(2)).Bytes()
+
+	for _, test := range []struct {
+		list   *GroupAllowList
+		N, g   []byte
+		reason string
+	}{
+		{&GroupAllowList{}, N1024, g1024, ReasonGroupTooSmall},
+		{&GroupAllowList{Names: []string{"rfc5054.3072"}}, N, g, ReasonGroupNotAllowed},
+		{&GroupAllowList{}, N, []byte{3}, ReasonUnknownGroup},
+		{&GroupAllowList{}, bad, g, ReasonUnknownGroup},
+		{&GroupAllowList{}, nil, nil, ReasonUnknownGroup},
+	} {
+		_, err := test.list.Match(test.N, test.g)
+		if err, ok := err.(*GroupError); !ok || err.Reason != test.reason {
+			t.Errorf("%+v: expected a %q GroupError, got %v", test.list, test.reason, err)
+		}
+	}
+}
+
+func TestServerGroup(t *testing.T) {
+	rec, err := NewVerifierRecord("rfc5054.2048", map[string]string{ParamKDF: "pbkdf2", ParamIter: "10"}, []byte("test"), []byte("password"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ssrp, ss, err := rec.NewServerSession()
+	if err != nil {
+		t.Fatal(err)
+	}
+	hello := &ClientHello{Username: rec.Username}
+	if err := hello.Validate(ssrp); err != nil {
+		t.Fatal(err)
+	}
+	in := &ServerChallenge{
+		Salt:      rec.Salt,
+		B:         ss.GetB(),
+		Group:     "server name",
+		Params:    rec.Params,
+		Prime:     ssrp.Group.Prime.Bytes(),
+		Generator: ssrp.Group.Generator.Bytes(),
+	}
+	data, err := in.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	challenge := new(ServerChallenge)
+	if err := challenge.UnmarshalBinary(data); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(in, challenge) {
+		t.Fatalf("Binary round trip changed message: %#v != %#v", in, challenge)
+	}
+
+	s, err := new(GroupAllowList).NewSRP(challenge)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cs := s.NewClientSession(rec.Username, []byte("password"))
+	if _, err := cs.ComputeKey(challenge.Salt, challenge.B); err != nil {
+		t.Fatal(err)
+	}
+	proof := &ClientProof{M1: cs.ComputeAuthenticator(), A: cs.GetA()}
+	if err := proof.Validate(ssrp); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ss.ComputeKey(proof.A); err != nil {
+		t.Fatal(err)
+	}
+	if !ss.VerifyClientAuthenticator(proof.M1) {
+		t.Fatal("Client Authenticator is not valid")
+	}
+	if !cs.VerifyServerAuthenticator(ss.ComputeAuthenticator(proof.M1)) {
+		t.Fatal("Server Authenticator is not valid")
+	}
+
+	// A server sending a prime of its own choosing is refused.
+	challenge.Prime = new(big.Int).Add(ssrp.Group.Prime, big.NewInt(2)).Bytes()
+	if _, err := new(GroupAllowList).NewSRP(challenge); err == nil {
+		t.Fatal("Expected an unknown group to be refused")
+	}
+	challenge.Prime = nil
+	if _, err := new(GroupAllowList).NewSRP(challenge); err == nil {
+		t.Fatal("Expected a challenge without N to be refused")
+	}
+	if _, err := (&ServerChallenge{Salt: []byte{1}, B: []byte{2}, Prime: []byte{3}}).MarshalBinary(); err == nil {
+		t.Fatal("Expected a challenge without g to be rejected")
+	}
+
+	// Hostile or weak costs are refused.
+	challenge.Prime = ssrp.Group.Prime.Bytes()
+	l := &GroupAllowList{MinIter: 1000}
+	for _, params := range []map[string]string{
+		{ParamKDF: "pbkdf2", ParamIter: "1"},
+		{ParamKDF: "pbkdf2", ParamIter: "2147483647"},
+		{ParamKDF: "scrypt", ParamScryptN: "2", ParamScryptR: "1", ParamScryptP: "268435456"},
+	} {
+		challenge.Params = params
+		if _, err := l.NewSRP(challenge); err == nil {
+			t.Errorf("%v: expected an error", params)
+		}
+	}
+}
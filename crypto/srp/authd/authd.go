@@ -0,0 +1,173 @@
+// Copyright 2013 Tad Glines
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+// Package authd implements a daemon that runs the server side of SRP
+// handshakes on behalf of local services, and the client those services use
+// to talk to it. Only the daemon has access to the verifiers; a service
+// learns whether the user was authenticated and gets a key exported from
+// the session key, but never sees a verifier or the session key itself.
+//
+// A service opens one connection to the daemon per login and relays the
+// messages of the srp package between the user and the daemon:
+//
+//	service                           daemon
+//	srp.ClientHello           ->
+//	                          <-      Reply{challenge: srp.ServerChallenge}
+//	srp.ClientProof           ->
+//	                          <-      Reply{result: M2, exported key}
+//
+// All messages are framed with srp.WriteMessage. A Reply carries a status
+// and either the encoded message, the result or an error text.
+//
+// If the daemon requires client puzzles (see Server.Puzzles) it may answer
+// the hello with Reply{puzzle: srp.PuzzleChallenge} and close the
+// connection. Client.Begin then returns a *PuzzleError; the service sends
+// the puzzle to the user and starts over with the solved hello.
+//
+// Unknown users are given a challenge with a salt derived from the username
+// and a secret of the daemon, so that they cannot be told apart from known
+// users before the proof fails.
+//
+// A hello carrying an srp.Offer is answered with the group and parameters
+// of the user's record if the offer allows them, and with an error
+// otherwise. A hello with neither A nor an offer is answered with N and g
+// as well (see srp.GroupAllowList). In both cases A is then read from the
+// srp.ClientProof. Server.Group and Server.Params, used for unknown users,
+// should be common among the records, since an offer excluding them but
+// allowing the record of a user tells that the user exists.
+package authd
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"github.com/lann/go-pkgs/crypto/srp"
+)
+
+// ReplyVersion is the version of the Reply encoding.
+const ReplyVersion = 1
+
+// Reply statuses.
+const (
+	StatusOK         = 0 // Data holds the reply
+	StatusFailed     = 1 // The proof was not valid
+	StatusError      = 2 // Data holds an error message
+	StatusPuzzle     = 3 // Data holds a srp.PuzzleChallenge
+	maxReplyDataSize = 0xffff
+)
+
+// ExportedKeyLabel is used to derive the key returned to services from the
+// session key K:
+//
+//	key = HMAC-SHA256(K, ExportedKeyLabel | username)
+const ExportedKeyLabel = "SRP authd exported key"
+
+// ErrAuthenticationFailed is returned by Login.Finish when the user's proof
+// was not valid.
+var ErrAuthenticationFailed = errors.New("Authentication failed")
+
+// PuzzleError is returned by Client.Begin when the daemon requires the user
+// to solve a puzzle before it starts the handshake.
+type PuzzleError struct {
+	Challenge *srp.PuzzleChallenge
+	Err       error // Why the hello was refused, only set in the daemon
+}
+
+func (e *PuzzleError) Error() string {
+	if e.Err != nil {
+		return e.Err.Error()
+	}
+	return srp.ErrPuzzleRequired.Error()
+}
+
+// Reply is sent by the daemon in response to each message of a service.
+type Reply struct {
+	Status byte
+	Data   []byte
+}
+
+// MarshalBinary encodes the reply as version | status | uint16 length | data.
+func (r *Reply) MarshalBinary() ([]byte, error) {
+	if len(r.Data) > maxReplyDataSize {
+		return nil, fmt.Errorf("Reply too long: %d bytes", len(r.Data))
+	}
+	buf := make([]byte, 4+len(r.Data))
+	buf[0] = ReplyVersion
+	buf[1] = r.Status
+	binary.BigEndian.PutUint16(buf[2:], uint16(len(r.Data)))
+	copy(buf[4:], r.Data)
+	return buf, nil
+}
+
+// UnmarshalBinary decodes a reply.
+func (r *Reply) UnmarshalBinary(data []byte) error {
+	if len(data) < 4 {
+		return fmt.Errorf("Reply too short")
+	}
+	if data[0] != ReplyVersion {
+		return fmt.Errorf("Unsupported reply version: %d", data[0])
+	}
+	n := int(binary.BigEndian.Uint16(data[2:]))
+	if len(data) != 4+n {
+		return fmt.Errorf("Invalid reply length: %d", len(data))
+	}
+	r.Status = data[1]
+	r.Data = append([]byte{}, data[4:]...)
+	return nil
+}
+
+// Result is the outcome of a successful login.
+type Result struct {
+	M2  []byte // The server authenticator to relay to the user
+	Key []byte // The exported key, see ExportedKeyLabel
+}
+
+func (r *Result) marshal() []byte {
+	buf := make([]byte, 2, 4+len(r.M2)+len(r.Key))
+	binary.BigEndian.PutUint16(buf, uint16(len(r.M2)))
+	buf = append(buf, r.M2...)
+	buf = append(buf, 0, 0)
+	binary.BigEndian.PutUint16(buf[len(buf)-2:], uint16(len(r.Key)))
+	return append(buf, r.Key...)
+}
+
+func (r *Result) unmarshal(data []byte) error {
+	var fields [2][]byte
+	for i := range fields {
+		if len(data) < 2 {
+			return fmt.Errorf("Result truncated")
+		}
+		n := int(binary.BigEndian.Uint16(data))
+		data = data[2:]
+		if len(data) < n {
+			return fmt.Errorf("Result truncated")
+		}
+		fields[i] = append([]byte{}, data[:n]...)
+		data = data[n:]
+	}
+	if len(data) != 0 {
+		return fmt.Errorf("Unexpected %d bytes after result", len(data))
+	}
+	r.M2, r.Key = fields[0], fields[1]
+	return nil
+}
+
+func exportKey(K, username []byte) []byte {
+	mac := hmac.New(sha256.New, K)
+	mac.Write([]byte(ExportedKeyLabel))
+	mac.Write(username)
+	return mac.Sum(nil)
+}
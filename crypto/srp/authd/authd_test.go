@@ -0,0 +1,276 @@
+// Copyright 2013 Tad Glines
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+package authd
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"github.com/lann/go-pkgs/crypto/srp"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+var testParams = map[string]string{srp.ParamKDF: "pbkdf2", srp.ParamIter: "10"}
+
+// startServer runs a daemon for a store holding the user "test" with the
+// password "password" and returns a client for it. configure, if any, is
+// called before the daemon is started.
+func startServer(t *testing.T, configure ...func(*Server)) *Client {
+	dir, err := os.MkdirTemp("", "authd")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	r, err := srp.NewVerifierRecord("rfc5054.1024", testParams, []byte("test"), []byte("password"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	line, _ := json.Marshal(r)
+	records := filepath.Join(dir, "records")
+	if err := os.WriteFile(records, append(line, '\n'), 0600); err != nil {
+		t.Fatal(err)
+	}
+	store, err := NewFileStore(records)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	socket := filepath.Join(dir, "socket")
+	l, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+	s := NewServer(store)
+	s.Group = "rfc5054.1024"
+	s.Params = testParams
+	for _, fn := range configure {
+		fn(s)
+	}
+	go s.Serve(l)
+	return NewClient(socket)
+}
+
+// login plays the part of the user and of the service relaying its messages.
+func login(t *testing.T, c *Client, username, password string) ([]byte, *srp.ServerChallenge, *Result, error) {
+	s, err := srp.NewSRPWithParams("rfc5054.1024", testParams)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cs := s.NewClientSession([]byte(username), []byte(password))
+	l, challenge, err := c.Begin(&srp.ClientHello{Username: []byte(username), A: cs.GetA()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := challenge.Validate(s); err != nil {
+		t.Fatal(err)
+	}
+	K, err := cs.ComputeKey(challenge.Salt, challenge.B)
+	if err != nil {
+		t.Fatal(err)
+	}
+	result, err := l.Finish(&srp.ClientProof{M1: cs.ComputeAuthenticator()})
+	if err == nil && !cs.VerifyServerAuthenticator(result.M2) {
+		t.Fatal("Server Authenticator is not valid")
+	}
+	return K, challenge, result, err
+}
+
+func TestLogin(t *testing.T) {
+	c := startServer(t)
+	K, _, result, err := login(t, c, "test", "password")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(result.Key, exportKey(K, []byte("test"))) {
+		t.Fatal("The exported key was not derived from the session key")
+	}
+	if bytes.Equal(result.Key, K) {
+		t.Fatal("The session key was returned")
+	}
+
+	if _, _, _, err := login(t, c, "test", "wrong"); err != ErrAuthenticationFailed {
+		t.Fatalf("Expected ErrAuthenticationFailed, got %v", err)
+	}
+}
+
+func TestNegotiatedLogin(t *testing.T) {
+	c := startServer(t)
+	offer := &srp.Offer{Groups: []string{"rfc5054.2048", "rfc5054.1024"}, KDFs: []string{"pbkdf2"}}
+	l, challenge, err := c.Begin(&srp.ClientHello{Username: []byte("test"), Offer: offer})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := offer.NewSRP(challenge)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cs := s.NewClientSession([]byte("test"), []byte("password"))
+	cs.BindNegotiation(offer, challenge.Group, challenge.Params)
+	if _, err := cs.ComputeKey(challenge.Salt, challenge.B); err != nil {
+		t.Fatal(err)
+	}
+	result, err := l.Finish(&srp.ClientProof{M1: cs.ComputeAuthenticator(), A: cs.GetA()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !cs.VerifyServerAuthenticator(result.M2) {
+		t.Fatal("Server Authenticator is not valid")
+	}
+
+	// Without A nor an offer, the daemon sends N and g.
+	l, challenge, err = c.Begin(&srp.ClientHello{Username: []byte("test")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err = (&srp.GroupAllowList{MinSize: 1024}).NewSRP(challenge)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cs = s.NewClientSession([]byte("test"), []byte("password"))
+	if _, err := cs.ComputeKey(challenge.Salt, challenge.B); err != nil {
+		t.Fatal(err)
+	}
+	result, err = l.Finish(&srp.ClientProof{M1: cs.ComputeAuthenticator(), A: cs.GetA()})
+	if err != nil || !cs.VerifyServerAuthenticator(result.M2) {
+		t.Fatalf("Login with the group of the server failed: %v", err)
+	}
+
+	// The record uses pbkdf2, which is not offered.
+	offer.KDFs = []string{"scrypt"}
+	if _, _, err := c.Begin(&srp.ClientHello{Username: []byte("test"), Offer: offer}); err == nil {
+		t.Fatal("Expected a record outside the offer to be refused")
+	}
+}
+
+func TestUnknownUser(t *testing.T) {
+	c := startServer(t)
+	_, ch1, _, err := login(t, c, "unknown", "password")
+	if err != ErrAuthenticationFailed {
+		t.Fatalf("Expected ErrAuthenticationFailed, got %v", err)
+	}
+	_, ch2, _, _ := login(t, c, "unknown", "password")
+	if !bytes.Equal(ch1.Salt, ch2.Salt) {
+		t.Fatal("The salt of an unknown user changed between logins")
+	}
+	_, ch3, _, _ := login(t, c, "test", "password")
+	if len(ch1.Salt) != len(ch3.Salt) || ch1.Group != ch3.Group {
+		t.Fatal("The challenge of an unknown user differs from that of a known one")
+	}
+}
+
+func TestPuzzle(t *testing.T) {
+	puzzles := srp.NewPuzzleIssuer(nil)
+	puzzles.SetDifficulty(4)
+	c := startServer(t, func(s *Server) { s.Puzzles = puzzles })
+
+	s, err := srp.NewSRPWithParams("rfc5054.1024", testParams)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cs := s.NewClientSession([]byte("test"), []byte("password"))
+	hello := &srp.ClientHello{Username: []byte("test"), A: cs.GetA()}
+	_, _, err = c.Begin(hello)
+	perr, ok := err.(*PuzzleError)
+	if !ok {
+		t.Fatalf("Expected a *PuzzleError, got %v", err)
+	}
+	if perr.Challenge.Difficulty != 4 {
+		t.Fatalf("Unexpected puzzle: %+v", perr.Challenge)
+	}
+
+	if err := hello.SolvePuzzle(perr.Challenge); err != nil {
+		t.Fatal(err)
+	}
+	l, challenge, err := c.Begin(hello)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := cs.ComputeKey(challenge.Salt, challenge.B); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := l.Finish(&srp.ClientProof{M1: cs.ComputeAuthenticator()}); err != nil {
+		t.Fatal(err)
+	}
+
+	// Once the load is gone puzzles are no longer required.
+	puzzles.SetDifficulty(0)
+	if _, _, _, err := login(t, c, "test", "password"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestScheduler(t *testing.T) {
+	sched := srp.NewScheduler(1, 1)
+	defer sched.Close()
+	c := startServer(t, func(s *Server) { s.Scheduler = sched })
+	if _, _, _, err := login(t, c, "test", "password"); err != nil {
+		t.Fatal(err)
+	}
+	if st := sched.Stats(); st.Completed != 1 {
+		t.Fatalf("Login did not use the scheduler: %+v", st)
+	}
+
+	// Fill the worker and the queue.
+	release := make(chan struct{})
+	started := make(chan struct{})
+	go sched.Do(context.Background(), func() error {
+		close(started)
+		<-release
+		return nil
+	})
+	<-started
+	go sched.Do(context.Background(), func() error { return nil })
+	for sched.QueueDepth() != 1 {
+		time.Sleep(time.Millisecond)
+	}
+	defer close(release)
+
+	s, err := srp.NewSRPWithParams("rfc5054.1024", testParams)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cs := s.NewClientSession([]byte("test"), []byte("password"))
+	_, _, err = c.Begin(&srp.ClientHello{Username: []byte("test"), A: cs.GetA()})
+	if err == nil || !strings.Contains(err.Error(), "overloaded") {
+		t.Fatalf("Expected an overload error, got %v", err)
+	}
+}
+
+func TestReplyEncoding(t *testing.T) {
+	in := &Reply{Status: StatusError, Data: []byte("error")}
+	data, err := in.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := new(Reply)
+	if err := out.UnmarshalBinary(data); err != nil {
+		t.Fatal(err)
+	}
+	if out.Status != in.Status || !bytes.Equal(out.Data, in.Data) {
+		t.Fatalf("Round trip changed reply: %#v != %#v", in, out)
+	}
+	for _, bad := range [][]byte{data[:3], data[:len(data)-1], append(data, 0), append([]byte{2}, data[1:]...)} {
+		if new(Reply).UnmarshalBinary(bad) == nil {
+			t.Errorf("Expected %x to be rejected", bad)
+		}
+	}
+}
@@ -0,0 +1,114 @@
+// Copyright 2013 Tad Glines
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+package authd
+
+import (
+	"fmt"
+	"github.com/lann/go-pkgs/crypto/srp"
+	"net"
+	"time"
+)
+
+// Client connects to a daemon listening on a Unix socket.
+type Client struct {
+	Path    string // Path of the daemon's socket
+	Timeout time.Duration
+}
+
+// NewClient creates a client for the daemon listening on path.
+func NewClient(path string) *Client {
+	return &Client{Path: path, Timeout: DefaultTimeout}
+}
+
+// Login is a login in progress.
+// Instances of Login are NOT safe for concurrent use.
+type Login struct {
+	conn net.Conn
+}
+
+// Begin starts a login with the user's hello and returns the challenge to
+// send back to the user. The Login must be finished or closed.
+// If the daemon requires a puzzle to be solved first, Begin returns a
+// *PuzzleError holding the puzzle for the user.
+func (c *Client) Begin(hello *srp.ClientHello) (*Login, *srp.ServerChallenge, error) {
+	conn, err := net.DialTimeout("unix", c.Path, c.Timeout)
+	if err != nil {
+		return nil, nil, err
+	}
+	if c.Timeout > 0 {
+		conn.SetDeadline(time.Now().Add(c.Timeout))
+	}
+	l := &Login{conn: conn}
+	if err := srp.WriteMessage(conn, hello); err != nil {
+		l.Close()
+		return nil, nil, err
+	}
+	data, err := l.reply()
+	if err != nil {
+		l.Close()
+		return nil, nil, err
+	}
+	challenge := new(srp.ServerChallenge)
+	if err := challenge.UnmarshalBinary(data); err != nil {
+		l.Close()
+		return nil, nil, err
+	}
+	return l, challenge, nil
+}
+
+// Finish completes the login with the user's proof. It returns
+// ErrAuthenticationFailed if the proof is not valid. The Login is closed.
+func (l *Login) Finish(proof *srp.ClientProof) (*Result, error) {
+	defer l.Close()
+	if err := srp.WriteMessage(l.conn, proof); err != nil {
+		return nil, err
+	}
+	data, err := l.reply()
+	if err != nil {
+		return nil, err
+	}
+	result := new(Result)
+	if err := result.unmarshal(data); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// Close abandons the login.
+func (l *Login) Close() error {
+	return l.conn.Close()
+}
+
+func (l *Login) reply() ([]byte, error) {
+	r := new(Reply)
+	if err := srp.ReadMessage(l.conn, r); err != nil {
+		return nil, err
+	}
+	switch r.Status {
+	case StatusOK:
+		return r.Data, nil
+	case StatusFailed:
+		return nil, ErrAuthenticationFailed
+	case StatusError:
+		return nil, fmt.Errorf("authd: %s", r.Data)
+	case StatusPuzzle:
+		c := new(srp.PuzzleChallenge)
+		if err := c.UnmarshalBinary(r.Data); err != nil {
+			return nil, err
+		}
+		return nil, &PuzzleError{Challenge: c}
+	}
+	return nil, fmt.Errorf("Unknown reply status: %d", r.Status)
+}
@@ -0,0 +1,60 @@
+// Copyright 2013 Tad Glines
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+package authd
+
+import (
+	"bytes"
+	"testing"
+)
+
+func FuzzReply(f *testing.F) {
+	for _, r := range []*Reply{
+		{Status: StatusOK, Data: []byte("data")},
+		{Status: StatusPuzzle},
+		{Status: 0xff, Data: make([]byte, maxReplyDataSize)},
+	} {
+		data, err := r.MarshalBinary()
+		if err != nil {
+			f.Fatal(err)
+		}
+		f.Add(data)
+	}
+	f.Add([]byte{ReplyVersion, StatusOK, 0xff, 0xff})
+	f.Fuzz(func(t *testing.T, data []byte) {
+		r := new(Reply)
+		if err := r.UnmarshalBinary(data); err != nil {
+			return
+		}
+		out, err := r.MarshalBinary()
+		if err != nil || !bytes.Equal(out, data) {
+			t.Fatalf("Reply decoded from %x encodes to %x, %v", data, out, err)
+		}
+	})
+}
+
+func FuzzResult(f *testing.F) {
+	f.Add((&Result{M2: []byte{1, 2}, Key: make([]byte, 32)}).marshal())
+	f.Add((&Result{}).marshal())
+	f.Add([]byte{0xff, 0xff, 0})
+	f.Fuzz(func(t *testing.T, data []byte) {
+		r := new(Result)
+		if err := r.unmarshal(data); err != nil {
+			return
+		}
+		if out := r.marshal(); !bytes.Equal(out, data) {
+			t.Fatalf("Result decoded from %x encodes to %x", data, out)
+		}
+	})
+}
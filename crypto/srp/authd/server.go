@@ -0,0 +1,317 @@
+// Copyright 2013 Tad Glines
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+package authd
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"fmt"
+	"github.com/lann/go-pkgs/crypto/srp"
+	"io"
+	"log"
+	"math/big"
+	"net"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// DefaultTimeout is the default time allowed for a login.
+const DefaultTimeout = 30 * time.Second
+
+// Store looks up the verifier record of a user. Lookup returns a nil record
+// and a nil error for unknown users.
+type Store interface {
+	Lookup(username string) (*srp.VerifierRecord, error)
+}
+
+// FileStore is a Store backed by a file of verifier records in the format
+// read by srp.ReadVerifierRecords. Instances of FileStore are safe for
+// concurrent use.
+type FileStore struct {
+	Path    string
+	mu      sync.RWMutex
+	records map[string]*srp.VerifierRecord
+}
+
+// NewFileStore loads the records in path.
+func NewFileStore(path string) (*FileStore, error) {
+	fs := &FileStore{Path: path}
+	if err := fs.Reload(); err != nil {
+		return nil, err
+	}
+	return fs, nil
+}
+
+// Reload reads the file again. The current records are kept if it is invalid.
+func (fs *FileStore) Reload() error {
+	f, err := os.Open(fs.Path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	records, err := srp.ReadVerifierRecords(f)
+	if err != nil {
+		return fmt.Errorf("%s: %v", fs.Path, err)
+	}
+	fs.mu.Lock()
+	fs.records = records
+	fs.mu.Unlock()
+	return nil
+}
+
+// Lookup returns the record of the user.
+func (fs *FileStore) Lookup(username string) (*srp.VerifierRecord, error) {
+	fs.mu.RLock()
+	defer fs.mu.RUnlock()
+	return fs.records[username], nil
+}
+
+// Server runs handshakes for the services connecting to it. Group and Params
+// are used for the challenges sent for unknown users and should match those
+// of most records, or unknown users can be told apart by their parameters.
+//
+// If Puzzles is set, hellos are checked with it before any other work is
+// done. If PuzzleCapacity is also set, the difficulty is adjusted to the
+// number of logins in progress, reaching Puzzles.MaxDifficulty at
+// PuzzleCapacity logins.
+//
+// If Scheduler is set, the exponentiations of logins run on it, and logins
+// fail with an *srp.OverloadError when its queue is full.
+// Instances of Server are safe for concurrent use.
+type Server struct {
+	Store          Store
+	Group          string
+	Params         map[string]string
+	Timeout        time.Duration
+	Logger         *log.Logger // If nil nothing is logged
+	Puzzles        *srp.PuzzleIssuer
+	PuzzleCapacity int
+	Scheduler      *srp.Scheduler
+	secret         []byte
+	active         int32
+}
+
+// NewServer creates a Server for the records in store.
+func NewServer(store Store) *Server {
+	secret := make([]byte, 32)
+	if _, err := io.ReadFull(rand.Reader, secret); err != nil {
+		panic(err)
+	}
+	return &Server{
+		Store:   store,
+		Group:   "rfc5054.2048",
+		Timeout: DefaultTimeout,
+		secret:  secret,
+	}
+}
+
+// Serve accepts connections on l until it fails, which happens when l is
+// closed.
+func (s *Server) Serve(l net.Listener) error {
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			return err
+		}
+		go s.ServeConn(conn)
+	}
+}
+
+// ServeConn runs one login on conn and closes it.
+func (s *Server) ServeConn(conn net.Conn) {
+	defer conn.Close()
+	if s.Timeout > 0 {
+		conn.SetDeadline(time.Now().Add(s.Timeout))
+	}
+	active := atomic.AddInt32(&s.active, 1)
+	defer atomic.AddInt32(&s.active, -1)
+	if s.Puzzles != nil && s.PuzzleCapacity > 0 {
+		s.Puzzles.Adjust(float64(active) / float64(s.PuzzleCapacity))
+	}
+	username, err := s.login(conn)
+	if err != nil {
+		s.logf("%s: %v", username, err)
+		reply := &Reply{Status: StatusError, Data: []byte(err.Error())}
+		if err == ErrAuthenticationFailed {
+			reply = &Reply{Status: StatusFailed}
+		} else if perr, ok := err.(*PuzzleError); ok {
+			data, err := perr.Challenge.MarshalBinary()
+			if err == nil {
+				reply = &Reply{Status: StatusPuzzle, Data: data}
+			}
+		}
+		srp.WriteMessage(conn, reply)
+		return
+	}
+	s.logf("%s: authenticated", username)
+}
+
+func (s *Server) logf(format string, v ...interface{}) {
+	if s.Logger != nil {
+		s.Logger.Printf(format, v...)
+	}
+}
+
+func (s *Server) login(conn net.Conn) (string, error) {
+	hello := new(srp.ClientHello)
+	if err := srp.ReadMessage(conn, hello); err != nil {
+		return "", err
+	}
+	username := string(hello.Username)
+	if s.Puzzles != nil {
+		if err := s.Puzzles.Check(hello); err != nil {
+			c, ierr := s.Puzzles.Issue()
+			if ierr != nil {
+				return username, ierr
+			}
+			return username, &PuzzleError{Challenge: c, Err: err}
+		}
+	}
+	rec, err := s.Store.Lookup(username)
+	if err != nil {
+		return username, err
+	}
+	known := rec != nil
+	if !known {
+		s.logf("%s: unknown user", username)
+		if rec, err = s.unknownUser(hello.Username); err != nil {
+			return username, err
+		}
+	}
+
+	if hello.Offer != nil {
+		if err := hello.Offer.Allows(rec.Group, rec.Params); err != nil {
+			return username, err
+		}
+	}
+	ssrp, err := rec.NewSRP()
+	if err != nil {
+		return username, err
+	}
+	if err := hello.Validate(ssrp); err != nil {
+		return username, err
+	}
+	var ss *srp.ServerSession
+	var K []byte
+	err = s.compute(func() (err error) {
+		ss = ssrp.NewServerSession(rec.Username, rec.Salt, rec.Verifier)
+		if hello.A != nil {
+			K, err = ss.ComputeKey(hello.A)
+		}
+		return
+	})
+	if ss != nil {
+		defer ss.Destroy()
+	}
+	if err != nil {
+		return username, err
+	}
+	if hello.Offer != nil {
+		ss.BindNegotiation(hello.Offer, rec.Group, rec.Params)
+	}
+	challenge := &srp.ServerChallenge{
+		Salt:   rec.Salt,
+		B:      ss.GetB(),
+		Group:  rec.Group,
+		Params: rec.Params,
+	}
+	if hello.A == nil && hello.Offer == nil {
+		challenge.Prime = ssrp.Group.Prime.Bytes()
+		challenge.Generator = ssrp.Group.Generator.Bytes()
+	}
+	data, err := challenge.MarshalBinary()
+	if err != nil {
+		return username, err
+	}
+	if err := srp.WriteMessage(conn, &Reply{Status: StatusOK, Data: data}); err != nil {
+		return username, err
+	}
+
+	proof := new(srp.ClientProof)
+	if err := srp.ReadMessage(conn, proof); err != nil {
+		return username, err
+	}
+	if err := proof.Validate(ssrp); err != nil {
+		return username, err
+	}
+	if hello.A == nil {
+		// The client sends A once it knows the group.
+		if proof.A == nil {
+			return username, fmt.Errorf("Missing A in the proof")
+		}
+		err = s.compute(func() (err error) {
+			K, err = ss.ComputeKey(proof.A)
+			return
+		})
+		if err != nil {
+			return username, err
+		}
+	} else if proof.A != nil {
+		return username, fmt.Errorf("Unexpected A in the proof")
+	}
+	if !ss.VerifyClientAuthenticator(proof.M1) || !known {
+		return username, ErrAuthenticationFailed
+	}
+	result := &Result{
+		M2:  ss.ComputeAuthenticator(proof.M1),
+		Key: exportKey(K, hello.Username),
+	}
+	return username, srp.WriteMessage(conn, &Reply{Status: StatusOK, Data: result.marshal()})
+}
+
+// compute runs fn on the Scheduler, if there is one, allowing it to wait for
+// a worker for up to Timeout.
+func (s *Server) compute(fn func() error) error {
+	if s.Scheduler == nil {
+		return fn()
+	}
+	ctx := context.Background()
+	if s.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, s.Timeout)
+		defer cancel()
+	}
+	return s.Scheduler.Do(ctx, fn)
+}
+
+// unknownUser returns a record with a salt that is always the same for the
+// username and a random verifier.
+func (s *Server) unknownUser(username []byte) (*srp.VerifierRecord, error) {
+	ssrp, err := srp.NewSRPWithParams(s.Group, s.Params)
+	if err != nil {
+		return nil, err
+	}
+	mac := hmac.New(sha256.New, s.secret)
+	mac.Write(username)
+	salt := mac.Sum(nil)
+	if len(salt) > ssrp.SaltLength {
+		salt = salt[:ssrp.SaltLength]
+	}
+	v, err := rand.Int(rand.Reader, new(big.Int).Sub(ssrp.Group.Prime, big.NewInt(1)))
+	if err != nil {
+		return nil, err
+	}
+	return &srp.VerifierRecord{
+		Username: username,
+		Group:    s.Group,
+		Params:   s.Params,
+		Salt:     salt,
+		Verifier: v.Add(v, big.NewInt(1)).Bytes(),
+	}, nil
+}
@@ -0,0 +1,104 @@
+// Copyright 2013 Tad Glines
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+package srp
+
+/*
+	Values bound to a session, such as the negotiated parameters, are mixed
+	into both authenticators after they have been computed by the default
+	formulas or the Profile:
+
+		M' = H(M | bound)
+
+	where bound is, for each value in the order it was bound,
+
+		len(label) | label | len(value) | value
+
+	with the lengths as big endian uint32. Without bound values M' = M, so
+	sessions that bind nothing interoperate with other implementations.
+	M2 is computed from the M1 that was sent, which already includes the
+	bound values.
+
+	The labels are:
+
+		negotiation     the offer and the choice, see BindNegotiation
+		channel <type>  a channel binding, see BindChannel
+		data <name>     associated data, see BindAssociatedData
+*/
+
+import (
+	"encoding/binary"
+)
+
+func appendBound(bound []byte, label string, value []byte) []byte {
+	var l [4]byte
+	binary.BigEndian.PutUint32(l[:], uint32(len(label)))
+	bound = append(bound, l[:]...)
+	bound = append(bound, label...)
+	binary.BigEndian.PutUint32(l[:], uint32(len(value)))
+	bound = append(bound, l[:]...)
+	return append(bound, value...)
+}
+
+func (cs *ClientSession) bind(label string, value []byte) {
+	cs.bound = appendBound(cs.bound, label, value)
+	cs.transcript.add("bound "+label, value, false)
+}
+
+func (ss *ServerSession) bind(label string, value []byte) {
+	ss.bound = appendBound(ss.bound, label, value)
+	ss.transcript.add("bound "+label, value, false)
+}
+
+// bind_authenticator returns H(M | bound), or M if nothing is bound.
+func (s *SRP) bind_authenticator(M, bound []byte) []byte {
+	if len(bound) == 0 {
+		return M
+	}
+	h := s.HashFunc()
+	h.Write(M)
+	h.Write(bound)
+	return h.Sum(nil)
+}
+
+// BindChannel binds data identifying the channel the handshake runs over,
+// such as a TLS channel binding of type "tls-exporter" (see package
+// tlsbind), into the authenticators. Both sides must call it with the same
+// type before computing or verifying an authenticator; a man in the middle
+// relaying the handshake between two channels then makes it fail.
+func (cs *ClientSession) BindChannel(typ string, data []byte) {
+	cs.bind("channel "+typ, data)
+}
+
+// BindChannel binds data identifying the channel the handshake runs over
+// into the authenticators, see ClientSession.BindChannel.
+func (ss *ServerSession) BindChannel(typ string, data []byte) {
+	ss.bind("channel "+typ, data)
+}
+
+// BindAssociatedData binds data of the application, such as the requested
+// scope or the version of the client, into the authenticators under name.
+// A valid authenticator then proves that both sides used the same data.
+// Both sides must bind the same names and data in the same order before
+// computing or verifying an authenticator. The data are not secret: they
+// are recorded in the Transcript.
+func (cs *ClientSession) BindAssociatedData(name string, data []byte) {
+	cs.bind("data "+name, data)
+}
+
+// BindAssociatedData binds data of the application into the authenticators
+// under name, see ClientSession.BindAssociatedData.
+func (ss *ServerSession) BindAssociatedData(name string, data []byte) {
+	ss.bind("data "+name, data)
+}
@@ -0,0 +1,85 @@
+// Copyright 2013 Tad Glines
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+package srp
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"testing"
+)
+
+// boundHandshake runs a handshake in which client and server bind the
+// associated data cdata and sdata, given as name, value pairs.
+func boundHandshake(t *testing.T, cdata, sdata []string) (M1 []byte, ok bool) {
+	s, err := NewSRP("rfc5054.1024", sha256.New, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	salt, v, err := s.ComputeVerifier([]byte("password"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	cs := s.NewClientSession([]byte("test"), []byte("password"))
+	ss := s.NewServerSession([]byte("test"), salt, v)
+	for i := 0; i < len(cdata); i += 2 {
+		cs.BindAssociatedData(cdata[i], []byte(cdata[i+1]))
+	}
+	for i := 0; i < len(sdata); i += 2 {
+		ss.BindAssociatedData(sdata[i], []byte(sdata[i+1]))
+	}
+	if _, err := ss.ComputeKey(cs.GetA()); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := cs.ComputeKey(salt, ss.GetB()); err != nil {
+		t.Fatal(err)
+	}
+	M1 = cs.ComputeAuthenticator()
+	if !ss.VerifyClientAuthenticator(M1) {
+		return M1, false
+	}
+	if !cs.VerifyServerAuthenticator(ss.ComputeAuthenticator(M1)) {
+		t.Fatal("Server Authenticator is not valid")
+	}
+	// Without bound data M1 is the plain authenticator.
+	plain := s.ComputeClientAuthenticator(cs.proofValues(nil))
+	if bytes.Equal(plain, M1) != (len(cdata) == 0) {
+		t.Fatal("Unexpected binding of M1")
+	}
+	return M1, true
+}
+
+func TestBindAssociatedData(t *testing.T) {
+	data := []string{"scope", "read write", "device", "1234"}
+	if _, ok := boundHandshake(t, data, data); !ok {
+		t.Fatal("Expected the same associated data to be accepted")
+	}
+	if _, ok := boundHandshake(t, nil, nil); !ok {
+		t.Fatal("Expected a handshake without associated data to succeed")
+	}
+
+	for name, sdata := range map[string][]string{
+		"value":   {"scope", "admin", "device", "1234"},
+		"name":    {"scopes", "read write", "device", "1234"},
+		"order":   {"device", "1234", "scope", "read write"},
+		"missing": {"scope", "read write"},
+		"none":    nil,
+		"split":   {"scope", "read ", "write", "", "device", "1234"},
+		"join":    {"scoperead write", "", "device", "1234"},
+	} {
+		if _, ok := boundHandshake(t, data, sdata); ok {
+			t.Errorf("%s: expected different associated data to be rejected", name)
+		}
+	}
+}
@@ -0,0 +1,205 @@
+// Copyright 2013 Tad Glines
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+// Package cognito implements the client side of the AWS Cognito
+// USER_SRP_AUTH flow on top of srp.ClientSession.
+package cognito
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"github.com/lann/go-pkgs/crypto/srp"
+	"math/big"
+	"strings"
+	"time"
+)
+
+// GroupName is the name the Cognito group is registered under. Cognito uses
+// the 3072 bit prime from RFC5054 but with a generator of 2.
+const GroupName = "cognito.3072"
+
+// TimestampFormat is the layout of the TIMESTAMP challenge response.
+const TimestampFormat = "Mon Jan 2 15:04:05 UTC 2006"
+
+const derivedKeyInfo = "Caldera Derived Key"
+
+func init() {
+	grp, err := srp.GetGroup("rfc5054.3072")
+	if err != nil {
+		panic(err)
+	}
+	srp.RegisterGroup(GroupName, &srp.SRPGroup{
+		Size:      grp.Size,
+		Prime:     grp.Prime,
+		Generator: big.NewInt(2),
+	})
+	srp.RegisterProfile(Profile.Name, Profile)
+}
+
+// Profile reproduces the arithmetic used by Cognito. Values are hashed using
+// the "padHex" encoding of the Cognito SDKs (big endian, with a leading zero
+// byte if the high bit is set), and K is derived with HKDF.
+// ComputeX expects the username to be the pool name (the part of the pool id
+// after the underscore) followed by USER_ID_FOR_SRP.
+// Cognito does not use the M1 and M2 authenticators.
+var Profile = &srp.Profile{
+	Name: "cognito",
+	ComputeK: func(s *srp.SRP) *big.Int {
+		// k = H(PAD(N) | PAD(g))
+		h := s.HashFunc()
+		h.Write(padHex(s.Group.Prime))
+		h.Write(padHex(s.Group.Generator))
+		return new(big.Int).SetBytes(h.Sum(nil))
+	},
+	ComputeX: func(s *srp.SRP, username, salt, password []byte) *big.Int {
+		// x = H(PAD(s) | H(poolName | username | ":" | password))
+		h := s.HashFunc()
+		h.Write(username)
+		h.Write([]byte(":"))
+		h.Write(password)
+		up := h.Sum(nil)
+		h.Reset()
+		h.Write(padHex(new(big.Int).SetBytes(salt)))
+		h.Write(up)
+		return new(big.Int).SetBytes(h.Sum(nil))
+	},
+	ComputeU: func(s *srp.SRP, A, B *big.Int) *big.Int {
+		// u = H(PAD(A) | PAD(B))
+		h := s.HashFunc()
+		h.Write(padHex(A))
+		h.Write(padHex(B))
+		return new(big.Int).SetBytes(h.Sum(nil))
+	},
+	ComputeKey: func(s *srp.SRP, S, u *big.Int) []byte {
+		return hkdf(padHex(u), padHex(S), []byte(derivedKeyInfo))[:16]
+	},
+}
+
+// NewSRP returns an SRP configured for Cognito.
+func NewSRP() (*srp.SRP, error) {
+	s, err := srp.NewSRP(GroupName, sha256.New, nil)
+	if err != nil {
+		return nil, err
+	}
+	s.Profile = Profile
+	return s, nil
+}
+
+// Client computes the AuthParameters of an InitiateAuth request and the
+// ChallengeResponses to the PASSWORD_VERIFIER challenge that follows it.
+// A Client cannot be reused.
+type Client struct {
+	poolName string
+	username string
+	userID   string
+	cs       *srp.ClientSession
+}
+
+// NewClient creates a client for the user pool with the given id
+// (i.e. "us-east-1_XXXXXXXXX").
+func NewClient(poolID, username string, password []byte) (*Client, error) {
+	i := strings.IndexByte(poolID, '_')
+	if i < 0 {
+		return nil, fmt.Errorf("Invalid pool id: %s", poolID)
+	}
+	c := &Client{poolName: poolID[i+1:], username: username}
+
+	s, err := NewSRP()
+	if err != nil {
+		return nil, err
+	}
+	// x depends on USER_ID_FOR_SRP which is only known once the challenge
+	// has been received.
+	p := *Profile
+	p.ComputeX = func(s *srp.SRP, username, salt, password []byte) *big.Int {
+		return Profile.ComputeX(s, []byte(c.poolName+c.userID), salt, password)
+	}
+	s.Profile = &p
+
+	c.cs = s.NewClientSession([]byte(username), password)
+	return c, nil
+}
+
+// AuthParameters returns the USERNAME and SRP_A parameters for InitiateAuth.
+func (c *Client) AuthParameters() map[string]string {
+	return map[string]string{
+		"USERNAME": c.username,
+		"SRP_A":    new(big.Int).SetBytes(c.cs.GetA()).Text(16),
+	}
+}
+
+// ChallengeResponses computes the responses to a PASSWORD_VERIFIER challenge
+// from its ChallengeParameters. The signature is made over the given time.
+func (c *Client) ChallengeResponses(params map[string]string, now time.Time) (map[string]string, error) {
+	c.userID = params["USER_ID_FOR_SRP"]
+	if c.userID == "" {
+		return nil, fmt.Errorf("Missing USER_ID_FOR_SRP")
+	}
+	salt, ok := new(big.Int).SetString(params["SALT"], 16)
+	if !ok {
+		return nil, fmt.Errorf("Invalid SALT: %q", params["SALT"])
+	}
+	B, ok := new(big.Int).SetString(params["SRP_B"], 16)
+	if !ok {
+		return nil, fmt.Errorf("Invalid SRP_B: %q", params["SRP_B"])
+	}
+	block, err := base64.StdEncoding.DecodeString(params["SECRET_BLOCK"])
+	if err != nil {
+		return nil, fmt.Errorf("Invalid SECRET_BLOCK: %v", err)
+	}
+
+	key, err := c.cs.ComputeKey(salt.Bytes(), B.Bytes())
+	if err != nil {
+		return nil, err
+	}
+	// The key is only needed for the signature.
+	defer c.cs.Destroy()
+
+	timestamp := now.UTC().Format(TimestampFormat)
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(c.poolName))
+	mac.Write([]byte(c.userID))
+	mac.Write(block)
+	mac.Write([]byte(timestamp))
+
+	return map[string]string{
+		"USERNAME":                    c.userID,
+		"TIMESTAMP":                   timestamp,
+		"PASSWORD_CLAIM_SECRET_BLOCK": params["SECRET_BLOCK"],
+		"PASSWORD_CLAIM_SIGNATURE":    base64.StdEncoding.EncodeToString(mac.Sum(nil)),
+	}, nil
+}
+
+// padHex returns the big endian bytes of n with a leading zero byte added when
+// the high bit is set, matching the hex padding done by the Cognito SDKs.
+func padHex(n *big.Int) []byte {
+	b := n.Bytes()
+	if len(b) == 0 || b[0]&0x80 != 0 {
+		b = append([]byte{0}, b...)
+	}
+	return b
+}
+
+// hkdf returns the first block of HKDF-SHA256 output, which is all Cognito uses.
+func hkdf(salt, ikm, info []byte) []byte {
+	mac := hmac.New(sha256.New, salt)
+	mac.Write(ikm)
+	prk := mac.Sum(nil)
+	mac = hmac.New(sha256.New, prk)
+	mac.Write(info)
+	mac.Write([]byte{1})
+	return mac.Sum(nil)
+}
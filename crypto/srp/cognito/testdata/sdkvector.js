@@ -0,0 +1,77 @@
+// Copyright 2013 Tad Glines
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+// Computes the login values checked by TestSDKVector with the
+// AuthenticationHelper of amazon-cognito-identity-js, using fixed a and b:
+//
+//	npm install amazon-cognito-identity-js@6.3.12
+//	node sdkvector.js > sdkvector.json
+//
+// k, u, x and the key are computed by the SDK. The signature is computed as
+// in CognitoUser.authenticateUserDefaultAuth, which needs a user pool.
+
+const AuthenticationHelper = require('amazon-cognito-identity-js/lib/AuthenticationHelper').default;
+const BigInteger = require('amazon-cognito-identity-js/lib/BigInteger').default;
+const crypto = require('crypto');
+
+const poolID = 'us-east-1_TestPool';
+const poolName = poolID.split('_')[1];
+const userID = 'user';
+const password = 'P@ssw0rd';
+const salt = new BigInteger('00e9b3c1f2a4d6587b9c0d1e2f3a4b5c', 16);
+const secretBlock = Buffer.alloc(64, 0x5a).toString('base64');
+const timestamp = 'Tue Mar 7 05:04:03 UTC 2017';
+const a = new BigInteger('60975527035cf2ad1989806f0407210bc81edc04e2762a56afd529ddda2d4393', 16);
+const b = new BigInteger('e487cb59d31ac550471e81f00f6928e01dda08e974a004f49e61f5d105284d20', 16);
+
+const helper = new AuthenticationHelper(poolName);
+helper.smallAValue = a;
+helper.largeAValue = undefined;
+
+const x = new BigInteger(
+  helper.hexHash(helper.padHex(salt) + helper.hash(`${poolName}${userID}:${password}`)), 16);
+const v = helper.g.modPow(x, helper.N);
+const B = helper.k.multiply(v).add(helper.g.modPow(b, helper.N)).mod(helper.N);
+
+helper.getLargeAValue((err) => {
+  if (err) throw err;
+  helper.getPasswordAuthenticationKey(userID, password, B, salt, (err, key) => {
+    if (err) throw err;
+    const signature = crypto.createHmac('sha256', Buffer.from(key))
+      .update(Buffer.concat([
+        Buffer.from(poolName, 'utf8'),
+        Buffer.from(userID, 'utf8'),
+        Buffer.from(secretBlock, 'base64'),
+        Buffer.from(timestamp, 'utf8'),
+      ]))
+      .digest('base64');
+    const pkg = require('amazon-cognito-identity-js/package.json');
+    console.log(JSON.stringify({
+      sdk: `${pkg.name} ${pkg.version}`,
+      poolID,
+      userID,
+      password,
+      salt: salt.toString(16),
+      secretBlock,
+      timestamp,
+      a: a.toString(16),
+      B: B.toString(16),
+      k: helper.k.toString(16),
+      u: helper.UValue.toString(16),
+      x: x.toString(16),
+      key: Buffer.from(key).toString('hex'),
+      signature,
+    }, null, 2));
+  });
+});
@@ -0,0 +1,235 @@
+// Copyright 2013 Tad Glines
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+package srp
+
+import (
+	"bytes"
+	"fmt"
+	"math/big"
+	"sort"
+	"strings"
+)
+
+// diagnoseOrder lists the values of a transcript so that every value comes
+// after those it is computed from.
+var diagnoseOrder = []string{"N", "g", "username", "salt", "A", "B", "k", "u", "S", "K", "M1", "M2"}
+
+var diagnoseHints = map[string]string{
+	"N":        "The peer uses another group",
+	"g":        "The peer uses another group",
+	"username": "The username differs, check its case, normalization and encoding",
+	"salt":     "The salt differs, check how it is encoded (raw, hex, base64) and that leading zero bytes are kept",
+	"A":        "A was changed on its way to the server, check how it is encoded",
+	"B":        "B was changed on its way to the client, check how it is encoded",
+	"k":        "k is computed differently: RFC 5054 uses H(N | PAD(g)), SRP-6 uses 3, and some libraries do not pad g or hash hex strings",
+	"u":        "u is computed differently: check whether A and B are padded to the length of N before they are hashed",
+	"S":        "S differs although its inputs match: check how x is derived (the KDF and its parameters, whether the username is hashed into x as in H(s | H(I | \":\" | P)), and how the salt is encoded), and the computation of k * g^x and of the exponent a + u * x",
+	"v":        "The verifier was computed with another password or formula for x: the peer's S matches the verifier of its password computed with the listed formulas",
+	"K":        "K is derived differently from S: check whether S is padded, hashed, interleaved or used as is",
+	"M1":       "M1 is computed differently: check which values are hashed (H(N) xor H(g), H(I), s, A, B, K or S), and whether they are padded",
+	"M2":       "M2 is computed differently: check whether A, M1 and K or S are hashed, and whether they are padded",
+	"bound":    "The values bound to the sessions differ: check that both sides bind the same values in the same order",
+}
+
+// Diagnosis describes the first value where a transcript and a peer differ.
+type Diagnosis struct {
+	Name    string
+	Ours    *TranscriptValue
+	Theirs  []byte
+	Cause   string   // The likely cause
+	Matches []string // The formulas reproducing the peer's value, if any
+}
+
+func (d *Diagnosis) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "First divergent value: %s\n", d.Name)
+	fmt.Fprintf(&b, "  ours:   %s\n", d.Ours)
+	fmt.Fprintf(&b, "  theirs: %s\n", TranscriptValue{Name: d.Name, Value: d.Theirs})
+	fmt.Fprintf(&b, "Likely cause: %s", d.Cause)
+	if len(d.Matches) > 0 {
+		fmt.Fprintf(&b, "\nThe peer's value matches: %s", strings.Join(d.Matches, ", "))
+	}
+	return b.String()
+}
+
+// Diagnose compares the transcript of a failed handshake with the values
+// reported by the peer, named as in Transcript, and returns the first value
+// that differs, or nil if none does. Values missing on either side are
+// skipped; the peer's M1 or M2 defaults to the one received by this side.
+//
+// To find the likely cause, the peer's value is recomputed with the formulas
+// of the default SRP-6a computation and of each registered Profile, using
+// the values of the peer and those of the transcript that are not redacted.
+// Since transcripts hold neither x nor v, a difference in x shows as one in
+// S. If the peer reports its password and its private value, a or b, its S
+// is recomputed with the x of each formula, the default one with the default
+// KDF only.
+func Diagnose(t *Transcript, peer map[string][]byte) *Diagnosis {
+	values := make(map[string][]byte)
+	for _, v := range t.Values {
+		if v.Value != nil {
+			values[v.Name] = v.Value
+		}
+	}
+	for name, v := range peer {
+		values[name] = v
+	}
+	for _, name := range diagnoseOrder {
+		ours := t.Get(name)
+		theirs, ok := peer[name]
+		if !ok && (name == "M1" || name == "M2") {
+			if r := t.Get("received " + name); r != nil {
+				theirs, ok = r.Value, true
+			}
+		}
+		if ours == nil || ours.Value == nil || !ok || bytes.Equal(ours.Value, theirs) {
+			continue
+		}
+		values[name] = theirs
+		d := &Diagnosis{Name: name, Ours: ours, Theirs: theirs, Cause: diagnoseHints[name]}
+		if stripZeros(ours.Value, theirs) {
+			d.Cause = fmt.Sprintf("The values of %s only differ in leading zero bytes: one side pads %s to the length of N or drops its leading zeros", name, name)
+		}
+		d.Matches = t.formulasFor(name, theirs, values)
+		if name == "S" && len(d.Matches) > 0 {
+			d.Cause = diagnoseHints["v"]
+		}
+		if (name == "M1" || name == "M2") && t.bound() != nil && !hasBoundMatch(d.Matches) {
+			d.Cause = diagnoseHints["bound"]
+		}
+		return d
+	}
+	return nil
+}
+
+// hasBoundMatch reports whether a formula matches with the bound values.
+func hasBoundMatch(matches []string) bool {
+	for _, m := range matches {
+		if !strings.HasSuffix(m, " without bound values") {
+			return true
+		}
+	}
+	return false
+}
+
+// bound returns the values bound to the session, encoded as by bind.
+func (t *Transcript) bound() []byte {
+	var bound []byte
+	for _, v := range t.Values {
+		if strings.HasPrefix(v.Name, "bound ") {
+			bound = appendBound(bound, strings.TrimPrefix(v.Name, "bound "), v.Value)
+		}
+	}
+	return bound
+}
+
+// stripZeros returns true if a and b differ but are equal once leading zero
+// bytes are removed.
+func stripZeros(a, b []byte) bool {
+	return !bytes.Equal(a, b) && bytes.Equal(bytes.TrimLeft(a, "\x00"), bytes.TrimLeft(b, "\x00"))
+}
+
+// diagnoseProfiles returns the formulas tried by Diagnose by name.
+func diagnoseProfiles() map[string]*Profile {
+	profiles := map[string]*Profile{"default": nil}
+	for name, p := range srp_profiles {
+		profiles["profile "+name] = p
+	}
+	return profiles
+}
+
+// formulasFor returns the names of the formulas that compute value for name
+// from values.
+func (t *Transcript) formulasFor(name string, value []byte, values map[string][]byte) []string {
+	h, err := GetHash(t.Hash)
+	if err != nil {
+		return nil
+	}
+	integer := func(name string) (*big.Int, bool) {
+		v, ok := values[name]
+		return new(big.Int).SetBytes(v), ok
+	}
+	A, okA := integer("A")
+	B, okB := integer("B")
+	S, okS := integer("S")
+	u, okU := integer("u")
+	p := &ProofValues{Username: values["username"], Salt: values["salt"], A: A, B: B, S: S, K: values["K"], M1: values["M1"]}
+	// withX returns the peer's S computed with x, or nil without its
+	// private value.
+	withX := func(s *SRP, x *big.Int) []byte {
+		N, g := s.Group.Prime, s.Group.Generator
+		if b, ok := values["b"]; ok && t.Role == RoleClient && okA && okU {
+			// S = (A * v^u) ^ b
+			t := new(big.Int).Exp(new(big.Int).Exp(g, x, N), u, N)
+			t.Mul(t, A).Mod(t, N)
+			return t.Exp(t, new(big.Int).SetBytes(b), N).Bytes()
+		}
+		if a, ok := values["a"]; ok && t.Role == RoleServer && okB && okU {
+			// S = (B - k * g^x) ^ (a + u * x)
+			t := new(big.Int).Exp(g, x, N)
+			t.Mul(t, s.get_k()).Sub(B, t).Mod(t, N)
+			e := new(big.Int).Mul(u, x)
+			e.Add(e, new(big.Int).SetBytes(a))
+			return t.Exp(t, e, N).Bytes()
+		}
+		return nil
+	}
+	password := values["password"] != nil && values["salt"] != nil
+
+	bound := t.bound()
+	var matches []string
+	for fname, profile := range diagnoseProfiles() {
+		s, err := newSRP(t.Group, h, nil)
+		if err != nil {
+			return nil
+		}
+		s.Profile = profile
+		var got, unbound []byte
+		switch {
+		case name == "k":
+			got = s.get_k().Bytes()
+		case name == "S" && password:
+			got = withX(s, s.compute_x(values["username"], values["salt"], values["password"]))
+		case name == "u" && okA && okB:
+			got = s.compute_u(A, B).Bytes()
+		case name == "K" && okS && okU:
+			got = s.compute_key(S, u)
+		case name == "M1" && okA && okB && okS:
+			unbound = s.client_authenticator(p)
+			got = s.bind_authenticator(unbound, bound)
+		case name == "M2" && okA && okS && p.M1 != nil:
+			unbound = s.server_authenticator(p)
+			got = s.bind_authenticator(unbound, bound)
+		}
+		if got != nil && bytes.Equal(got, value) {
+			matches = append(matches, fname)
+		} else if bound != nil && bytes.Equal(unbound, value) {
+			matches = append(matches, fname+" without bound values")
+		}
+	}
+	if name == "S" && password {
+		// RFC 5054 with the username left out
+		s, err := newSRP(t.Group, h, nil)
+		if err != nil {
+			return nil
+		}
+		x := hashInt(s, values["salt"], identityHash(s, nil, values["password"]))
+		if bytes.Equal(withX(s, x), value) {
+			matches = append(matches, "x = H(s | H(\":\" | P))")
+		}
+	}
+	sort.Strings(matches)
+	return matches
+}
@@ -0,0 +1,167 @@
+// Copyright 2013 Tad Glines
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+package srp
+
+import (
+	"crypto/rand"
+	"encoding/json"
+	"math/big"
+	"sync"
+	"sync/atomic"
+)
+
+// EphemeralPool precomputes the private value b and g^b of ServerSessions in
+// background goroutines, which takes the exponentiation by g off the login
+// path. Each pair is handed out once. When the pool is empty, or after it is
+// closed, sessions compute their pair inline.
+//
+// A pool is tied to a group and a size of b. It may be shared by SRP
+// instances using the same group and ABSize; others, and those with their
+// own Rand, never take pairs from it.
+// Instances of EphemeralPool are safe for concurrent use.
+type EphemeralPool struct {
+	group  *SRPGroup
+	abSize uint
+	pairs  chan *ephemeral
+	quit   chan struct{}
+	wg     sync.WaitGroup
+	once   sync.Once
+	hits   uint64
+	misses uint64
+}
+
+type ephemeral struct {
+	b  *big.Int
+	gb []uint // g^b in Montgomery form
+}
+
+// EphemeralPoolStats reports how well a pool keeps up with demand.
+type EphemeralPoolStats struct {
+	Hits    uint64  `json:"hits"`   // Sessions that took a pair from the pool
+	Misses  uint64  `json:"misses"` // Sessions that computed their own pair
+	HitRate float64 `json:"hit_rate"`
+	Size    int     `json:"size"` // Pairs ready in the pool
+	Depth   int     `json:"depth"`
+}
+
+// NewEphemeralPool creates a pool holding up to depth pairs for the group
+// and size of b in bits, and starts workers goroutines filling it.
+// Close must be called to stop the goroutines.
+func NewEphemeralPool(group *SRPGroup, abSize uint, depth, workers int) *EphemeralPool {
+	if workers < 1 {
+		workers = 1
+	}
+	p := &EphemeralPool{
+		group:  group,
+		abSize: abSize,
+		pairs:  make(chan *ephemeral, depth),
+		quit:   make(chan struct{}),
+	}
+	p.wg.Add(workers)
+	for i := 0; i < workers; i++ {
+		go p.fill()
+	}
+	return p
+}
+
+// StartEphemeralPool creates a pool for the group and ABSize of s, see
+// NewEphemeralPool, and sets it as s.Pool. ABSize must not be changed
+// afterwards.
+func (s *SRP) StartEphemeralPool(depth, workers int) *EphemeralPool {
+	s.Pool = NewEphemeralPool(s.Group, s.ABSize, depth, workers)
+	return s.Pool
+}
+
+func (p *EphemeralPool) fill() {
+	defer p.wg.Done()
+	for {
+		select {
+		case <-p.quit:
+			return
+		default:
+		}
+		e := p.compute()
+		select {
+		case p.pairs <- e:
+		case <-p.quit:
+			e.wipe()
+			return
+		}
+	}
+}
+
+func (p *EphemeralPool) compute() *ephemeral {
+	b := randBits(rand.Reader, p.abSize)
+	return &ephemeral{b: b, gb: p.group.expMont(b, int(p.abSize))}
+}
+
+// get returns a pair for s, from the pool if there is one ready.
+func (p *EphemeralPool) get(s *SRP) *ephemeral {
+	if p != nil && p.group == s.Group && p.abSize == s.ABSize && s.Rand == nil {
+		select {
+		case e := <-p.pairs:
+			atomic.AddUint64(&p.hits, 1)
+			return e
+		default:
+		}
+		atomic.AddUint64(&p.misses, 1)
+	}
+	b := s.gen_rand_ab()
+	return &ephemeral{b: b, gb: s.Group.expMont(b, int(s.ABSize))}
+}
+
+// Stats returns the current statistics of the pool.
+func (p *EphemeralPool) Stats() EphemeralPoolStats {
+	st := EphemeralPoolStats{
+		Hits:   atomic.LoadUint64(&p.hits),
+		Misses: atomic.LoadUint64(&p.misses),
+		Size:   len(p.pairs),
+		Depth:  cap(p.pairs),
+	}
+	if n := st.Hits + st.Misses; n > 0 {
+		st.HitRate = float64(st.Hits) / float64(n)
+	}
+	return st
+}
+
+// String returns the statistics of the pool as JSON, so that the pool can
+// be published with expvar.
+func (p *EphemeralPool) String() string {
+	data, _ := json.Marshal(p.Stats())
+	return string(data)
+}
+
+// Close stops the workers and wipes the pairs left in the pool. Sessions
+// created afterwards compute their pairs inline. Close may be called more
+// than once.
+func (p *EphemeralPool) Close() {
+	p.once.Do(func() {
+		close(p.quit)
+		p.wg.Wait()
+		for {
+			select {
+			case e := <-p.pairs:
+				e.wipe()
+			default:
+				return
+			}
+		}
+	})
+}
+
+func (e *ephemeral) wipe() {
+	wipeInt(e.b)
+	wipeLimbs(e.gb)
+}
@@ -0,0 +1,153 @@
+// Copyright 2013 Tad Glines
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+package srp
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"math/big"
+	"sync"
+	"testing"
+	"time"
+)
+
+// waitFull waits for the workers of p to fill it.
+func waitFull(t *testing.T, p *EphemeralPool) {
+	for i := 0; p.Stats().Size < p.Stats().Depth; i++ {
+		if i == 1000 {
+			t.Fatalf("Pool not filled: %v", p)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestEphemeralPool(t *testing.T) {
+	srp, err := NewSRP("rfc5054.1024", sha256.New, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := srp.StartEphemeralPool(4, 2)
+	defer p.Close()
+	waitFull(t, p)
+
+	username, password := []byte("test"), []byte("password")
+	salt, v, err := srp.ComputeVerifier(password)
+	if err != nil {
+		t.Fatal(err)
+	}
+	seen := make(map[string]bool)
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ss := srp.NewServerSession(username, salt, v)
+			cs := srp.NewClientSession(username, password)
+			if _, err := ss.ComputeKey(cs.GetA()); err != nil {
+				t.Error(err)
+				return
+			}
+			if _, err := cs.ComputeKey(salt, ss.GetB()); err != nil {
+				t.Error(err)
+				return
+			}
+			if !ss.VerifyClientAuthenticator(cs.ComputeAuthenticator()) {
+				t.Error("Client Authenticator is not valid")
+			}
+			mu.Lock()
+			seen[string(ss._b.Bytes())] = true
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+	if len(seen) != 8 {
+		t.Fatalf("Expected 8 distinct values of b, got %d", len(seen))
+	}
+	st := p.Stats()
+	if st.Hits < 4 || st.Hits+st.Misses != 8 || st.Depth != 4 {
+		t.Fatalf("Unexpected stats: %+v", st)
+	}
+	var js EphemeralPoolStats
+	if err := json.Unmarshal([]byte(p.String()), &js); err != nil || js.Hits+js.Misses != 8 {
+		t.Fatalf("Unexpected JSON stats: %s", p.String())
+	}
+}
+
+func TestEphemeralPoolMismatch(t *testing.T) {
+	srp, err := NewSRP("rfc5054.1024", sha256.New, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := srp.StartEphemeralPool(1, 1)
+	defer p.Close()
+	waitFull(t, p)
+
+	// A pair computed for another size of b must not be used.
+	srp.ABSize = 128
+	srp.NewServerSession([]byte("test"), []byte{1}, []byte{2})
+	if st := p.Stats(); st.Hits != 0 || st.Misses != 0 || st.Size != 1 {
+		t.Fatalf("Unexpected stats: %+v", st)
+	}
+}
+
+func TestEphemeralPoolClose(t *testing.T) {
+	srp, err := NewSRP("rfc5054.1024", sha256.New, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// A pool without workers, so that its content is known.
+	p := &EphemeralPool{
+		group:  srp.Group,
+		abSize: srp.ABSize,
+		pairs:  make(chan *ephemeral, 2),
+		quit:   make(chan struct{}),
+	}
+	srp.Pool = p
+	var pairs []*ephemeral
+	var limbs [][]big.Word
+	for i := 0; i < 2; i++ {
+		e := p.compute()
+		pairs = append(pairs, e)
+		limbs = append(limbs, limbsOf(e.b))
+		p.pairs <- e
+	}
+
+	p.Close()
+	p.Close()
+	for i, e := range pairs {
+		if !isZeroInt(limbs[i]) || !isZeroLimbs(e.gb) {
+			t.Fatal("Pair left in the pool was not wiped")
+		}
+	}
+	if st := p.Stats(); st.Size != 0 {
+		t.Fatalf("Pool not drained: %+v", st)
+	}
+
+	// Sessions still work once the pool is closed.
+	ss := srp.NewServerSession([]byte("test"), []byte{1}, []byte{2})
+	if len(ss.GetB()) == 0 || p.Stats().Misses != 1 {
+		t.Fatalf("Unexpected session or stats after Close: %+v", p.Stats())
+	}
+}
+
+func isZeroLimbs(x []uint) bool {
+	for _, v := range x {
+		if v != 0 {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,55 @@
+// Copyright 2013 Tad Glines
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+package srp
+
+// The formulas used by sessions, honoring SRP.Profile. They are exported for
+// tools that produce test vectors and for tests that play a misbehaving
+// peer; sessions are the only safe way to run a handshake.
+
+import (
+	"math/big"
+)
+
+// ComputeK returns the multiplier k.
+func (s *SRP) ComputeK() *big.Int {
+	return new(big.Int).Set(s.get_k())
+}
+
+// ComputeX returns the private key x derived from the password.
+func (s *SRP) ComputeX(username, salt, password []byte) *big.Int {
+	return s.compute_x(username, salt, password)
+}
+
+// ComputeU returns the scrambling parameter u.
+func (s *SRP) ComputeU(A, B *big.Int) *big.Int {
+	return s.compute_u(A, B)
+}
+
+// ComputeSessionKey returns the session key K derived from the premaster
+// secret S.
+func (s *SRP) ComputeSessionKey(S, u *big.Int) []byte {
+	return s.compute_key(S, u)
+}
+
+// ComputeClientAuthenticator returns M1 for the values in p.
+func (s *SRP) ComputeClientAuthenticator(p *ProofValues) []byte {
+	return s.client_authenticator(p)
+}
+
+// ComputeServerAuthenticator returns M2 for the values in p, where p.M1 is
+// the client authenticator.
+func (s *SRP) ComputeServerAuthenticator(p *ProofValues) []byte {
+	return s.server_authenticator(p)
+}
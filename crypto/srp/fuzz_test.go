@@ -0,0 +1,312 @@
+// Copyright 2013 Tad Glines
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+package srp
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"math/big"
+	"strings"
+	"testing"
+)
+
+// fuzzSRP returns an SRP context that is cheap enough to fuzz with, using
+// profile unless it is empty.
+func fuzzSRP(t testing.TB, profile string) *SRP {
+	s, err := NewSRP("rfc5054.1024", sha256.New, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if profile != "" {
+		if s.Profile, err = GetProfile(profile); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return s
+}
+
+// addPublicValueSeeds adds the values of A or B that are interesting for the
+// group of s: 0, 1, N-1, N, 2N and values too large for the group.
+func addPublicValueSeeds(f *testing.F, s *SRP, add func(v []byte)) {
+	N := s.Group.Prime
+	one := big.NewInt(1)
+	for _, v := range []*big.Int{
+		new(big.Int),
+		one,
+		new(big.Int).Sub(N, one),
+		N,
+		new(big.Int).Add(N, one),
+		new(big.Int).Lsh(N, 1),
+		new(big.Int).Lsh(N, 8*MaxMessageSize/16),
+	} {
+		add(v.Bytes())
+	}
+	add(nil)
+	add(make([]byte, s.Group.Size/8))
+	add(bytes.Repeat([]byte{0xff}, 2*s.Group.Size/8))
+}
+
+// inRange reports whether v is the encoding of a value in [1, N-1] that is
+// no longer than N.
+func inRange(s *SRP, v []byte) bool {
+	x := new(big.Int).SetBytes(v)
+	return len(v) <= len(s.Group.Prime.Bytes()) && x.Sign() > 0 && x.Cmp(s.Group.Prime) < 0
+}
+
+// profileNames are the profiles fuzzed in addition to the default formulas.
+var profileNames = []string{"", "pysrp", "thinbus", "srp6", "srp3"}
+
+func FuzzServerComputeKey(f *testing.F) {
+	s := fuzzSRP(f, "")
+	salt, v, err := s.ComputeVerifier([]byte("password"))
+	if err != nil {
+		f.Fatal(err)
+	}
+	addPublicValueSeeds(f, s, func(A []byte) {
+		f.Add(A, uint8(0))
+	})
+	f.Fuzz(func(t *testing.T, A []byte, profile uint8) {
+		s := fuzzSRP(t, profileNames[int(profile)%len(profileNames)])
+		ss := s.NewServerSession([]byte("test"), salt, v)
+		K, err := ss.ComputeKey(A)
+		if err == nil && !inRange(s, A) {
+			t.Fatalf("A out of range was accepted: %x", A)
+		}
+		if err == nil && len(K) == 0 {
+			t.Fatal("Empty key")
+		}
+		// Nobody knows the password, so any authenticator must be refused.
+		if ss.VerifyClientAuthenticator(A) {
+			t.Fatal("Client authenticator accepted")
+		}
+	})
+}
+
+func FuzzClientComputeKey(f *testing.F) {
+	s := fuzzSRP(f, "")
+	addPublicValueSeeds(f, s, func(B []byte) {
+		f.Add([]byte("salt"), B, uint8(0))
+	})
+	f.Fuzz(func(t *testing.T, salt, B []byte, profile uint8) {
+		s := fuzzSRP(t, profileNames[int(profile)%len(profileNames)])
+		cs := s.NewClientSession([]byte("test"), []byte("password"))
+		K, err := cs.ComputeKey(salt, B)
+		if err == nil && !inRange(s, B) {
+			t.Fatalf("B out of range was accepted: %x", B)
+		}
+		if err == nil && (len(salt) == 0 || len(salt) > s.MaxSaltLength) {
+			t.Fatalf("Salt of %d bytes was accepted", len(salt))
+		}
+		if err == nil && len(K) == 0 {
+			t.Fatal("Empty key")
+		}
+		if err != nil {
+			// A client that ignores the error must not be convinced
+			// by a server authenticator anyone can compute.
+			for _, M := range [][]byte{nil, B, s.server_authenticator(cs.proofValues(nil))} {
+				if cs.VerifyServerAuthenticator(M) {
+					t.Fatalf("Server authenticator %x accepted after %v", M, err)
+				}
+			}
+		}
+	})
+}
+
+func FuzzVerifyAuthenticator(f *testing.F) {
+	s := fuzzSRP(f, "")
+	salt, v, err := s.ComputeVerifier([]byte("password"))
+	if err != nil {
+		f.Fatal(err)
+	}
+	cs := s.NewClientSession([]byte("test"), []byte("password"))
+	ss := s.NewServerSession([]byte("test"), salt, v)
+	if _, err := ss.ComputeKey(cs.GetA()); err != nil {
+		f.Fatal(err)
+	}
+	if _, err := cs.ComputeKey(salt, ss.GetB()); err != nil {
+		f.Fatal(err)
+	}
+	M1 := cs.ComputeAuthenticator()
+	M2 := ss.ComputeAuthenticator(M1)
+	f.Add(M1)
+	f.Add(M2)
+	f.Add([]byte{})
+	f.Add(M1[:len(M1)-1])
+	f.Add(append(append([]byte{}, M1...), 0))
+	f.Fuzz(func(t *testing.T, M []byte) {
+		if ss.VerifyClientAuthenticator(M) != bytes.Equal(M, M1) {
+			t.Fatalf("Client authenticator %x: wrong result", M)
+		}
+		if cs.VerifyServerAuthenticator(M) != bytes.Equal(M, M2) {
+			t.Fatalf("Server authenticator %x: wrong result", M)
+		}
+	})
+}
+
+// parseFuzzParams splits "k=v,k=v" into a map.
+func parseFuzzParams(s string) map[string]string {
+	if s == "" {
+		return nil
+	}
+	params := make(map[string]string)
+	for _, kv := range strings.Split(s, ",") {
+		k, v, _ := strings.Cut(kv, "=")
+		params[k] = v
+	}
+	return params
+}
+
+func FuzzParams(f *testing.F) {
+	for _, group := range GroupNames() {
+		f.Add(group, "")
+	}
+	f.Add("rfc5054.1024", "hash=sha1,kdf=pbkdf2,iter=1")
+	f.Add("rfc5054.1024", "kdf=pbkdf2,iter=-1")
+	f.Add("rfc5054.1024", "kdf=pbkdf2,iter=99999999999999999999")
+	f.Add("rfc5054.1024", "kdf=scrypt,N=2,r=1,p=1")
+	f.Add("rfc5054.1024", "kdf=scrypt,N=1099511627776,r=8,p=1")
+	f.Add("rfc5054.1024", "kdf=scrypt,N=1024,r=1073741824,p=1")
+	f.Add("rfc5054.1024", "profile=pysrp")
+	f.Add("rfc5054.1024", "profile=unknown")
+	f.Add("unknown", "")
+	f.Add("", "=")
+	f.Fuzz(func(t *testing.T, group, params string) {
+		p := parseFuzzParams(params)
+		s, err := NewSRPWithParams(group, p)
+		if err != nil {
+			return
+		}
+		if s.Group == nil || s.HashFunc == nil {
+			t.Fatal("Incomplete SRP context")
+		}
+		// The parameters a server sends must be usable by the client.
+		m := &ServerChallenge{Salt: []byte{1}, B: []byte{2}, Group: group, Params: p}
+		data, err := m.MarshalBinary()
+		if err != nil {
+			return
+		}
+		m2 := new(ServerChallenge)
+		if err := m2.UnmarshalBinary(data); err != nil {
+			t.Fatal(err)
+		}
+		if err := m2.Validate(s); err != nil {
+			t.Fatal(err)
+		}
+		if p[ParamKDF] == "scrypt" {
+			N, _ := intParam(p, ParamScryptN, DefaultScryptN)
+			r, _ := intParam(p, ParamScryptR, DefaultScryptR)
+			if uint64(N)*uint64(r)*128 > MaxScryptMemory {
+				t.Fatalf("scrypt parameters above MaxScryptMemory accepted: %v", p)
+			}
+		}
+		// Keep the cost of each input bounded.
+		if p[ParamKDF] == "" || p[ParamKDF] == "default" {
+			if _, _, err := s.ComputeVerifier([]byte("password")); err != nil {
+				t.Fatal(err)
+			}
+		}
+	})
+}
+
+// canonical checks that data, once decoded by m, encodes back to itself.
+func canonical(t *testing.T, data []byte, m message) {
+	if err := m.UnmarshalBinary(data); err != nil {
+		return
+	}
+	out, err := m.MarshalBinary()
+	if err != nil {
+		t.Fatalf("%T decoded from %x cannot be encoded: %v", m, data, err)
+	}
+	if !bytes.Equal(out, data) {
+		t.Fatalf("%T decoded from %x encodes to %x", m, data, out)
+	}
+}
+
+func FuzzMessages(f *testing.F) {
+	s := fuzzSRP(f, "")
+	N := s.Group.Prime.Bytes()
+	for _, m := range []message{
+		&ClientHello{Username: []byte("test"), A: N},
+		&ClientHello{Username: []byte("test"), A: []byte{0}, Puzzle: &PuzzleSolution{
+			PuzzleChallenge: PuzzleChallenge{Seed: []byte{1}, Difficulty: 8, Expires: 1, MAC: []byte{2}},
+			Nonce:           []byte{3},
+		}},
+		&ServerChallenge{Salt: []byte{1}, B: N, Group: "rfc5054.1024", Params: map[string]string{"a": "1", "b": ""}},
+		&ServerChallenge{Salt: []byte{1}, B: N, Group: "rfc5054.1024", Prime: N, Generator: []byte{2}},
+		&ClientHello{Username: []byte("test"), Offer: &Offer{Groups: []string{"rfc5054.1024"}, KDFs: []string{"pbkdf2"}}},
+		&ClientProof{M1: make([]byte, 32)},
+		&ClientProof{M1: make([]byte, 32), A: N},
+		&ServerProof{},
+		&PuzzleChallenge{Seed: make([]byte, 16), Difficulty: 255, Expires: -1},
+		&VerifierRecord{Username: []byte("test"), Group: "rfc5054.1024", Salt: []byte{1}, Verifier: N},
+	} {
+		data, err := m.MarshalBinary()
+		if err != nil {
+			f.Fatal(err)
+		}
+		f.Add(data)
+	}
+	f.Add([]byte{})
+	f.Add([]byte{MessageVersion, msgClientHello, 0xff, 0xff})
+	f.Add([]byte{MessageVersion, msgServerChallenge, 0, 0, 0, 0, 0, 0, 0xff, 0xff})
+	f.Fuzz(func(t *testing.T, data []byte) {
+		for _, m := range []message{
+			new(ClientHello),
+			new(ServerChallenge),
+			new(ClientProof),
+			new(ServerProof),
+			new(PuzzleChallenge),
+			new(VerifierRecord),
+		} {
+			canonical(t, data, m)
+		}
+		hello := new(ClientHello)
+		if hello.UnmarshalBinary(data) == nil {
+			hello.Validate(s)
+		}
+		challenge := new(ServerChallenge)
+		if challenge.UnmarshalBinary(data) == nil {
+			challenge.Validate(s)
+		}
+		rec := new(VerifierRecord)
+		if rec.UnmarshalBinary(data) == nil && rec.Params[ParamKDF] == "" {
+			rec.Validate()
+		}
+
+		var framed bytes.Buffer
+		framed.Write([]byte{0, 0, byte(len(data) >> 8), byte(len(data))})
+		framed.Write(data)
+		ReadMessage(&framed, new(ClientHello))
+		ReadMessage(bytes.NewReader(data), new(ClientHello))
+	})
+}
+
+func FuzzParseVerifierRecord(f *testing.F) {
+	f.Add(`{"username":"dGVzdA==","group":"rfc5054.1024","salt":"AQ==","verifier":"Ag=="}`)
+	f.Add(`{"username":"dGVzdA==","group":"rfc5054.1024","params":{"kdf":"scrypt","N":"3"},"salt":"AQ==","verifier":"Ag=="}`)
+	f.Add(`AQUABHRlc3QADHJmYzUwNTQuMTAyNAAAAAEBAAEC`)
+	f.Add(`{`)
+	f.Add(``)
+	f.Fuzz(func(t *testing.T, line string) {
+		rec, err := ParseVerifierRecord(line)
+		if err != nil {
+			return
+		}
+		if rec.Params[ParamKDF] == "" {
+			rec.Validate()
+		}
+		ReadVerifierRecords(strings.NewReader(line))
+	})
+}
@@ -0,0 +1,358 @@
+// Copyright 2013 Tad Glines
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+package srp
+
+/*
+	A Guard limits online password guessing. When SRP.Guard is set,
+	ServerSession.ComputeKey asks the guard whether a login for the username
+	from ServerSession.RemoteAddr may proceed, and VerifyClientAuthenticator
+	reports its result to the guard.
+
+	BackoffGuard tracks failures separately per username and per address.
+	After n consecutive failures logins are refused for
+	min(BaseDelay * 2^(n-1), MaxDelay), and once n reaches LockoutThreshold
+	for LockoutDuration. Its state is kept in a GuardStore, which can be
+	backed by a database shared between servers.
+
+	A login allowed by Check is in progress until Failure or Success is
+	called for it. At most MaxPending logins may be in progress per username
+	and per address, counted in the same Store.Update that checks the delay,
+	so sessions opened at the same time can make only that many guesses
+	before the first failure starts the delay. A login in progress is not a
+	failure and does not delay the other users of an address. A session
+	that is abandoned after ComputeKey makes no guess, and its login is
+	forgotten after PendingTimeout.
+*/
+
+import (
+	"fmt"
+	"net"
+	"sync"
+	"time"
+)
+
+const (
+	DefaultBaseDelay        = time.Second
+	DefaultMaxDelay         = 5 * time.Minute
+	DefaultLockoutThreshold = 10
+	DefaultLockoutDuration  = time.Hour
+	DefaultResetAfter       = 24 * time.Hour
+	DefaultMaxPending       = 4
+	DefaultPendingTimeout   = time.Minute
+)
+
+// Guard decides whether logins may proceed and is told of their outcome.
+// addr is empty when the address of the client is not known.
+// Implementations must be safe for concurrent use.
+type Guard interface {
+	Check(username, addr string) error
+	Failure(username, addr string) error
+	Success(username, addr string) error
+}
+
+// GuardError is returned by a Guard that refuses a login.
+type GuardError struct {
+	Key    string    // The limited store key, see GuardStore
+	Until  time.Time // When logins will be allowed again
+	Locked bool      // Set if the lockout threshold was reached
+	Busy   bool      // Set if too many logins were in progress
+}
+
+func (e *GuardError) Error() string {
+	if e.Busy {
+		return fmt.Sprintf("Too many logins in progress for %s, retry after %s", e.Key, e.Until.Format(time.RFC3339))
+	}
+	if e.Locked {
+		return fmt.Sprintf("Too many failed logins for %s, locked until %s", e.Key, e.Until.Format(time.RFC3339))
+	}
+	return fmt.Sprintf("Too many failed logins for %s, retry after %s", e.Key, e.Until.Format(time.RFC3339))
+}
+
+// GuardState is the failure history of a username or address.
+type GuardState struct {
+	Failures int       // Consecutive failures
+	Last     time.Time // Time of the last failure
+	Until    time.Time // Logins are refused until this time
+	Pending  int       // Logins allowed by Check and not yet reported
+	Started  time.Time // Time of the last login allowed by Check
+}
+
+// GuardStore holds the GuardStates of a BackoffGuard. Keys are of the form
+// "user:<username>" or "addr:<ip>". A missing key has the zero GuardState.
+// Implementations must be safe for concurrent use.
+type GuardStore interface {
+	Load(key string) (GuardState, error)
+	// Update atomically replaces the state of key with the result of fn.
+	// now is the time of the guard, for stores that expire states. fn may
+	// be called more than once.
+	Update(key string, now time.Time, fn func(GuardState) GuardState) error
+	Delete(key string) error
+}
+
+// BackoffGuard is a Guard applying exponential backoff and lockout per
+// username and per address. Usernames in AllowUsers are never limited by
+// username, and clients with addresses in AllowNets are never limited.
+// The fields must not be changed once the guard is in use.
+type BackoffGuard struct {
+	Store            GuardStore
+	BaseDelay        time.Duration
+	MaxDelay         time.Duration
+	LockoutThreshold int           // 0 disables lockout
+	LockoutDuration  time.Duration //
+	ResetAfter       time.Duration // Failures older than this are forgotten
+	MaxPending       int           // 0 allows any number of logins in progress
+	PendingTimeout   time.Duration // Logins in progress are forgotten after this
+	AllowUsers       map[string]bool
+	AllowNets        []*net.IPNet
+	Now              func() time.Time // Defaults to time.Now
+}
+
+// NewBackoffGuard creates a BackoffGuard with the default settings.
+func NewBackoffGuard(store GuardStore) *BackoffGuard {
+	return &BackoffGuard{
+		Store:            store,
+		BaseDelay:        DefaultBaseDelay,
+		MaxDelay:         DefaultMaxDelay,
+		LockoutThreshold: DefaultLockoutThreshold,
+		LockoutDuration:  DefaultLockoutDuration,
+		ResetAfter:       DefaultResetAfter,
+		MaxPending:       DefaultMaxPending,
+		PendingTimeout:   DefaultPendingTimeout,
+	}
+}
+
+// Check returns a *GuardError if the username or the address is limited, or
+// has MaxPending logins in progress. Otherwise the login is in progress for
+// both until Failure or Success is called for it.
+func (g *BackoffGuard) Check(username, addr string) error {
+	now := g.now()
+	var started []string
+	for _, key := range g.keys(username, addr) {
+		var gerr *GuardError
+		err := g.Store.Update(key, now, func(st GuardState) GuardState {
+			gerr = nil
+			if now.Before(st.Until) {
+				gerr = &GuardError{
+					Key:    key,
+					Until:  st.Until,
+					Locked: g.LockoutThreshold > 0 && st.Failures >= g.LockoutThreshold,
+				}
+				return st
+			}
+			st = g.expirePending(st, now)
+			if g.MaxPending > 0 && st.Pending >= g.MaxPending {
+				gerr = &GuardError{Key: key, Until: st.Started.Add(g.PendingTimeout), Busy: true}
+				return st
+			}
+			st.Pending++
+			st.Started = now
+			return st
+		})
+		if err == nil && gerr != nil {
+			err = gerr
+		}
+		if err != nil {
+			// Undo the logins started for the other keys, leaving any
+			// concurrent changes to them in place.
+			for _, k := range started {
+				g.Store.Update(k, now, g.release)
+			}
+			return err
+		}
+		started = append(started, key)
+	}
+	return nil
+}
+
+// Failure ends a login in progress and counts it as a failure of the
+// username and the address.
+func (g *BackoffGuard) Failure(username, addr string) error {
+	now := g.now()
+	for _, key := range g.keys(username, addr) {
+		err := g.Store.Update(key, now, func(st GuardState) GuardState {
+			return g.fail(g.release(st), now)
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Success ends a login in progress and forgets the failures of the username.
+// Failures of the address are kept, since one address may be guessing the
+// passwords of many users.
+func (g *BackoffGuard) Success(username, addr string) error {
+	now := g.now()
+	for _, key := range g.keys(username, addr) {
+		user := key == "user:"+username
+		err := g.Store.Update(key, now, func(st GuardState) GuardState {
+			st = g.release(st)
+			if user {
+				st.Failures = 0
+				st.Until = time.Time{}
+			}
+			return st
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// release returns st with one login less in progress.
+func (g *BackoffGuard) release(st GuardState) GuardState {
+	if st.Pending > 0 {
+		st.Pending--
+	}
+	return st
+}
+
+// expirePending returns st without the logins in progress if none was
+// started within PendingTimeout.
+func (g *BackoffGuard) expirePending(st GuardState, now time.Time) GuardState {
+	if g.PendingTimeout > 0 && now.Sub(st.Started) >= g.PendingTimeout {
+		st.Pending = 0
+	}
+	return st
+}
+
+// fail returns st with one more failure at now.
+func (g *BackoffGuard) fail(st GuardState, now time.Time) GuardState {
+	if g.ResetAfter > 0 && now.Sub(st.Last) > g.ResetAfter {
+		st.Failures = 0
+	}
+	st.Failures++
+	st.Last = now
+	st.Until = now.Add(g.delay(st.Failures))
+	return st
+}
+
+func (g *BackoffGuard) delay(failures int) time.Duration {
+	if g.LockoutThreshold > 0 && failures >= g.LockoutThreshold {
+		return g.LockoutDuration
+	}
+	d := g.BaseDelay
+	for i := 1; i < failures && d < g.MaxDelay; i++ {
+		d *= 2
+	}
+	if d > g.MaxDelay {
+		d = g.MaxDelay
+	}
+	return d
+}
+
+// keys returns the store keys that apply to a login.
+func (g *BackoffGuard) keys(username, addr string) []string {
+	if g.allowedAddr(addr) {
+		return nil
+	}
+	var keys []string
+	if !g.AllowUsers[username] {
+		keys = append(keys, "user:"+username)
+	}
+	if ip := hostIP(addr); ip != nil {
+		keys = append(keys, "addr:"+ip.String())
+	}
+	return keys
+}
+
+func (g *BackoffGuard) allowedAddr(addr string) bool {
+	ip := hostIP(addr)
+	if ip == nil {
+		return false
+	}
+	for _, n := range g.AllowNets {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+func (g *BackoffGuard) now() time.Time {
+	if g.Now != nil {
+		return g.Now()
+	}
+	return time.Now()
+}
+
+// hostIP returns the IP of an address with or without a port, or nil.
+func hostIP(addr string) net.IP {
+	if host, _, err := net.SplitHostPort(addr); err == nil {
+		addr = host
+	}
+	return net.ParseIP(addr)
+}
+
+// MemoryGuardStore is a GuardStore for a single server. States that have not
+// changed for Expire are removed when the store grows, so that addresses
+// seen once do not use memory forever.
+type MemoryGuardStore struct {
+	Expire time.Duration
+	mu     sync.Mutex
+	states map[string]GuardState
+	limit  int
+}
+
+// NewMemoryGuardStore creates a MemoryGuardStore that expires states after
+// DefaultResetAfter.
+func NewMemoryGuardStore() *MemoryGuardStore {
+	return &MemoryGuardStore{
+		Expire: DefaultResetAfter,
+		states: make(map[string]GuardState),
+		limit:  1024,
+	}
+}
+
+// Load returns the state of key.
+func (m *MemoryGuardStore) Load(key string) (GuardState, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.states[key], nil
+}
+
+// Update replaces the state of key with the result of fn.
+func (m *MemoryGuardStore) Update(key string, now time.Time, fn func(GuardState) GuardState) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.states[key] = fn(m.states[key])
+	if len(m.states) > m.limit {
+		m.expire(now)
+		// Sweep again once the store has doubled in size.
+		m.limit = 2 * len(m.states)
+		if m.limit < 1024 {
+			m.limit = 1024
+		}
+	}
+	return nil
+}
+
+// Delete removes the state of key.
+func (m *MemoryGuardStore) Delete(key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.states, key)
+	return nil
+}
+
+func (m *MemoryGuardStore) expire(now time.Time) {
+	for key, st := range m.states {
+		if now.After(st.Until) && now.Sub(st.Last) > m.Expire && now.Sub(st.Started) > m.Expire {
+			delete(m.states, key)
+		}
+	}
+}
@@ -0,0 +1,255 @@
+// Copyright 2013 Tad Glines
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+package srp
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"net"
+	"testing"
+	"time"
+)
+
+type testClock struct {
+	t time.Time
+}
+
+func (c *testClock) now() time.Time {
+	return c.t
+}
+
+func newTestGuard() (*BackoffGuard, *testClock) {
+	clock := &testClock{time.Date(2013, 1, 1, 0, 0, 0, 0, time.UTC)}
+	g := NewBackoffGuard(NewMemoryGuardStore())
+	g.LockoutThreshold = 5
+	g.Now = clock.now
+	return g, clock
+}
+
+func TestBackoffGuard(t *testing.T) {
+	g, clock := newTestGuard()
+	addr := "192.0.2.1:1234"
+	fail := func(username, addr string) {
+		if err := g.Check(username, addr); err != nil {
+			t.Fatal(err)
+		}
+		g.Failure(username, addr)
+	}
+
+	// The delays double: 1s, 2s, 4s, 8s, then the lockout.
+	for i, delay := range []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 8 * time.Second} {
+		fail("test", addr)
+		err, ok := g.Check("test", addr).(*GuardError)
+		if !ok || err.Locked || !err.Until.Equal(clock.t.Add(delay)) {
+			t.Fatalf("Failure %d: expected a delay of %v, got %v", i+1, delay, err)
+		}
+		clock.t = clock.t.Add(delay)
+	}
+	fail("test", addr)
+	err, ok := g.Check("test", "").(*GuardError)
+	if !ok || !err.Locked || err.Key != "user:test" {
+		t.Fatalf("Expected the user to be locked out, got %v", err)
+	}
+	// The address is limited for other users too.
+	if err, ok := g.Check("other", addr).(*GuardError); !ok || err.Key != "addr:192.0.2.1" {
+		t.Fatalf("Expected the address to be limited, got %v", err)
+	}
+	clock.t = clock.t.Add(DefaultLockoutDuration)
+
+	// A success clears the username but not the address.
+	if err := g.Check("test", addr); err != nil {
+		t.Fatal(err)
+	}
+	g.Success("test", addr)
+	if err := g.Check("test", "192.0.2.2"); err != nil {
+		t.Fatal(err)
+	}
+	// The next failure from the address locks it out again.
+	fail("other", addr)
+	if err, ok := g.Check("third", addr).(*GuardError); !ok || !err.Locked || err.Key != "addr:192.0.2.1" {
+		t.Fatalf("Expected the address to be locked out, got %v", err)
+	}
+
+	// Old failures are forgotten.
+	clock.t = clock.t.Add(DefaultResetAfter + time.Minute)
+	fail("new", "")
+	st, _ := g.Store.Load("user:new")
+	clock.t = clock.t.Add(time.Second)
+	fail("new", "")
+	clock.t = clock.t.Add(DefaultResetAfter + time.Minute)
+	fail("new", "")
+	if st2, _ := g.Store.Load("user:new"); st.Failures != 1 || st2.Failures != 1 {
+		t.Fatalf("Expected failures to be reset, got %d", st2.Failures)
+	}
+}
+
+func TestBackoffGuardConcurrent(t *testing.T) {
+	g, clock := newTestGuard()
+	g.MaxPending = 2
+	addr := "192.0.2.1:1234"
+	for _, l := range [][2]string{{"test", addr}, {"other", addr}, {"test", "192.0.2.2"}} {
+		if err := g.Check(l[0], l[1]); err != nil {
+			t.Fatalf("Expected a concurrent login to be allowed: %v", err)
+		}
+	}
+	// Once MaxPending logins for the username or from the address are in
+	// progress, others are refused.
+	if err, ok := g.Check("test", "192.0.2.3").(*GuardError); !ok || !err.Busy || err.Key != "user:test" {
+		t.Fatalf("Expected a concurrent login for the user to be refused, got %v", err)
+	}
+	if err, ok := g.Check("third", addr).(*GuardError); !ok || !err.Busy || err.Key != "addr:192.0.2.1" {
+		t.Fatalf("Expected a concurrent login from the address to be refused, got %v", err)
+	}
+	// The refused login was undone for the other keys.
+	if st, _ := g.Store.Load("user:third"); st.Pending != 0 {
+		t.Fatalf("Expected no logins in progress for the other user, got %d", st.Pending)
+	}
+	if st, _ := g.Store.Load("addr:192.0.2.3"); st.Pending != 0 {
+		t.Fatalf("Expected no logins in progress for the other address, got %d", st.Pending)
+	}
+
+	g.Success("test", addr)
+	if err := g.Check("third", addr); err != nil {
+		t.Fatalf("Expected the success to release the address: %v", err)
+	}
+	// Logins in progress are not failures.
+	if st, _ := g.Store.Load("addr:192.0.2.1"); st.Failures != 0 {
+		t.Fatalf("Expected no failures for the address, got %d", st.Failures)
+	}
+
+	// Abandoned logins are forgotten.
+	clock.t = clock.t.Add(g.PendingTimeout)
+	if err := g.Check("test", "192.0.2.3"); err != nil {
+		t.Fatalf("Expected abandoned logins to expire: %v", err)
+	}
+}
+
+func TestBackoffGuardAllowLists(t *testing.T) {
+	g, _ := newTestGuard()
+	_, n, _ := net.ParseCIDR("10.0.0.0/8")
+	g.AllowNets = []*net.IPNet{n}
+	g.AllowUsers = map[string]bool{"service": true}
+
+	for i := 0; i < 10; i++ {
+		g.Failure("test", "10.1.2.3:5000")
+		g.Failure("service", "192.0.2.1")
+	}
+	if err := g.Check("test", "10.1.2.3:5000"); err != nil {
+		t.Fatalf("Expected an allowed network to be exempt: %v", err)
+	}
+	if err := g.Check("service", "192.0.2.2"); err != nil {
+		t.Fatalf("Expected an allowed user to be exempt: %v", err)
+	}
+	if g.Check("service", "192.0.2.1") == nil {
+		t.Fatal("Expected the address of an allowed user to be limited")
+	}
+}
+
+func TestGuardedServerSession(t *testing.T) {
+	s, err := NewSRP("rfc5054.1024", sha256.New, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	g, clock := newTestGuard()
+	s.Guard = g
+	username := []byte("test")
+	salt, v, err := s.ComputeVerifier([]byte("password"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	login := func(password string) (bool, error) {
+		cs := s.NewClientSession(username, []byte(password))
+		ss := s.NewServerSession(username, salt, v)
+		ss.RemoteAddr = "192.0.2.1:1234"
+		if _, err := ss.ComputeKey(cs.GetA()); err != nil {
+			return false, err
+		}
+		if _, err := cs.ComputeKey(salt, ss.GetB()); err != nil {
+			return false, err
+		}
+		return ss.VerifyClientAuthenticator(cs.ComputeAuthenticator()), nil
+	}
+
+	if ok, err := login("password"); !ok || err != nil {
+		t.Fatalf("Expected the login to succeed, got %v, %v", ok, err)
+	}
+	// The success released the login, so the next one may proceed at once.
+	if ok, err := login("wrong"); ok || err != nil {
+		t.Fatalf("Expected the wrong password to fail, got %v, %v", ok, err)
+	}
+	// The failure was recorded, so the next login is refused before any
+	// exponentiation.
+	if _, err := login("password"); err == nil {
+		t.Fatal("Expected the login to be refused")
+	} else if _, ok := err.(*GuardError); !ok {
+		t.Fatalf("Expected a *GuardError, got %T", err)
+	}
+	clock.t = clock.t.Add(time.Second)
+
+	// Sessions opened at the same time can make at most MaxPending guesses.
+	cs := s.NewClientSession(username, []byte("wrong"))
+	for i := 0; i <= g.MaxPending; i++ {
+		ss := s.NewServerSession(username, salt, v)
+		ss.RemoteAddr = "192.0.2.1:1234"
+		_, err := ss.ComputeKey(cs.GetA())
+		if _, ok := err.(*GuardError); ok != (i == g.MaxPending) {
+			t.Fatalf("Session %d: unexpected result %v", i, err)
+		}
+	}
+}
+
+func TestGuardedServerSessionInvalidInput(t *testing.T) {
+	s, err := NewSRP("rfc5054.1024", sha256.New, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	g, _ := newTestGuard()
+	store := NewMemoryGuardStore()
+	g.Store = store
+	s.Guard = g
+
+	// Rejected input is not counted by the guard and never becomes a key.
+	long := make([]byte, s.MaxUsernameLength+1)
+	for _, c := range []struct{ username, A []byte }{{[]byte("test"), []byte{0}}, {long, []byte{2}}} {
+		ss := s.NewServerSession(c.username, []byte("salt"), []byte{1})
+		ss.RemoteAddr = "192.0.2.1"
+		if _, err := ss.ComputeKey(c.A); err == nil {
+			t.Fatal("Expected the input to be rejected")
+		} else if _, ok := err.(*InputError); !ok {
+			t.Fatalf("Expected an *InputError, got %v", err)
+		}
+	}
+	if len(store.states) != 0 {
+		t.Fatalf("Expected the guard not to be called, got %v", store.states)
+	}
+}
+
+func TestMemoryGuardStoreExpiry(t *testing.T) {
+	m := NewMemoryGuardStore()
+	now := time.Date(2013, 1, 1, 0, 0, 0, 0, time.UTC)
+	old := GuardState{Failures: 1, Last: now.Add(-2 * m.Expire)}
+	for i := 0; i < 1025; i++ {
+		m.Update(fmt.Sprint(i), now, func(GuardState) GuardState { return old })
+	}
+	m.Update("new", now, func(st GuardState) GuardState {
+		st.Failures++
+		st.Last = now
+		return st
+	})
+	if len(m.states) != 1 {
+		t.Fatalf("Expected expired states to be removed, %d left", len(m.states))
+	}
+}
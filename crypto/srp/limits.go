@@ -0,0 +1,95 @@
+// Copyright 2013 Tad Glines
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+package srp
+
+/*
+	Values received from the other party are checked before any arithmetic
+	is done with them:
+
+		A, B       1 <= v <= N-1, at most as many bytes as N, and either
+		           without leading zero bytes or padded with zeros to
+		           exactly the length of N as done by PAD() in RFC 5054
+		username   1 to SRP.MaxUsernameLength bytes
+		salt       1 to SRP.MaxSaltLength bytes
+
+	Failures are reported as an *InputError.
+*/
+
+import (
+	"fmt"
+	"math/big"
+)
+
+const (
+	DefaultMaxUsernameLength = 1024
+	DefaultMaxSaltLength     = 256
+)
+
+// Reasons of an InputError.
+const (
+	ReasonEmpty        = "empty"
+	ReasonTooLong      = "too long"
+	ReasonOutOfRange   = "out of range"
+	ReasonNotCanonical = "not canonically encoded"
+)
+
+// InputError is returned when a value received from the other party is
+// rejected.
+type InputError struct {
+	Name   string // A, B, username or salt
+	Reason string // One of the Reason constants
+	Length int    // Length of the value in bytes
+}
+
+func (e *InputError) Error() string {
+	return fmt.Sprintf("Invalid %s (%d bytes): %s", e.Name, e.Length, e.Reason)
+}
+
+// checkPublicValue checks A or B and returns its value.
+func (s *SRP) checkPublicValue(name string, v []byte) (*big.Int, error) {
+	N := s.Group.Prime
+	size := (N.BitLen() + 7) / 8
+	switch {
+	case len(v) == 0:
+		return nil, &InputError{name, ReasonEmpty, 0}
+	case len(v) > size:
+		return nil, &InputError{name, ReasonTooLong, len(v)}
+	case v[0] == 0 && len(v) != size:
+		return nil, &InputError{name, ReasonNotCanonical, len(v)}
+	}
+	x := new(big.Int).SetBytes(v)
+	if x.Sign() == 0 || x.Cmp(N) >= 0 {
+		return nil, &InputError{name, ReasonOutOfRange, len(v)}
+	}
+	return x, nil
+}
+
+func (s *SRP) checkUsername(username []byte) error {
+	return checkLength("username", username, s.MaxUsernameLength)
+}
+
+func (s *SRP) checkSalt(salt []byte) error {
+	return checkLength("salt", salt, s.MaxSaltLength)
+}
+
+func checkLength(name string, v []byte, max int) error {
+	if len(v) == 0 {
+		return &InputError{name, ReasonEmpty, 0}
+	}
+	if max > 0 && len(v) > max {
+		return &InputError{name, ReasonTooLong, len(v)}
+	}
+	return nil
+}
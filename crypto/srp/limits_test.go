@@ -0,0 +1,122 @@
+// Copyright 2013 Tad Glines
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+package srp
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"math/big"
+	"testing"
+)
+
+func TestCheckPublicValue(t *testing.T) {
+	srp, err := NewSRP("rfc5054.1024", sha256.New, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	N := srp.Group.Prime
+	one := big.NewInt(1)
+	Nm1 := new(big.Int).Sub(N, one).Bytes()
+
+	cases := []struct {
+		v      []byte
+		reason string
+	}{
+		{nil, ReasonEmpty},
+		{[]byte{0}, ReasonNotCanonical},
+		{[]byte{0, 1}, ReasonNotCanonical},
+		{make([]byte, len(Nm1)), ReasonOutOfRange},
+		{N.Bytes(), ReasonOutOfRange},
+		{new(big.Int).Add(N, one).Bytes(), ReasonOutOfRange},
+		{new(big.Int).Lsh(N, 1).Bytes(), ReasonTooLong},
+		{append([]byte{0}, Nm1...), ReasonTooLong},
+		{[]byte{1}, ""},
+		{Nm1, ""},
+		// Padded to the length of N like PAD() in RFC 5054.
+		{append(make([]byte, len(Nm1)-1), 2), ""},
+	}
+	for _, c := range cases {
+		for _, name := range []string{"A", "B"} {
+			_, err := srp.checkPublicValue(name, c.v)
+			if c.reason == "" {
+				if err != nil {
+					t.Errorf("%s=%x: %v", name, c.v, err)
+				}
+				continue
+			}
+			ierr, ok := err.(*InputError)
+			if !ok || ierr.Name != name || ierr.Reason != c.reason || ierr.Length != len(c.v) {
+				t.Errorf("%s=%x: expected %q, got %v", name, c.v, c.reason, err)
+			}
+		}
+	}
+}
+
+func TestSessionLimits(t *testing.T) {
+	srp, err := NewSRP("rfc5054.1024", sha256.New, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	password := []byte("password")
+	salt, v, err := srp.ComputeVerifier(password)
+	if err != nil {
+		t.Fatal(err)
+	}
+	long := bytes.Repeat([]byte{'x'}, DefaultMaxUsernameLength+1)
+
+	// The server checks the username sent by the client.
+	cs := srp.NewClientSession(long, password)
+	ss := srp.NewServerSession(long, salt, v)
+	_, err = ss.ComputeKey(cs.GetA())
+	if ierr, ok := err.(*InputError); !ok || ierr.Name != "username" || ierr.Reason != ReasonTooLong {
+		t.Fatalf("Expected a long username to be rejected, got %v", err)
+	}
+	if ss.VerifyClientAuthenticator(nil) {
+		t.Fatal("Rejected session was authenticated")
+	}
+
+	// The client checks the salt sent by the server.
+	cs = srp.NewClientSession([]byte("test"), password)
+	ss = srp.NewServerSession([]byte("test"), salt, v)
+	_, err = cs.ComputeKey(make([]byte, DefaultMaxSaltLength+1), ss.GetB())
+	if ierr, ok := err.(*InputError); !ok || ierr.Name != "salt" || ierr.Reason != ReasonTooLong {
+		t.Fatalf("Expected a long salt to be rejected, got %v", err)
+	}
+	_, err = cs.ComputeKey(nil, ss.GetB())
+	if ierr, ok := err.(*InputError); !ok || ierr.Name != "salt" || ierr.Reason != ReasonEmpty {
+		t.Fatalf("Expected an empty salt to be rejected, got %v", err)
+	}
+
+	// 0 removes the limits.
+	srp.MaxUsernameLength, srp.MaxSaltLength = 0, 0
+	cs = srp.NewClientSession(long, password)
+	ss = srp.NewServerSession(long, salt, v)
+	if _, err := ss.ComputeKey(cs.GetA()); err != nil {
+		t.Fatal(err)
+	}
+	longSalt := make([]byte, DefaultMaxSaltLength+1)
+	if _, err := cs.ComputeKey(longSalt, ss.GetB()); err != nil {
+		t.Fatal(err)
+	}
+
+	// Messages are checked the same way.
+	srp.MaxUsernameLength, srp.MaxSaltLength = 4, 4
+	if err := (&ClientHello{Username: []byte("tests"), A: cs.GetA()}).Validate(srp); err == nil {
+		t.Error("Expected a long username to be rejected")
+	}
+	if err := (&ServerChallenge{Salt: longSalt[:5], B: ss.GetB(), Group: "rfc5054.1024"}).Validate(srp); err == nil {
+		t.Error("Expected a long salt to be rejected")
+	}
+}
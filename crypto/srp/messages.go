@@ -0,0 +1,487 @@
+// Copyright 2013 Tad Glines
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+package srp
+
+/*
+	Messages exchanged during an SRP handshake:
+
+		client                            server
+		ClientHello{I, A}         ->
+		                          <-      ServerChallenge{s, B, group, params}
+		ClientProof{M1}           ->
+		                          <-      ServerProof{M2}
+
+	A server requiring client puzzles may answer a ClientHello with a
+	PuzzleChallenge, see PuzzleIssuer. A client that does not know the
+	group sends an Offer instead of A, and A with M1, see Offer. A client
+	sending neither gets N and g in the ServerChallenge, see
+	GroupAllowList.
+
+	The binary encoding of a message is:
+
+		version (1 byte) | type (1 byte) | fields
+
+	where each field is a big endian uint16 length followed by that many
+	bytes. Params are encoded as a uint16 count followed by that many
+	key/value field pairs, sorted by key. Trailing data is rejected.
+	The puzzle solution of a ClientHello is encoded after A as the fields
+	seed, difficulty (1 byte), expires (8 bytes), mac and nonce, and is
+	omitted if there is none. The offer follows as params with the keys
+	groups, hashes, kdfs and profiles, each a comma separated list; if
+	there is no puzzle solution it is preceded by an empty field. The A of
+	a ClientProof is a field after M1, and N and g of a ServerChallenge are
+	two fields after the params; they are omitted if there are none.
+	These optional fields were added in version 2. Messages of version 1
+	are still decoded, but must not carry them.
+
+	The JSON encoding uses the field names below, with byte fields encoded as
+	base64 strings.
+
+	On a stream, WriteMessage and ReadMessage frame each encoded message with
+	a big endian uint32 length.
+*/
+
+import (
+	"bytes"
+	"encoding"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math/big"
+	"sort"
+)
+
+// MessageVersion is the version of the binary message encoding. It must be
+// increased whenever the layout of a message changes.
+const MessageVersion = 2
+
+const (
+	msgClientHello     = 1
+	msgServerChallenge = 2
+	msgClientProof     = 3
+	msgServerProof     = 4
+	msgVerifierRecord  = 5
+	msgPuzzleChallenge = 6
+	msgNegotiation     = 7 // Only hashed, see BindNegotiation
+)
+
+const maxFieldLength = 0xffff
+
+// MaxMessageSize is the largest message accepted by ReadMessage.
+const MaxMessageSize = 1 << 20
+
+// ClientHello is sent by the client to start a handshake.
+// If Offer is set, A is empty and sent in the ClientProof instead.
+type ClientHello struct {
+	Username []byte          `json:"username"`
+	A        []byte          `json:"A,omitempty"`
+	Puzzle   *PuzzleSolution `json:"puzzle,omitempty"`
+	Offer    *Offer          `json:"offer,omitempty"`
+}
+
+// ServerChallenge is the server's reply to a ClientHello. Group is the name
+// of a registered group and Params holds any other values that the client
+// needs, such as the names of the hash and the profile. Prime and Generator
+// are sent to a client whose hello has neither A nor an Offer.
+type ServerChallenge struct {
+	Salt      []byte            `json:"salt"`
+	B         []byte            `json:"B"`
+	Group     string            `json:"group"`
+	Params    map[string]string `json:"params,omitempty"`
+	Prime     []byte            `json:"N,omitempty"`
+	Generator []byte            `json:"g,omitempty"`
+}
+
+// ClientProof carries the client authenticator M1, and A if the client
+// sent an Offer.
+type ClientProof struct {
+	M1 []byte `json:"M1"`
+	A  []byte `json:"A,omitempty"`
+}
+
+// ServerProof carries the server authenticator M2.
+type ServerProof struct {
+	M2 []byte `json:"M2"`
+}
+
+// MarshalBinary encodes the message using the binary encoding.
+func (m *ClientHello) MarshalBinary() ([]byte, error) {
+	w := newMsgWriter(msgClientHello)
+	w.field(m.Username)
+	w.field(m.A)
+	if m.Puzzle != nil {
+		if len(m.Puzzle.Seed) == 0 {
+			return nil, fmt.Errorf("Empty puzzle seed")
+		}
+		m.Puzzle.writeFields(w)
+		w.field(m.Puzzle.Nonce)
+	} else if m.Offer != nil {
+		w.field(nil)
+	}
+	if m.Offer != nil {
+		if err := m.Offer.validate(); err != nil {
+			return nil, err
+		}
+		w.params(m.Offer.params())
+	}
+	return w.bytes()
+}
+
+// UnmarshalBinary decodes a message in the binary encoding.
+func (m *ClientHello) UnmarshalBinary(data []byte) error {
+	r := newMsgReader(data, msgClientHello)
+	m.Username = r.field()
+	m.A = r.field()
+	if len(m.A) == 0 {
+		m.A = nil
+	}
+	m.Puzzle = nil
+	m.Offer = nil
+	offer := r.skipEmpty()
+	if !offer && r.optional() {
+		m.Puzzle = new(PuzzleSolution)
+		m.Puzzle.readFields(r)
+		m.Puzzle.Nonce = r.field()
+	}
+	if offer || r.optional() {
+		params := r.params()
+		if r.err != nil {
+			return r.err
+		}
+		var err error
+		if m.Offer, err = parseOffer(params); err != nil {
+			return err
+		}
+		if err := m.Offer.validate(); err != nil {
+			return err
+		}
+	}
+	return r.done()
+}
+
+// Validate checks the username and A, see InputError. A hello with an Offer
+// must not have an A. A hello without an A asks for N and g, and the A is
+// checked with the ClientProof.
+func (m *ClientHello) Validate(s *SRP) error {
+	if err := s.checkUsername(m.Username); err != nil {
+		return err
+	}
+	if m.Offer != nil {
+		if m.A != nil {
+			return fmt.Errorf("Unexpected A with an offer")
+		}
+		return m.Offer.validate()
+	}
+	if m.A == nil {
+		return nil
+	}
+	_, err := s.checkPublicValue("A", m.A)
+	return err
+}
+
+// MarshalBinary encodes the message using the binary encoding.
+func (m *ServerChallenge) MarshalBinary() ([]byte, error) {
+	w := newMsgWriter(msgServerChallenge)
+	w.field(m.Salt)
+	w.field(m.B)
+	w.field([]byte(m.Group))
+	w.params(m.Params)
+	if len(m.Prime) != 0 || len(m.Generator) != 0 {
+		if len(m.Prime) == 0 || len(m.Generator) == 0 {
+			return nil, fmt.Errorf("Incomplete group parameters")
+		}
+		w.field(m.Prime)
+		w.field(m.Generator)
+	}
+	return w.bytes()
+}
+
+// UnmarshalBinary decodes a message in the binary encoding.
+func (m *ServerChallenge) UnmarshalBinary(data []byte) error {
+	r := newMsgReader(data, msgServerChallenge)
+	m.Salt = r.field()
+	m.B = r.field()
+	m.Group = string(r.field())
+	m.Params = r.params()
+	m.Prime, m.Generator = nil, nil
+	if r.optional() {
+		m.Prime = r.field()
+		m.Generator = r.field()
+		if r.err == nil && (len(m.Prime) == 0 || len(m.Generator) == 0) {
+			return fmt.Errorf("Incomplete group parameters")
+		}
+	}
+	return r.done()
+}
+
+// Validate checks that the group of the challenge is the one used by s and
+// checks the salt and B, see InputError. If the challenge has N and g, they
+// are compared instead of the name of the group, which the client may not
+// know.
+func (m *ServerChallenge) Validate(s *SRP) error {
+	if m.Prime != nil {
+		p, g := new(big.Int).SetBytes(m.Prime), new(big.Int).SetBytes(m.Generator)
+		if p.Cmp(s.Group.Prime) != 0 || g.Cmp(s.Group.Generator) != 0 {
+			return fmt.Errorf("Unexpected group parameters for %s", m.Group)
+		}
+	} else {
+		grp, err := GetGroup(m.Group)
+		if err != nil {
+			return err
+		}
+		if grp.Prime.Cmp(s.Group.Prime) != 0 || grp.Generator.Cmp(s.Group.Generator) != 0 {
+			return fmt.Errorf("Unexpected group: %s", m.Group)
+		}
+	}
+	if err := s.checkSalt(m.Salt); err != nil {
+		return err
+	}
+	_, err := s.checkPublicValue("B", m.B)
+	return err
+}
+
+// MarshalBinary encodes the message using the binary encoding.
+func (m *ClientProof) MarshalBinary() ([]byte, error) {
+	w := newMsgWriter(msgClientProof)
+	w.field(m.M1)
+	if len(m.A) != 0 {
+		w.field(m.A)
+	}
+	return w.bytes()
+}
+
+// UnmarshalBinary decodes a message in the binary encoding.
+func (m *ClientProof) UnmarshalBinary(data []byte) error {
+	r := newMsgReader(data, msgClientProof)
+	m.M1 = r.field()
+	m.A = nil
+	if r.optional() {
+		if m.A = r.field(); r.err == nil && len(m.A) == 0 {
+			return fmt.Errorf("Empty A")
+		}
+	}
+	return r.done()
+}
+
+// Validate checks that M1 is the size of the hash used by s, and checks A if
+// there is one, see InputError.
+func (m *ClientProof) Validate(s *SRP) error {
+	if m.A != nil {
+		if _, err := s.checkPublicValue("A", m.A); err != nil {
+			return err
+		}
+	}
+	return s.validateAuthenticator("M1", m.M1)
+}
+
+// MarshalBinary encodes the message using the binary encoding.
+func (m *ServerProof) MarshalBinary() ([]byte, error) {
+	w := newMsgWriter(msgServerProof)
+	w.field(m.M2)
+	return w.bytes()
+}
+
+// UnmarshalBinary decodes a message in the binary encoding.
+func (m *ServerProof) UnmarshalBinary(data []byte) error {
+	r := newMsgReader(data, msgServerProof)
+	m.M2 = r.field()
+	return r.done()
+}
+
+// Validate checks that M2 is the size of the hash used by s.
+func (m *ServerProof) Validate(s *SRP) error {
+	return s.validateAuthenticator("M2", m.M2)
+}
+
+// WriteMessage writes the binary encoding of m to w, preceded by its length.
+func WriteMessage(w io.Writer, m encoding.BinaryMarshaler) error {
+	data, err := m.MarshalBinary()
+	if err != nil {
+		return err
+	}
+	buf := make([]byte, 4+len(data))
+	binary.BigEndian.PutUint32(buf, uint32(len(data)))
+	copy(buf[4:], data)
+	_, err = w.Write(buf)
+	return err
+}
+
+// ReadMessage reads a message written by WriteMessage from r into m.
+func ReadMessage(r io.Reader, m encoding.BinaryUnmarshaler) error {
+	var l [4]byte
+	if _, err := io.ReadFull(r, l[:]); err != nil {
+		return err
+	}
+	n := binary.BigEndian.Uint32(l[:])
+	if n > MaxMessageSize {
+		return fmt.Errorf("Message too long: %d bytes", n)
+	}
+	data := make([]byte, n)
+	if _, err := io.ReadFull(r, data); err != nil {
+		return err
+	}
+	return m.UnmarshalBinary(data)
+}
+
+func (s *SRP) validateAuthenticator(name string, M []byte) error {
+	if len(M) != s.HashFunc().Size() {
+		return fmt.Errorf("Invalid %s length: %d", name, len(M))
+	}
+	return nil
+}
+
+type msgWriter struct {
+	buf bytes.Buffer
+	err error
+}
+
+func newMsgWriter(typ byte) *msgWriter {
+	w := new(msgWriter)
+	w.buf.WriteByte(MessageVersion)
+	w.buf.WriteByte(typ)
+	return w
+}
+
+func (w *msgWriter) field(data []byte) {
+	if len(data) > maxFieldLength {
+		w.err = fmt.Errorf("Field too long: %d bytes", len(data))
+		return
+	}
+	var l [2]byte
+	binary.BigEndian.PutUint16(l[:], uint16(len(data)))
+	w.buf.Write(l[:])
+	w.buf.Write(data)
+}
+
+func (w *msgWriter) params(params map[string]string) {
+	keys := make([]string, 0, len(params))
+	for k := range params {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	if len(keys) > maxFieldLength {
+		w.err = fmt.Errorf("Too many params: %d", len(keys))
+		return
+	}
+	var l [2]byte
+	binary.BigEndian.PutUint16(l[:], uint16(len(keys)))
+	w.buf.Write(l[:])
+	for _, k := range keys {
+		w.field([]byte(k))
+		w.field([]byte(params[k]))
+	}
+}
+
+func (w *msgWriter) bytes() ([]byte, error) {
+	if w.err != nil {
+		return nil, w.err
+	}
+	return w.buf.Bytes(), nil
+}
+
+type msgReader struct {
+	data    []byte
+	version byte
+	err     error
+}
+
+func newMsgReader(data []byte, typ byte) *msgReader {
+	r := &msgReader{data: data}
+	switch {
+	case len(data) < 2:
+		r.err = fmt.Errorf("Message too short")
+	case data[0] < 1 || data[0] > MessageVersion:
+		r.err = fmt.Errorf("Unsupported message version: %d", data[0])
+	case data[1] != typ:
+		r.err = fmt.Errorf("Unexpected message type: %d", data[1])
+	default:
+		r.version = data[0]
+		r.data = data[2:]
+	}
+	return r
+}
+
+func (r *msgReader) uint16() int {
+	if r.err != nil {
+		return 0
+	}
+	if len(r.data) < 2 {
+		r.err = fmt.Errorf("Message truncated")
+		return 0
+	}
+	n := int(binary.BigEndian.Uint16(r.data))
+	r.data = r.data[2:]
+	return n
+}
+
+func (r *msgReader) field() []byte {
+	n := r.uint16()
+	if r.err != nil {
+		return nil
+	}
+	if len(r.data) < n {
+		r.err = fmt.Errorf("Message truncated")
+		return nil
+	}
+	f := make([]byte, n)
+	copy(f, r.data)
+	r.data = r.data[n:]
+	return f
+}
+
+func (r *msgReader) params() map[string]string {
+	n := r.uint16()
+	if n == 0 {
+		return nil
+	}
+	params := make(map[string]string, n)
+	prev := ""
+	for i := 0; i < n && r.err == nil; i++ {
+		k, v := string(r.field()), string(r.field())
+		if i > 0 && k <= prev {
+			r.err = fmt.Errorf("Params not sorted or duplicated: %s", k)
+		}
+		params[k] = v
+		prev = k
+	}
+	return params
+}
+
+// skipEmpty reads an empty field and reports whether there was one.
+func (r *msgReader) skipEmpty() bool {
+	if !r.optional() || len(r.data) < 2 || r.data[0] != 0 || r.data[1] != 0 {
+		return false
+	}
+	r.data = r.data[2:]
+	return true
+}
+
+// more reports whether there is data left to read.
+func (r *msgReader) more() bool {
+	return r.err == nil && len(r.data) != 0
+}
+
+// optional reports whether there is data left to read for the optional
+// fields added in version 2.
+func (r *msgReader) optional() bool {
+	return r.version >= 2 && r.more()
+}
+
+func (r *msgReader) done() error {
+	if r.err == nil && len(r.data) != 0 {
+		r.err = fmt.Errorf("Unexpected %d bytes after message", len(r.data))
+	}
+	return r.err
+}
@@ -0,0 +1,196 @@
+// Copyright 2013 Tad Glines
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+package srp
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding"
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+type message interface {
+	encoding.BinaryMarshaler
+	encoding.BinaryUnmarshaler
+}
+
+func TestMessagesHandshake(t *testing.T) {
+	srp, err := NewSRP("rfc5054.2048", sha256.New, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	username, password := []byte("test"), []byte("password")
+	salt, v, err := srp.ComputeVerifier(password)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Every message is passed through both encodings before being used.
+	transfer := func(in, out message) {
+		data, err := in.MarshalBinary()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := out.UnmarshalBinary(data); err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(in, out) {
+			t.Fatalf("Binary round trip changed message: %#v != %#v", in, out)
+		}
+		js, err := json.Marshal(out)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := json.Unmarshal(js, out); err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(in, out) {
+			t.Fatalf("JSON round trip changed message: %#v != %#v", in, out)
+		}
+	}
+
+	cs := srp.NewClientSession(username, password)
+	hello := new(ClientHello)
+	transfer(&ClientHello{Username: username, A: cs.GetA()}, hello)
+	if err := hello.Validate(srp); err != nil {
+		t.Fatal(err)
+	}
+
+	ss := srp.NewServerSession(hello.Username, salt, v)
+	if _, err := ss.ComputeKey(hello.A); err != nil {
+		t.Fatal(err)
+	}
+	challenge := new(ServerChallenge)
+	transfer(&ServerChallenge{
+		Salt:   salt,
+		B:      ss.GetB(),
+		Group:  "rfc5054.2048",
+		Params: map[string]string{"hash": "sha256", "kdf": "default"},
+	}, challenge)
+	if err := challenge.Validate(srp); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := cs.ComputeKey(challenge.Salt, challenge.B); err != nil {
+		t.Fatal(err)
+	}
+	cproof := new(ClientProof)
+	transfer(&ClientProof{M1: cs.ComputeAuthenticator()}, cproof)
+	if err := cproof.Validate(srp); err != nil {
+		t.Fatal(err)
+	}
+	if !ss.VerifyClientAuthenticator(cproof.M1) {
+		t.Fatal("Client Authenticator is not valid")
+	}
+
+	sproof := new(ServerProof)
+	transfer(&ServerProof{M2: ss.ComputeAuthenticator(cproof.M1)}, sproof)
+	if err := sproof.Validate(srp); err != nil {
+		t.Fatal(err)
+	}
+	if !cs.VerifyServerAuthenticator(sproof.M2) {
+		t.Fatal("Server Authenticator is not valid")
+	}
+}
+
+func TestMessageDecodingErrors(t *testing.T) {
+	good, _ := (&ClientHello{Username: []byte("test"), A: []byte{1, 2, 3}}).MarshalBinary()
+	cases := map[string][]byte{
+		"empty":     {},
+		"version":   append([]byte{MessageVersion + 1}, good[1:]...),
+		"version 0": append([]byte{0}, good[1:]...),
+		"type":      append([]byte{MessageVersion, msgClientProof}, good[2:]...),
+		"truncated": good[:len(good)-1],
+		"trailing":  append(append([]byte{}, good...), 0),
+	}
+	for name, data := range cases {
+		if err := new(ClientHello).UnmarshalBinary(data); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+
+	// Params must be sorted and unique so that each message has one encoding.
+	data := []byte{MessageVersion, msgServerChallenge, 0, 1, 1, 0, 1, 2, 0, 0, 0, 2,
+		0, 1, 'b', 0, 0,
+		0, 1, 'a', 0, 0}
+	if err := new(ServerChallenge).UnmarshalBinary(data); err == nil {
+		t.Error("unsorted params: expected an error")
+	}
+	data = append(data[:17], 0, 1, 'b', 0, 0)
+	if err := new(ServerChallenge).UnmarshalBinary(data); err == nil {
+		t.Error("duplicate params: expected an error")
+	}
+	data = append(data[:17], 0, 1, 'c', 0, 0)
+	if err := new(ServerChallenge).UnmarshalBinary(data); err != nil {
+		t.Errorf("sorted params: %v", err)
+	}
+
+	// Version 1 messages are read, but without the fields added in version 2.
+	data, _ = (&ClientProof{M1: []byte{1}}).MarshalBinary()
+	data[0] = 1
+	if err := new(ClientProof).UnmarshalBinary(data); err != nil {
+		t.Errorf("version 1: %v", err)
+	}
+	data, _ = (&ClientProof{M1: []byte{1}, A: []byte{2}}).MarshalBinary()
+	data[0] = 1
+	if err := new(ClientProof).UnmarshalBinary(data); err == nil {
+		t.Error("version 1 with A: expected an error")
+	}
+}
+
+func TestMessageValidation(t *testing.T) {
+	srp, err := NewSRP("rfc5054.1024", sha256.New, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	N := srp.Group.Prime.Bytes()
+
+	// Without A the client asks for N and g.
+	if err := (&ClientHello{Username: []byte("test")}).Validate(srp); err != nil {
+		t.Fatal(err)
+	}
+	invalid := []*ClientHello{
+		{Username: []byte("test"), A: []byte{}},
+		{Username: []byte("test"), A: N},
+		{Username: []byte("test"), A: make([]byte, len(N))},
+		{Username: []byte("test"), A: append([]byte{0}, N...)},
+		{A: []byte{2}},
+	}
+	for _, m := range invalid {
+		if m.Validate(srp) == nil {
+			t.Errorf("Expected ClientHello{%x, %x} to be invalid", m.Username, m.A)
+		}
+	}
+
+	valid := &ServerChallenge{Salt: []byte{1}, B: []byte{2}, Group: "rfc5054.1024"}
+	if err := valid.Validate(srp); err != nil {
+		t.Fatal(err)
+	}
+	for _, grp := range []string{"rfc5054.2048", "unknown"} {
+		m := &ServerChallenge{Salt: []byte{1}, B: []byte{2}, Group: grp}
+		if m.Validate(srp) == nil {
+			t.Errorf("Expected group %s to be rejected", grp)
+		}
+	}
+
+	if (&ClientProof{M1: make([]byte, 20)}).Validate(srp) == nil {
+		t.Error("Expected a short M1 to be rejected")
+	}
+	if (&ServerProof{M2: bytes.Repeat([]byte{1}, 32)}).Validate(srp) != nil {
+		t.Error("Expected a full size M2 to be accepted")
+	}
+}
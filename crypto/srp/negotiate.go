@@ -0,0 +1,246 @@
+// Copyright 2013 Tad Glines
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+package srp
+
+/*
+	Negotiation lets a client that does not know the group and parameters
+	of a user list those it supports, and the server choose the ones of the
+	user's verifier record. Since A depends on the group, it is sent with
+	the proof instead of the hello, as in RFC 5054:
+
+		client                            server
+		ClientHello{I, offer}     ->
+		                          <-      ServerChallenge{s, B, group, params}
+		ClientProof{M1, A}        ->
+		                          <-      ServerProof{M2}
+
+	The client only accepts a choice that is in its offer, and both sides
+	bind the offer and the choice into M1 and M2 with BindNegotiation. A
+	man in the middle removing the strong choices from the offer, or
+	changing the choice, makes the authenticators differ, so the handshake
+	fails instead of silently using weaker parameters.
+
+	An offer lists names of registered groups, hashes, KDFs and profiles.
+	The default hash is always acceptable if Hashes is empty, the default
+	KDF if KDFs is empty, and the default formulas (no profile) always.
+	Parameters such as the PBKDF2 iteration count are not negotiated; they
+	are protected by the binding and limited by the cost bounds of the
+	offer, by MaxPBKDF2Iter and the scrypt limits of NewSRPWithParams, and
+	by the policy (see SetPolicy) of the client. A client should set
+	MinIter or MinScryptN: an attacker posing as the server may otherwise
+	choose a low cost, which makes an offline attack on the client's proof
+	cheap.
+*/
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Offer lists the groups, hashes, KDFs and profiles a client supports. The
+// cost bounds are checked by Allows on the client and are not sent; 0 means
+// no bound other than those of NewSRPWithParams.
+type Offer struct {
+	Groups     []string `json:"groups"`
+	Hashes     []string `json:"hashes,omitempty"`
+	KDFs       []string `json:"kdfs,omitempty"`
+	Profiles   []string `json:"profiles,omitempty"`
+	MinIter    int      `json:"-"` // Bounds on the PBKDF2 iteration count
+	MaxIter    int      `json:"-"` //
+	MinScryptN int      `json:"-"` // Bounds on the scrypt N
+	MaxScryptN int      `json:"-"` //
+}
+
+// Keys of the params encoding of an Offer.
+const (
+	offerGroups   = "groups"
+	offerHashes   = "hashes"
+	offerKDFs     = "kdfs"
+	offerProfiles = "profiles"
+)
+
+// NegotiationError is returned when the group or a parameter chosen by the
+// server is not in the offer of the client, or a cost is out of its bounds.
+type NegotiationError struct {
+	Param string // "group" or one of ParamHash, ParamKDF, ParamProfile, ParamIter and ParamScryptN
+	Value string
+}
+
+func (e *NegotiationError) Error() string {
+	return fmt.Sprintf("Not offered by the client (%s): %s", e.Param, e.Value)
+}
+
+// Allows returns a *NegotiationError unless the group and params are within
+// the offer, including its cost bounds.
+func (o *Offer) Allows(group string, params map[string]string) error {
+	if !contains(o.Groups, group) {
+		return &NegotiationError{"group", group}
+	}
+	if h := paramOr(params, ParamHash, DefaultHash); !contains(orDefault(o.Hashes, DefaultHash), h) {
+		return &NegotiationError{ParamHash, h}
+	}
+	if kdf := paramOr(params, ParamKDF, "default"); !contains(orDefault(o.KDFs, "default"), kdf) {
+		return &NegotiationError{ParamKDF, kdf}
+	}
+	if p := params[ParamProfile]; p != "" && !contains(o.Profiles, p) {
+		return &NegotiationError{ParamProfile, p}
+	}
+	return checkCosts(params, o.MinIter, o.MaxIter, o.MinScryptN, o.MaxScryptN)
+}
+
+// checkCosts returns a *NegotiationError unless the PBKDF2 iteration count
+// or the scrypt N of params is within the bounds, 0 meaning no bound.
+func checkCosts(params map[string]string, minIter, maxIter, minN, maxN int) error {
+	switch paramOr(params, ParamKDF, "default") {
+	case "pbkdf2":
+		return checkCost(params, ParamIter, DefaultPBKDF2Iter, minIter, maxIter)
+	case "scrypt":
+		return checkCost(params, ParamScryptN, DefaultScryptN, minN, maxN)
+	}
+	return nil
+}
+
+// checkCost returns a *NegotiationError unless the cost param is within min
+// and max, 0 meaning no bound.
+func checkCost(params map[string]string, name string, def, min, max int) error {
+	n, err := intParam(params, name, def)
+	if err != nil {
+		return err
+	}
+	if n < min || (max > 0 && n > max) {
+		return &NegotiationError{name, strconv.Itoa(n)}
+	}
+	return nil
+}
+
+// NewSRP checks that the choice of the server is within the offer and
+// returns the SRP context for it. The challenge is validated as well.
+func (o *Offer) NewSRP(challenge *ServerChallenge) (*SRP, error) {
+	if err := o.Allows(challenge.Group, challenge.Params); err != nil {
+		return nil, err
+	}
+	s, err := NewSRPWithParams(challenge.Group, challenge.Params)
+	if err != nil {
+		return nil, err
+	}
+	if err := challenge.Validate(s); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// validate checks that the offer has groups and that its names can be
+// encoded.
+func (o *Offer) validate() error {
+	if len(o.Groups) == 0 {
+		return fmt.Errorf("Offer without groups")
+	}
+	for _, names := range [][]string{o.Groups, o.Hashes, o.KDFs, o.Profiles} {
+		for _, name := range names {
+			if name == "" || strings.Contains(name, ",") {
+				return fmt.Errorf("Invalid name in offer: %q", name)
+			}
+		}
+	}
+	return nil
+}
+
+// params returns the offer as params, each list joined with commas.
+func (o *Offer) params() map[string]string {
+	params := make(map[string]string)
+	for key, names := range map[string][]string{
+		offerGroups:   o.Groups,
+		offerHashes:   o.Hashes,
+		offerKDFs:     o.KDFs,
+		offerProfiles: o.Profiles,
+	} {
+		if len(names) != 0 {
+			params[key] = strings.Join(names, ",")
+		}
+	}
+	return params
+}
+
+// parseOffer decodes the params returned by Offer.params.
+func parseOffer(params map[string]string) (*Offer, error) {
+	o := new(Offer)
+	for key, value := range params {
+		if value == "" {
+			return nil, fmt.Errorf("Empty offer field: %s", key)
+		}
+		names := strings.Split(value, ",")
+		switch key {
+		case offerGroups:
+			o.Groups = names
+		case offerHashes:
+			o.Hashes = names
+		case offerKDFs:
+			o.KDFs = names
+		case offerProfiles:
+			o.Profiles = names
+		default:
+			return nil, fmt.Errorf("Unknown offer field: %s", key)
+		}
+	}
+	return o, nil
+}
+
+// negotiation returns the encoding of an offer and the choice of the server
+// that is bound into the authenticators.
+func negotiation(o *Offer, group string, params map[string]string) []byte {
+	w := newMsgWriter(msgNegotiation)
+	w.params(o.params())
+	w.field([]byte(group))
+	w.params(params)
+	return w.buf.Bytes()
+}
+
+// BindNegotiation binds the offer of the client and the group and params
+// chosen by the server into the authenticators. Both sides must call it
+// before computing or verifying an authenticator.
+func (cs *ClientSession) BindNegotiation(o *Offer, group string, params map[string]string) {
+	cs.bind("negotiation", negotiation(o, group, params))
+}
+
+// BindNegotiation binds the offer of the client and the group and params
+// chosen by the server into the authenticators. Both sides must call it
+// before computing or verifying an authenticator.
+func (ss *ServerSession) BindNegotiation(o *Offer, group string, params map[string]string) {
+	ss.bind("negotiation", negotiation(o, group, params))
+}
+
+func paramOr(params map[string]string, name, def string) string {
+	if v := params[name]; v != "" {
+		return v
+	}
+	return def
+}
+
+func orDefault(names []string, def string) []string {
+	if len(names) == 0 {
+		return []string{def}
+	}
+	return names
+}
+
+func contains(names []string, name string) bool {
+	for _, n := range names {
+		if n == name {
+			return true
+		}
+	}
+	return false
+}
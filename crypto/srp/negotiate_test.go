@@ -0,0 +1,220 @@
+// Copyright 2013 Tad Glines
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+package srp
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+// negotiate runs a negotiated handshake in which the server sees the offer
+// serverOffer and the client the challenge returned by tamper.
+func negotiate(t *testing.T, rec *VerifierRecord, offer, serverOffer *Offer, tamper func(*ServerChallenge)) (bool, error) {
+	if err := serverOffer.Allows(rec.Group, rec.Params); err != nil {
+		return false, err
+	}
+	ssrp, ss, err := rec.NewServerSession()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ss.BindNegotiation(serverOffer, rec.Group, rec.Params)
+	challenge := &ServerChallenge{Salt: rec.Salt, B: ss.GetB(), Group: rec.Group, Params: rec.Params}
+	if tamper != nil {
+		tamper(challenge)
+	}
+
+	s, err := offer.NewSRP(challenge)
+	if err != nil {
+		return false, err
+	}
+	cs := s.NewClientSession(rec.Username, []byte("password"))
+	cs.BindNegotiation(offer, challenge.Group, challenge.Params)
+	if _, err := cs.ComputeKey(challenge.Salt, challenge.B); err != nil {
+		return false, err
+	}
+	proof := &ClientProof{M1: cs.ComputeAuthenticator(), A: cs.GetA()}
+	if err := proof.Validate(ssrp); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ss.ComputeKey(proof.A); err != nil {
+		t.Fatal(err)
+	}
+	if !ss.VerifyClientAuthenticator(proof.M1) {
+		return false, nil
+	}
+	return cs.VerifyServerAuthenticator(ss.ComputeAuthenticator(proof.M1)), nil
+}
+
+func TestNegotiation(t *testing.T) {
+	params := map[string]string{ParamKDF: "pbkdf2", ParamIter: "10"}
+	rec, err := NewVerifierRecord("rfc5054.2048", params, []byte("test"), []byte("password"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	offer := &Offer{Groups: []string{"rfc5054.2048", "rfc5054.1024"}, KDFs: []string{"pbkdf2", "default"}}
+	if ok, err := negotiate(t, rec, offer, offer, nil); !ok || err != nil {
+		t.Fatalf("Expected the negotiated handshake to succeed, got %v, %v", ok, err)
+	}
+
+	// The strong choices are removed from the offer seen by the server.
+	weak := &Offer{Groups: []string{"rfc5054.2048", "rfc5054.1024"}, KDFs: []string{"pbkdf2"}}
+	if ok, err := negotiate(t, rec, offer, weak, nil); ok || err != nil {
+		t.Fatalf("Expected a changed offer to fail the handshake, got %v, %v", ok, err)
+	}
+	// The choice is changed within the offer.
+	ok, err := negotiate(t, rec, offer, offer, func(ch *ServerChallenge) {
+		ch.Params = map[string]string{ParamKDF: "pbkdf2", ParamIter: "5"}
+	})
+	if ok || err != nil {
+		t.Fatalf("Expected a changed choice to fail the handshake, got %v, %v", ok, err)
+	}
+	// The choice is changed to one that was not offered.
+	_, err = negotiate(t, rec, offer, offer, func(ch *ServerChallenge) { ch.Group = "rfc5054.1536" })
+	if err, ok := err.(*NegotiationError); !ok || err.Param != "group" {
+		t.Fatalf("Expected a NegotiationError, got %v", err)
+	}
+}
+
+func TestOfferAllows(t *testing.T) {
+	offer := &Offer{Groups: []string{"rfc5054.2048"}}
+	for _, test := range []struct {
+		group  string
+		params map[string]string
+		param  string
+	}{
+		{"rfc5054.2048", nil, ""},
+		{"rfc5054.2048", map[string]string{ParamHash: DefaultHash, ParamKDF: "default"}, ""},
+		{"rfc5054.1024", nil, "group"},
+		{"rfc5054.2048", map[string]string{ParamHash: "sha1"}, ParamHash},
+		{"rfc5054.2048", map[string]string{ParamKDF: "scrypt"}, ParamKDF},
+		{"rfc5054.2048", map[string]string{ParamProfile: "pysrp"}, ParamProfile},
+	} {
+		err := offer.Allows(test.group, test.params)
+		if test.param == "" && err != nil {
+			t.Errorf("%s %v: %v", test.group, test.params, err)
+		}
+		if err, ok := err.(*NegotiationError); test.param != "" && (!ok || err.Param != test.param) {
+			t.Errorf("%s %v: expected a NegotiationError for %s, got %v", test.group, test.params, test.param, err)
+		}
+	}
+}
+
+func TestOfferCosts(t *testing.T) {
+	offer := &Offer{Groups: []string{"rfc5054.2048"}, KDFs: []string{"pbkdf2", "scrypt"}, MinIter: 1000, MaxIter: 100000, MinScryptN: 1024}
+	for _, test := range []struct {
+		params map[string]string
+		param  string
+	}{
+		{map[string]string{ParamKDF: "pbkdf2"}, ""},
+		{map[string]string{ParamKDF: "pbkdf2", ParamIter: "1"}, ParamIter},
+		{map[string]string{ParamKDF: "pbkdf2", ParamIter: "2147483647"}, ParamIter},
+		{map[string]string{ParamKDF: "scrypt"}, ""},
+		{map[string]string{ParamKDF: "scrypt", ParamScryptN: "2"}, ParamScryptN},
+	} {
+		err := offer.Allows("rfc5054.2048", test.params)
+		if test.param == "" && err != nil {
+			t.Errorf("%v: %v", test.params, err)
+		}
+		if err, ok := err.(*NegotiationError); test.param != "" && (!ok || err.Param != test.param) {
+			t.Errorf("%v: expected a NegotiationError for %s, got %v", test.params, test.param, err)
+		}
+	}
+
+	// Costs within an offer without bounds are still limited.
+	offer = &Offer{Groups: []string{"rfc5054.2048"}, KDFs: []string{"pbkdf2", "scrypt"}}
+	for _, params := range []map[string]string{
+		{ParamKDF: "pbkdf2", ParamIter: "2147483647"},
+		{ParamKDF: "scrypt", ParamScryptN: "2", ParamScryptR: "1", ParamScryptP: "268435456"},
+	} {
+		if _, err := offer.NewSRP(&ServerChallenge{Group: "rfc5054.2048", Params: params}); err == nil {
+			t.Errorf("%v: expected an error", params)
+		}
+	}
+}
+
+func TestOfferEncoding(t *testing.T) {
+	offer := &Offer{Groups: []string{"rfc5054.3072", "rfc5054.2048"}, Hashes: []string{"sha256"}, Profiles: []string{"pysrp"}}
+	puzzle := &PuzzleSolution{
+		PuzzleChallenge: PuzzleChallenge{Seed: []byte{1}, Difficulty: 8, Expires: 1, MAC: []byte{2}},
+		Nonce:           []byte{3},
+	}
+	for _, m := range []*ClientHello{
+		{Username: []byte("test"), Offer: offer},
+		{Username: []byte("test"), Puzzle: puzzle, Offer: offer},
+	} {
+		data, err := m.MarshalBinary()
+		if err != nil {
+			t.Fatal(err)
+		}
+		out := new(ClientHello)
+		if err := out.UnmarshalBinary(data); err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(m, out) {
+			t.Fatalf("Binary round trip changed message: %#v != %#v", m, out)
+		}
+		js, _ := json.Marshal(m)
+		out = new(ClientHello)
+		if err := json.Unmarshal(js, out); err != nil || !reflect.DeepEqual(m, out) {
+			t.Fatalf("JSON round trip changed message: %s", js)
+		}
+	}
+
+	hello := []byte{MessageVersion, msgClientHello, 0, 1, 't', 0, 0}
+	for name, data := range map[string][]byte{
+		"missing offer": append(hello, 0, 0),
+		"no groups":     append(hello, 0, 0, 0, 0),
+		"empty field":   append(hello, 0, 0, 0, 1, 0, 6, 'g', 'r', 'o', 'u', 'p', 's', 0, 0),
+		"unknown field": append(hello, 0, 0, 0, 1, 0, 1, 'x', 0, 1, 'y'),
+	} {
+		if err := new(ClientHello).UnmarshalBinary(data); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+	if _, err := (&ClientHello{Offer: &Offer{Groups: []string{"a,b"}}}).MarshalBinary(); err == nil {
+		t.Error("Expected a name with a comma to be rejected")
+	}
+}
+
+func TestDiagnoseBound(t *testing.T) {
+	s, err := NewSRP("rfc5054.1024", sha256.New, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Debug = true
+	salt, v, err := s.ComputeVerifier([]byte("password"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The client does not bind the negotiation.
+	cs := s.NewClientSession([]byte("test"), []byte("password"))
+	ss := s.NewServerSession([]byte("test"), salt, v)
+	ss.BindNegotiation(&Offer{Groups: []string{"rfc5054.1024"}}, "rfc5054.1024", nil)
+	if _, err := ss.ComputeKey(cs.GetA()); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := cs.ComputeKey(salt, ss.GetB()); err != nil {
+		t.Fatal(err)
+	}
+	if ss.VerifyClientAuthenticator(cs.ComputeAuthenticator()) {
+		t.Fatal("Expected the client authenticator to be rejected")
+	}
+	d := Diagnose(ss.Transcript(), nil)
+	if d == nil || d.Name != "M1" || d.Cause != diagnoseHints["bound"] || !containsAll(d.Matches, []string{"default without bound values"}) {
+		t.Fatalf("Unexpected diagnosis: %v", d)
+	}
+}
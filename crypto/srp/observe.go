@@ -0,0 +1,121 @@
+// Copyright 2013 Tad Glines
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+package srp
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// EventType identifies what happened in an Event.
+type EventType int
+
+const (
+	EventSessionCreated   EventType = iota // A or B was computed
+	EventVerifierComputed                  // ComputeVerifier succeeded
+	EventKeyComputed                       // ComputeKey succeeded
+	EventKeyFailed                         // ComputeKey failed, see Err
+	EventProofVerified                     // The peer's authenticator is valid
+	EventProofFailed                       // The peer's authenticator is not valid
+)
+
+var eventNames = []string{
+	EventSessionCreated:   "session_created",
+	EventVerifierComputed: "verifier_computed",
+	EventKeyComputed:      "key_computed",
+	EventKeyFailed:        "key_failed",
+	EventProofVerified:    "proof_verified",
+	EventProofFailed:      "proof_failed",
+}
+
+func (t EventType) String() string {
+	if t < 0 || int(t) >= len(eventNames) {
+		return fmt.Sprintf("EventType(%d)", int(t))
+	}
+	return eventNames[t]
+}
+
+// Roles of the session an Event comes from.
+const (
+	RoleClient = "client"
+	RoleServer = "server"
+)
+
+// Event describes a step of an SRP session. Events never contain secrets,
+// keys, public values, usernames or addresses. Err is an *InputError, a
+// *GuardError whose Key is only "user" or "addr", or an error of this
+// package that does not depend on the values of the session.
+type Event struct {
+	Type     EventType
+	Role     string        // RoleClient or RoleServer
+	Group    string        // Name the group is registered under
+	Hash     string        // Name the hash is registered under, or its type
+	Err      error         // Cause of an EventKeyFailed
+	KDFTime  time.Duration // Time spent deriving x from the password
+	ExpTime  time.Duration // Time spent in modular exponentiation
+	Duration time.Duration // Total time of the step
+}
+
+// Observer receives the events of every session of an SRP with Observer set.
+// Observe is called synchronously, so it should be fast, and must be safe
+// for concurrent use if the SRP is used concurrently.
+type Observer interface {
+	Observe(e *Event)
+}
+
+func (s *SRP) observe(e *Event) {
+	if s.Observer == nil {
+		return
+	}
+	e.Group = groupName(s.Group)
+	e.Hash = hashName(s.HashFunc)
+	s.Observer.Observe(e)
+}
+
+// groupName returns the name grp is registered under.
+func groupName(grp *SRPGroup) string {
+	for name, g := range srp_groups {
+		if g == grp {
+			return name
+		}
+	}
+	return fmt.Sprintf("unregistered.%d", grp.Size)
+}
+
+// hashName returns the name h is registered under, or the type of the hashes
+// it returns.
+func hashName(h HashFunc) string {
+	p := reflect.ValueOf(h).Pointer()
+	for name, rh := range srp_hashes {
+		if reflect.ValueOf(rh).Pointer() == p {
+			return name
+		}
+	}
+	return fmt.Sprintf("%T", h())
+}
+
+// guardEventError returns an error of a Guard without the username or
+// address it refers to, for Event.Err. Errors of other guards are replaced
+// by their type, since they may contain anything.
+func guardEventError(err error) error {
+	if e, ok := err.(*GuardError); ok {
+		r := *e
+		r.Key, _, _ = strings.Cut(r.Key, ":")
+		return &r
+	}
+	return fmt.Errorf("Login refused by %T", err)
+}
@@ -0,0 +1,141 @@
+// Copyright 2013 Tad Glines
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+package observer
+
+import (
+	"encoding/json"
+	"expvar"
+	"github.com/lann/go-pkgs/crypto/srp"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// DefaultBuckets are the upper bounds, in seconds, of the Histogram buckets
+// used by Expvar. They cover a fast 1024 bit exponentiation up to a slow KDF.
+var DefaultBuckets = []float64{0.0001, 0.00025, 0.0005, 0.001, 0.0025, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5}
+
+// Expvar counts events and records timings in expvar variables:
+//
+//	events    "<role>.<event>" and "<role>.<event>.<group>" counts
+//	kdf       "<group>.<hash>" histograms of Event.KDFTime
+//	exp       "<role>.<group>" histograms of Event.ExpTime
+type Expvar struct {
+	Events *expvar.Map
+	KDF    *expvar.Map
+	Exp    *expvar.Map
+	mu     sync.Mutex
+}
+
+// NewExpvar creates an Expvar and publishes its variables in a map with the
+// given name. Like expvar.Publish it panics if the name is already in use.
+func NewExpvar(name string) *Expvar {
+	e := &Expvar{
+		Events: new(expvar.Map).Init(),
+		KDF:    new(expvar.Map).Init(),
+		Exp:    new(expvar.Map).Init(),
+	}
+	m := expvar.NewMap(name)
+	m.Set("events", e.Events)
+	m.Set("kdf", e.KDF)
+	m.Set("exp", e.Exp)
+	return e
+}
+
+// Observe counts e and records its timings.
+func (e *Expvar) Observe(ev *srp.Event) {
+	name := ev.Type.String()
+	if ev.Role != "" {
+		name = ev.Role + "." + name
+	}
+	e.Events.Add(name, 1)
+	e.Events.Add(name+"."+ev.Group, 1)
+	if ev.KDFTime > 0 {
+		e.histogram(e.KDF, ev.Group+"."+ev.Hash).Observe(ev.KDFTime)
+	}
+	if ev.ExpTime > 0 {
+		role := ev.Role
+		if role == "" {
+			role = "verifier"
+		}
+		e.histogram(e.Exp, role+"."+ev.Group).Observe(ev.ExpTime)
+	}
+}
+
+func (e *Expvar) histogram(m *expvar.Map, key string) *Histogram {
+	if h, ok := m.Get(key).(*Histogram); ok {
+		return h
+	}
+	// Get and Set are not atomic together.
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if h, ok := m.Get(key).(*Histogram); ok {
+		return h
+	}
+	h := NewHistogram(DefaultBuckets)
+	m.Set(key, h)
+	return h
+}
+
+// Histogram is an expvar.Var counting durations in buckets. Its JSON value
+// holds the count, the sum in seconds and the cumulative count of each
+// bucket by its upper bound, like a Prometheus histogram.
+type Histogram struct {
+	mu      sync.Mutex
+	bounds  []float64
+	buckets []uint64
+	count   uint64
+	sum     float64
+}
+
+// NewHistogram creates a histogram with the given sorted bucket bounds in
+// seconds.
+func NewHistogram(bounds []float64) *Histogram {
+	return &Histogram{bounds: bounds, buckets: make([]uint64, len(bounds))}
+}
+
+// Observe adds d to the histogram.
+func (h *Histogram) Observe(d time.Duration) {
+	s := d.Seconds()
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.count++
+	h.sum += s
+	for i, b := range h.bounds {
+		if s <= b {
+			h.buckets[i]++
+			break
+		}
+	}
+}
+
+// String returns the JSON value of the histogram.
+func (h *Histogram) String() string {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	buckets := make(map[string]uint64, len(h.bounds)+1)
+	var n uint64
+	for i, b := range h.bounds {
+		n += h.buckets[i]
+		buckets[strconv.FormatFloat(b, 'g', -1, 64)] = n
+	}
+	buckets["+Inf"] = h.count
+	data, _ := json.Marshal(struct {
+		Count   uint64            `json:"count"`
+		Sum     float64           `json:"sum"`
+		Buckets map[string]uint64 `json:"buckets"`
+	}{h.count, h.sum, buckets})
+	return string(data)
+}
@@ -0,0 +1,82 @@
+// Copyright 2013 Tad Glines
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+// Package observer provides srp.Observer implementations that log events
+// with log/slog and count them with expvar. They are kept out of package srp
+// because importing expvar registers a handler with net/http.
+package observer
+
+import (
+	"context"
+	"github.com/lann/go-pkgs/crypto/srp"
+	"log/slog"
+)
+
+// Multi returns an Observer that passes events to each of observers.
+func Multi(observers ...srp.Observer) srp.Observer {
+	return multi(observers)
+}
+
+type multi []srp.Observer
+
+func (m multi) Observe(e *srp.Event) {
+	for _, o := range m {
+		o.Observe(e)
+	}
+}
+
+// Slog logs events with a slog.Logger. Failures are logged at the warning
+// level and everything else at the debug level.
+type Slog struct {
+	Logger *slog.Logger
+}
+
+// NewSlog creates an Observer logging to l, or to slog.Default() if l is nil.
+func NewSlog(l *slog.Logger) *Slog {
+	if l == nil {
+		l = slog.Default()
+	}
+	return &Slog{Logger: l}
+}
+
+// Observe logs e.
+func (s *Slog) Observe(e *srp.Event) {
+	level := slog.LevelDebug
+	if e.Type == srp.EventKeyFailed || e.Type == srp.EventProofFailed {
+		level = slog.LevelWarn
+	}
+	ctx := context.Background()
+	if !s.Logger.Enabled(ctx, level) {
+		return
+	}
+	attrs := []slog.Attr{
+		slog.String("event", e.Type.String()),
+		slog.String("role", e.Role),
+		slog.String("group", e.Group),
+		slog.String("hash", e.Hash),
+	}
+	if e.Err != nil {
+		attrs = append(attrs, slog.String("error", e.Err.Error()))
+	}
+	if e.KDFTime > 0 {
+		attrs = append(attrs, slog.Duration("kdf", e.KDFTime))
+	}
+	if e.ExpTime > 0 {
+		attrs = append(attrs, slog.Duration("exp", e.ExpTime))
+	}
+	if e.Duration > 0 {
+		attrs = append(attrs, slog.Duration("duration", e.Duration))
+	}
+	s.Logger.LogAttrs(ctx, level, "srp", attrs...)
+}
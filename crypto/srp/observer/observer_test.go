@@ -0,0 +1,211 @@
+// Copyright 2013 Tad Glines
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+package observer
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"github.com/lann/go-pkgs/crypto/srp"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+)
+
+type recorder []srp.Event
+
+func (r *recorder) Observe(e *srp.Event) {
+	*r = append(*r, *e)
+}
+
+// handshake runs a login with the given password and returns the values that
+// must never appear in events.
+func handshake(t *testing.T, s *srp.SRP, password string) [][]byte {
+	username := []byte("alice")
+	salt, v, err := s.ComputeVerifier([]byte("password"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	cs := s.NewClientSession(username, []byte(password))
+	ss := s.NewServerSession(username, salt, v)
+	if _, err := ss.ComputeKey([]byte{0}); err == nil {
+		t.Fatal("Expected A=0 to be rejected")
+	}
+	skey, err := ss.ComputeKey(cs.GetA())
+	if err != nil {
+		t.Fatal(err)
+	}
+	ckey, err := cs.ComputeKey(salt, ss.GetB())
+	if err != nil {
+		t.Fatal(err)
+	}
+	M1 := cs.ComputeAuthenticator()
+	if ss.VerifyClientAuthenticator(M1) {
+		cs.VerifyServerAuthenticator(ss.ComputeAuthenticator(M1))
+	}
+	return [][]byte{username, []byte(password), salt, v, skey, ckey, M1, cs.GetA(), ss.GetB()}
+}
+
+func TestEvents(t *testing.T) {
+	s, err := srp.NewSRP("rfc5054.1024", sha256.New, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := new(recorder)
+	s.Observer = r
+	handshake(t, s, "password")
+
+	expected := []string{
+		"verifier_computed",
+		"client.session_created",
+		"server.session_created",
+		"server.key_failed",
+		"server.key_computed",
+		"client.key_computed",
+		"server.proof_verified",
+		"client.proof_verified",
+	}
+	if len(*r) != len(expected) {
+		t.Fatalf("Expected %d events, got %d: %v", len(expected), len(*r), *r)
+	}
+	for i, e := range *r {
+		name := e.Type.String()
+		if e.Role != "" {
+			name = e.Role + "." + name
+		}
+		if name != expected[i] {
+			t.Errorf("Event %d: expected %s, got %s", i, expected[i], name)
+		}
+		if e.Group != "rfc5054.1024" || e.Hash != "sha256" {
+			t.Errorf("Event %d: unexpected group or hash: %s %s", i, e.Group, e.Hash)
+		}
+	}
+	if (*r)[3].Err == nil {
+		t.Error("The cause of the failure is missing")
+	}
+	if (*r)[0].KDFTime <= 0 || (*r)[5].KDFTime <= 0 || (*r)[4].ExpTime <= 0 {
+		t.Error("Timings are missing")
+	}
+
+	*r = nil
+	handshake(t, s, "wrong")
+	if last := (*r)[len(*r)-1]; last.Type != srp.EventProofFailed || last.Role != srp.RoleServer {
+		t.Errorf("Expected a failed proof, got %v", last)
+	}
+}
+
+func TestSlog(t *testing.T) {
+	s, err := srp.NewSRP("rfc5054.1024", sha256.New, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	s.Observer = NewSlog(slog.New(slog.NewTextHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug})))
+	secrets := handshake(t, s, "wrong")
+
+	out := buf.String()
+	if !strings.Contains(out, "level=WARN msg=srp event=proof_failed role=server group=rfc5054.1024 hash=sha256") {
+		t.Fatalf("Failed proof not logged:\n%s", out)
+	}
+	for _, secret := range secrets {
+		if strings.Contains(out, hex.EncodeToString(secret)) || strings.Contains(out, string(secret)) {
+			t.Fatalf("Log contains %q:\n%s", secret, out)
+		}
+	}
+}
+
+func TestGuardEvents(t *testing.T) {
+	s, err := srp.NewSRP("rfc5054.1024", sha256.New, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	g := srp.NewBackoffGuard(srp.NewMemoryGuardStore())
+	g.Failure("alice", "192.0.2.1")
+	s.Guard = g
+	var buf bytes.Buffer
+	r := new(recorder)
+	s.Observer = Multi(r, NewSlog(slog.New(slog.NewTextHandler(&buf, nil))))
+
+	cs := s.NewClientSession([]byte("alice"), []byte("password"))
+	ss := s.NewServerSession([]byte("alice"), []byte("salt"), []byte{1})
+	ss.RemoteAddr = "192.0.2.1"
+	if _, err := ss.ComputeKey(cs.GetA()); err == nil {
+		t.Fatal("Expected the guard to refuse the login")
+	}
+	last := (*r)[len(*r)-1]
+	if gerr, ok := last.Err.(*srp.GuardError); !ok || gerr.Key != "user" {
+		t.Fatalf("Expected a *GuardError without the username, got %v", last.Err)
+	}
+	if out := buf.String(); strings.Contains(out, "alice") || strings.Contains(out, "192.0.2.1") {
+		t.Fatalf("Log contains the username or the address:\n%s", out)
+	}
+}
+
+func TestExpvar(t *testing.T) {
+	s, err := srp.NewSRP("rfc5054.1024", sha256.New, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	e := NewExpvar("srp_test")
+	s.Observer = Multi(e, new(recorder))
+	handshake(t, s, "password")
+	handshake(t, s, "wrong")
+
+	var events map[string]int
+	if err := json.Unmarshal([]byte(e.Events.String()), &events); err != nil {
+		t.Fatal(err)
+	}
+	for name, n := range map[string]int{
+		"server.proof_verified":               1,
+		"server.proof_failed":                 1,
+		"server.key_failed.rfc5054.1024":      2,
+		"client.session_created.rfc5054.1024": 2,
+	} {
+		if events[name] != n {
+			t.Errorf("Expected %s to be %d, got %d", name, n, events[name])
+		}
+	}
+
+	var h struct {
+		Count   uint64
+		Buckets map[string]uint64
+	}
+	if err := json.Unmarshal([]byte(e.KDF.Get("rfc5054.1024.sha256").String()), &h); err != nil {
+		t.Fatal(err)
+	}
+	// One verifier and one client key per handshake.
+	if h.Count != 4 || h.Buckets["+Inf"] != 4 {
+		t.Fatalf("Unexpected KDF histogram: %+v", h)
+	}
+}
+
+func TestHistogram(t *testing.T) {
+	h := NewHistogram([]float64{0.001, 0.01})
+	h.Observe(500 * time.Microsecond)
+	h.Observe(5 * time.Millisecond)
+	h.Observe(time.Second)
+	var v struct {
+		Count   uint64
+		Buckets map[string]uint64
+	}
+	if err := json.Unmarshal([]byte(h.String()), &v); err != nil {
+		t.Fatal(err)
+	}
+	if v.Count != 3 || v.Buckets["0.001"] != 1 || v.Buckets["0.01"] != 2 || v.Buckets["+Inf"] != 3 {
+		t.Fatalf("Unexpected histogram: %s", h.String())
+	}
+}
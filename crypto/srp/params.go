@@ -0,0 +1,230 @@
+// Copyright 2013 Tad Glines
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+package srp
+
+/*
+	Named parameters allow an SRP configuration to be stored next to a
+	verifier (see VerifierRecord) and sent to clients (see
+	ServerChallenge.Params). The recognized parameters are:
+
+		hash      Name of a registered hash (default sha256)
+		kdf       default, pbkdf2 or scrypt (default default)
+		iter      PBKDF2 iteration count (default 10000)
+		N, r, p   scrypt cost parameters (default 16384, 8, 1)
+		profile   Name of a registered Profile (default none)
+*/
+
+import (
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"fmt"
+	"github.com/lann/go-pkgs/crypto/srp/pbkdf2"
+	"github.com/lann/go-pkgs/crypto/srp/scrypt"
+	"sort"
+	"strconv"
+)
+
+const (
+	ParamHash    = "hash"
+	ParamKDF     = "kdf"
+	ParamIter    = "iter"
+	ParamScryptN = "N"
+	ParamScryptR = "r"
+	ParamScryptP = "p"
+	ParamProfile = "profile"
+)
+
+const (
+	DefaultHash       = "sha256"
+	DefaultPBKDF2Iter = 10000
+	DefaultScryptN    = 16384
+	DefaultScryptR    = 8
+	DefaultScryptP    = 1
+)
+
+// MaxScryptMemory is the most memory, in bytes, that the scrypt parameters
+// accepted by NewSRPWithParams may require (128*N*r). Parameters can come
+// from the other party, which must not be able to exhaust our memory.
+const MaxScryptMemory = 1 << 30
+
+// MaxPBKDF2Iter is the largest PBKDF2 iteration count accepted by
+// NewSRPWithParams, so that parameters from the other party cannot make a
+// derivation take minutes.
+const MaxPBKDF2Iter = 1 << 22
+
+// MaxScryptP is the largest scrypt parallelization parameter accepted by
+// NewSRPWithParams. Each unit of p repeats the work of the whole N*r memory,
+// so it bounds the time a derivation may take as MaxScryptMemory bounds its
+// memory.
+const MaxScryptP = 16
+
+// KDFConstructor creates a KeyDerivationFunc from the parameters. h is the
+// hash selected by the parameters. A nil KeyDerivationFunc selects the
+// default derivation of NewSRP.
+type KDFConstructor func(h HashFunc, params map[string]string) (KeyDerivationFunc, error)
+
+var srp_hashes map[string]HashFunc = map[string]HashFunc{
+	"sha1":   sha1.New,
+	"sha224": sha256.New224,
+	"sha256": sha256.New,
+	"sha384": sha512.New384,
+	"sha512": sha512.New,
+}
+
+var srp_kdfs map[string]KDFConstructor = map[string]KDFConstructor{
+	"default": func(h HashFunc, params map[string]string) (KeyDerivationFunc, error) {
+		return nil, nil
+	},
+	"pbkdf2": func(h HashFunc, params map[string]string) (KeyDerivationFunc, error) {
+		iter, err := intParam(params, ParamIter, DefaultPBKDF2Iter)
+		if err != nil {
+			return nil, err
+		}
+		if iter < 1 || iter > MaxPBKDF2Iter {
+			return nil, fmt.Errorf("Invalid %s: %d", ParamIter, iter)
+		}
+		return pbkdf2.NewPBKDF2(iter, h), nil
+	},
+	"scrypt": func(h HashFunc, params map[string]string) (KeyDerivationFunc, error) {
+		N, err := intParam(params, ParamScryptN, DefaultScryptN)
+		if err != nil {
+			return nil, err
+		}
+		r, err := intParam(params, ParamScryptR, DefaultScryptR)
+		if err != nil {
+			return nil, err
+		}
+		p, err := intParam(params, ParamScryptP, DefaultScryptP)
+		if err != nil {
+			return nil, err
+		}
+		if r < 1 || p < 1 || p > MaxScryptP {
+			return nil, fmt.Errorf("Invalid scrypt parameters: r=%d p=%d", r, p)
+		}
+		if N > MaxScryptMemory/128/r {
+			return nil, fmt.Errorf("Invalid scrypt parameters: N=%d r=%d needs too much memory", N, r)
+		}
+		return scrypt.NewScrypt(N, r, p)
+	},
+}
+
+func intParam(params map[string]string, name string, def int) (int, error) {
+	v, ok := params[name]
+	if !ok {
+		return def, nil
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil {
+		return 0, fmt.Errorf("Invalid %s: %s", name, v)
+	}
+	return n, nil
+}
+
+// NewSRPWithParams creates a new SRP context for the group using the hash, KDF
+// and profile named by params. Unknown parameters are rejected so that a
+// typo cannot silently select a default. A *PolicyError is returned if the
+// configuration is not allowed by the policy set with SetPolicy.
+func NewSRPWithParams(group string, params map[string]string) (*SRP, error) {
+	for k := range params {
+		switch k {
+		case ParamHash, ParamKDF, ParamIter, ParamScryptN, ParamScryptR, ParamScryptP, ParamProfile:
+		default:
+			return nil, fmt.Errorf("Unknown parameter: %s", k)
+		}
+	}
+
+	hname := params[ParamHash]
+	if hname == "" {
+		hname = DefaultHash
+	}
+	h, err := GetHash(hname)
+	if err != nil {
+		return nil, err
+	}
+
+	kname := params[ParamKDF]
+	if kname == "" {
+		kname = "default"
+	}
+	kc, ok := srp_kdfs[kname]
+	if !ok {
+		return nil, fmt.Errorf("Invalid KDF: %s", kname)
+	}
+	kd, err := kc(h, params)
+	if err != nil {
+		return nil, err
+	}
+
+	s, err := NewSRP(group, h, kd)
+	if err != nil {
+		return nil, err
+	}
+	if pname := params[ParamProfile]; pname != "" {
+		if s.Profile, err = GetProfile(pname); err != nil {
+			return nil, err
+		}
+	}
+	if err := srp_policy.checkParams(kname, params, s.Profile); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// GetHash retrieves a registered hash function.
+// The pre-registered hashes are: sha1, sha224, sha256, sha384 and sha512.
+// This function must be called by only one goroutine at a time.
+func GetHash(name string) (HashFunc, error) {
+	h, ok := srp_hashes[name]
+	if !ok {
+		return nil, fmt.Errorf("Invalid Hash: %s", name)
+	}
+	return h, nil
+}
+
+// RegisterHash will register a hash function for use with NewSRPWithParams.
+// This function must be called by only one goroutine at a time.
+func RegisterHash(name string, h HashFunc) {
+	srp_hashes[name] = h
+}
+
+// RegisterKDF will register a key derivation function constructor for use
+// with NewSRPWithParams. The constructor should reject invalid parameters.
+// This function must be called by only one goroutine at a time.
+func RegisterKDF(name string, kc KDFConstructor) {
+	srp_kdfs[name] = kc
+}
+
+// GroupNames returns the sorted names of the registered groups.
+// This function must be called by only one goroutine at a time.
+func GroupNames() []string {
+	names := make([]string, 0, len(srp_groups))
+	for name := range srp_groups {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// ProfileNames returns the sorted names of the registered profiles.
+// This function must be called by only one goroutine at a time.
+func ProfileNames() []string {
+	names := make([]string, 0, len(srp_profiles))
+	for name := range srp_profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,86 @@
+// Copyright 2013 Tad Glines
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+package srp
+
+import (
+	"bytes"
+	"crypto/sha512"
+	"github.com/lann/go-pkgs/crypto/srp/pbkdf2"
+	"testing"
+)
+
+func TestNewSRPWithParams(t *testing.T) {
+	s, err := NewSRPWithParams("rfc5054.1024", map[string]string{
+		ParamHash: "sha512",
+		ParamKDF:  "pbkdf2",
+		ParamIter: "10",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.HashFunc().Size() != sha512.Size {
+		t.Fatalf("Expected a hash size of %d, got %d", sha512.Size, s.HashFunc().Size())
+	}
+	salt, password := []byte("salt"), []byte("password")
+	expected := pbkdf2.NewPBKDF2(10, sha512.New)(salt, password)
+	if !bytes.Equal(s.KeyDerivationFunc(salt, password), expected) {
+		t.Fatal("The KDF does not match pbkdf2.NewPBKDF2")
+	}
+
+	s, err = NewSRPWithParams("rfc5054.1024", map[string]string{ParamProfile: "pysrp"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Profile == nil || s.Profile.Name != "pysrp" {
+		t.Fatal("Profile was not set")
+	}
+
+	invalid := []map[string]string{
+		{ParamHash: "md5"},
+		{ParamKDF: "bcrypt"},
+		{ParamKDF: "pbkdf2", ParamIter: "0"},
+		{ParamKDF: "pbkdf2", ParamIter: "2147483647"},
+		{ParamKDF: "pbkdf2", ParamIter: "many"},
+		{ParamKDF: "scrypt", ParamScryptN: "1000"},
+		{ParamKDF: "scrypt", ParamScryptP: "0"},
+		{ParamKDF: "scrypt", ParamScryptN: "2", ParamScryptR: "1", ParamScryptP: "268435456"},
+		{ParamKDF: "scrypt", ParamScryptN: "1048576", ParamScryptR: "16"},
+		{ParamProfile: "unknown"},
+		{"itr": "10"},
+	}
+	for _, params := range invalid {
+		if _, err := NewSRPWithParams("rfc5054.1024", params); err == nil {
+			t.Errorf("Expected %v to be rejected", params)
+		}
+	}
+	if _, err := NewSRPWithParams("unknown", nil); err == nil {
+		t.Error("Expected an unknown group to be rejected")
+	}
+}
+
+func TestNames(t *testing.T) {
+	groups := GroupNames()
+	if len(groups) != len(srp_groups) {
+		t.Fatalf("Expected %d groups, got %d", len(srp_groups), len(groups))
+	}
+	for i := 1; i < len(groups); i++ {
+		if groups[i-1] >= groups[i] {
+			t.Fatalf("Group names are not sorted: %v", groups)
+		}
+	}
+	if len(ProfileNames()) != len(srp_profiles) {
+		t.Fatalf("Expected %d profiles, got %d", len(srp_profiles), len(ProfileNames()))
+	}
+}
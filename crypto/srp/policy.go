@@ -0,0 +1,123 @@
+// Copyright 2013 Tad Glines
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+package srp
+
+/*
+	A Policy restricts the configurations NewSRP and NewSRPWithParams
+	accept, for deployments that may only use approved algorithms. It
+	applies to every SRP created after SetPolicy, including those of
+	verifier records, so records using a configuration that is no longer
+	allowed fail to load. Sessions of existing SRP instances are not
+	affected.
+
+	ApprovedPolicy rejects SHA-1, groups under 2048 bits, deriving x with a
+	single hash (the default KDF of NewSRP and the profiles, which define
+	their own x, except those with UsesKDF set) and PBKDF2 with fewer
+	than DefaultPBKDF2Iter iterations. It is meant to be set once at
+	startup, after SelfTest has passed.
+*/
+
+import (
+	"fmt"
+	"strconv"
+)
+
+// Rules of a PolicyError.
+const (
+	RuleHash       = "hash"
+	RuleGroupSize  = "group size"
+	RuleKDF        = "kdf"
+	RulePBKDF2Iter = "pbkdf2 iterations"
+)
+
+// PolicyError is returned when a configuration is not allowed by the policy.
+type PolicyError struct {
+	Rule  string // One of the Rule constants
+	Value string // The rejected hash, group, KDF or iteration count
+}
+
+func (e *PolicyError) Error() string {
+	return fmt.Sprintf("Not allowed by the policy (%s): %s", e.Rule, e.Value)
+}
+
+// Policy lists the rules checked when an SRP is created.
+type Policy struct {
+	DeniedHashes  []string // Names of registered hashes that are rejected
+	MinGroupSize  int      // Minimum size of N in bits
+	RequireKDF    bool     // Reject deriving x with a single hash
+	MinPBKDF2Iter int      // Minimum iteration count of the pbkdf2 KDF
+}
+
+// ApprovedPolicy only allows approved algorithms.
+var ApprovedPolicy = &Policy{
+	DeniedHashes:  []string{"sha1"},
+	MinGroupSize:  2048,
+	RequireKDF:    true,
+	MinPBKDF2Iter: DefaultPBKDF2Iter,
+}
+
+var srp_policy *Policy
+
+// SetPolicy makes NewSRP and NewSRPWithParams reject the configurations not
+// allowed by p. A nil policy allows every configuration, which is the
+// default.
+// This function must be called by only one goroutine at a time.
+func SetPolicy(p *Policy) {
+	srp_policy = p
+}
+
+// GetPolicy returns the policy set with SetPolicy.
+// This function must be called by only one goroutine at a time.
+func GetPolicy() *Policy {
+	return srp_policy
+}
+
+// check applies the rules that NewSRP can check. It does nothing on a nil
+// Policy.
+func (p *Policy) check(group string, h HashFunc, kd KeyDerivationFunc) error {
+	if p == nil {
+		return nil
+	}
+	for _, name := range p.DeniedHashes {
+		denied, ok := srp_hashes[name]
+		if ok && fmt.Sprintf("%T", h()) == fmt.Sprintf("%T", denied()) && h().Size() == denied().Size() {
+			return &PolicyError{RuleHash, name}
+		}
+	}
+	if grp, ok := srp_groups[group]; ok && grp.Prime.BitLen() < p.MinGroupSize {
+		return &PolicyError{RuleGroupSize, fmt.Sprintf("%s has %d bits", group, grp.Prime.BitLen())}
+	}
+	if p.RequireKDF && kd == nil {
+		return &PolicyError{RuleKDF, "default"}
+	}
+	return nil
+}
+
+// checkParams applies the rules on the parameters of NewSRPWithParams.
+func (p *Policy) checkParams(kdf string, params map[string]string, profile *Profile) error {
+	if p == nil {
+		return nil
+	}
+	if p.RequireKDF && profile != nil && profile.ComputeX != nil && !profile.UsesKDF {
+		return &PolicyError{RuleKDF, "profile " + profile.Name}
+	}
+	if kdf == "pbkdf2" {
+		iter, err := intParam(params, ParamIter, DefaultPBKDF2Iter)
+		if err == nil && iter < p.MinPBKDF2Iter {
+			return &PolicyError{RulePBKDF2Iter, strconv.Itoa(iter)}
+		}
+	}
+	return nil
+}
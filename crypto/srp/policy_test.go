@@ -0,0 +1,64 @@
+// Copyright 2013 Tad Glines
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+package srp
+
+import (
+	"crypto/sha1"
+	"crypto/sha256"
+	"testing"
+)
+
+func TestPolicy(t *testing.T) {
+	SetPolicy(ApprovedPolicy)
+	defer SetPolicy(nil)
+
+	kd := func(salt, password []byte) []byte { return nil }
+	if _, err := NewSRP("rfc5054.2048", sha256.New, kd); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewSRPWithParams("rfc5054.3072", map[string]string{ParamKDF: "pbkdf2", ParamIter: "10000"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewSRPWithParams("rfc5054.2048", map[string]string{ParamKDF: "pbkdf2", ParamProfile: "tuple"}); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, test := range []struct {
+		name string
+		new  func() (*SRP, error)
+		rule string
+	}{
+		{"sha1", func() (*SRP, error) { return NewSRP("rfc5054.2048", sha1.New, kd) }, RuleHash},
+		{"group", func() (*SRP, error) { return NewSRP("rfc5054.1024", sha256.New, kd) }, RuleGroupSize},
+		{"default kdf", func() (*SRP, error) { return NewSRP("rfc5054.2048", sha256.New, nil) }, RuleKDF},
+		{"params", func() (*SRP, error) { return NewSRPWithParams("rfc5054.2048", nil) }, RuleKDF},
+		{"profile", func() (*SRP, error) {
+			return NewSRPWithParams("rfc5054.2048", map[string]string{ParamProfile: "pysrp"})
+		}, RuleKDF},
+		{"iterations", func() (*SRP, error) {
+			return NewSRPWithParams("rfc5054.2048", map[string]string{ParamKDF: "pbkdf2", ParamIter: "1000"})
+		}, RulePBKDF2Iter},
+	} {
+		_, err := test.new()
+		if err, ok := err.(*PolicyError); !ok || err.Rule != test.rule {
+			t.Errorf("%s: expected a %q PolicyError, got %v", test.name, test.rule, err)
+		}
+	}
+
+	SetPolicy(nil)
+	if _, err := NewSRP("rfc5054.1024", sha1.New, nil); err != nil {
+		t.Fatal(err)
+	}
+}
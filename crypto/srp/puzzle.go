@@ -0,0 +1,374 @@
+// Copyright 2013 Tad Glines
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+package srp
+
+/*
+	Client puzzles make a client spend work before a server performs the
+	exponentiation of NewServerSession, which is expensive for large groups.
+
+	When a PuzzleIssuer requires puzzles (its difficulty is above 0) a
+	server answers a ClientHello without a valid solution with a
+	PuzzleChallenge instead of a ServerChallenge:
+
+		client                            server
+		ClientHello{I, A}         ->
+		                          <-      PuzzleChallenge{seed, d, expires, mac}
+		ClientHello{I, A, solution} ->
+		                          <-      ServerChallenge{s, B, group, params}
+
+	A solution is a nonce such that
+
+		SHA-256(label | seed | d | expires | len(I) | I | len(A) | A | nonce)
+
+	starts with d zero bits, where label is "SRP client puzzle", d is one
+	byte, expires is a big endian uint64 Unix time and the lengths are big
+	endian uint16. Finding one takes 2^d hashes on average and checking it
+	takes one.
+
+	The server keeps no state between the two hellos: the challenge is
+	authenticated with an HMAC keyed by a secret of the issuer. Without a
+	ReplayCache a solution can be used again until it expires, so TTL
+	should be short. Solutions of puzzles easier than the current
+	difficulty are refused, so raising the difficulty under load applies
+	at once to the puzzles issued before.
+*/
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math/bits"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// MaxPuzzleDifficulty is the hardest puzzle that Solve will attempt, so
+	// that a server cannot make a client work forever.
+	MaxPuzzleDifficulty = 32
+	DefaultPuzzleTTL    = 30 * time.Second
+	puzzleSeedSize      = 16
+	puzzleLabel         = "SRP client puzzle"
+)
+
+var (
+	ErrPuzzleRequired = errors.New("Puzzle required")
+	ErrPuzzleInvalid  = errors.New("Puzzle not issued by this server")
+	ErrPuzzleExpired  = errors.New("Puzzle expired")
+	ErrPuzzleReplayed = errors.New("Puzzle solution already used")
+	ErrPuzzleWrong    = errors.New("Puzzle solution is not valid")
+	ErrPuzzleTooEasy  = errors.New("Puzzle easier than the current difficulty")
+)
+
+// PuzzleChallenge is a puzzle issued by a server. Expires is a Unix time.
+type PuzzleChallenge struct {
+	Seed       []byte `json:"seed"`
+	Difficulty int    `json:"difficulty"`
+	Expires    int64  `json:"expires"`
+	MAC        []byte `json:"mac"`
+}
+
+// PuzzleSolution is a PuzzleChallenge together with a nonce solving it.
+type PuzzleSolution struct {
+	PuzzleChallenge
+	Nonce []byte `json:"nonce"`
+}
+
+// Solve finds a solution of the puzzle for a ClientHello with the username
+// and A.
+func (c *PuzzleChallenge) Solve(username, A []byte) (*PuzzleSolution, error) {
+	if c.Difficulty < 0 || c.Difficulty > MaxPuzzleDifficulty {
+		return nil, fmt.Errorf("Puzzle difficulty out of range: %d", c.Difficulty)
+	}
+	h := sha256.New()
+	c.writeHash(h, username, A)
+	prefix := h.Sum(nil)
+	nonce := make([]byte, 8)
+	for n := uint64(0); ; n++ {
+		binary.BigEndian.PutUint64(nonce, n)
+		if zeroBits(puzzleHash(prefix, nonce)) >= c.Difficulty {
+			return &PuzzleSolution{PuzzleChallenge: *c, Nonce: nonce}, nil
+		}
+	}
+}
+
+// writeHash writes everything but the nonce to the hash of a solution.
+func (c *PuzzleChallenge) writeHash(w io.Writer, username, A []byte) {
+	var buf [8]byte
+	io.WriteString(w, puzzleLabel)
+	w.Write(c.Seed)
+	w.Write([]byte{byte(c.Difficulty)})
+	binary.BigEndian.PutUint64(buf[:], uint64(c.Expires))
+	w.Write(buf[:])
+	binary.BigEndian.PutUint16(buf[:], uint16(len(username)))
+	w.Write(buf[:2])
+	w.Write(username)
+	binary.BigEndian.PutUint16(buf[:], uint16(len(A)))
+	w.Write(buf[:2])
+	w.Write(A)
+}
+
+// puzzleHash completes the hash of a solution. Hashing the state of
+// writeHash again keeps the cost of a try independent of the size of A.
+func puzzleHash(prefix, nonce []byte) []byte {
+	h := sha256.New()
+	h.Write(prefix)
+	h.Write(nonce)
+	return h.Sum(nil)
+}
+
+// zeroBits returns the number of leading zero bits of b.
+func zeroBits(b []byte) int {
+	n := 0
+	for _, c := range b {
+		if c != 0 {
+			return n + bits.LeadingZeros8(c)
+		}
+		n += 8
+	}
+	return n
+}
+
+// MarshalBinary encodes the message using the binary encoding.
+func (c *PuzzleChallenge) MarshalBinary() ([]byte, error) {
+	w := newMsgWriter(msgPuzzleChallenge)
+	c.writeFields(w)
+	return w.bytes()
+}
+
+// UnmarshalBinary decodes a message in the binary encoding.
+func (c *PuzzleChallenge) UnmarshalBinary(data []byte) error {
+	r := newMsgReader(data, msgPuzzleChallenge)
+	c.readFields(r)
+	return r.done()
+}
+
+func (c *PuzzleChallenge) writeFields(w *msgWriter) {
+	if c.Difficulty < 0 || c.Difficulty > 0xff {
+		w.err = fmt.Errorf("Puzzle difficulty out of range: %d", c.Difficulty)
+		return
+	}
+	var expires [8]byte
+	binary.BigEndian.PutUint64(expires[:], uint64(c.Expires))
+	w.field(c.Seed)
+	w.field([]byte{byte(c.Difficulty)})
+	w.field(expires[:])
+	w.field(c.MAC)
+}
+
+func (c *PuzzleChallenge) readFields(r *msgReader) {
+	c.Seed = r.field()
+	d := r.field()
+	expires := r.field()
+	c.MAC = r.field()
+	if r.err != nil {
+		return
+	}
+	if len(d) != 1 || len(expires) != 8 {
+		r.err = fmt.Errorf("Invalid puzzle encoding")
+		return
+	}
+	c.Difficulty = int(d[0])
+	c.Expires = int64(binary.BigEndian.Uint64(expires))
+}
+
+// SolvePuzzle solves c for the hello and stores the solution in m.Puzzle.
+func (m *ClientHello) SolvePuzzle(c *PuzzleChallenge) error {
+	sol, err := c.Solve(m.Username, m.A)
+	if err != nil {
+		return err
+	}
+	m.Puzzle = sol
+	return nil
+}
+
+// ReplayCache remembers puzzle solutions until they expire.
+// Implementations must be safe for concurrent use.
+type ReplayCache interface {
+	// Seen returns true if key was added before and has not expired at
+	// now, and adds it otherwise. now is the time of the issuer.
+	Seen(key []byte, now, expires time.Time) bool
+}
+
+// PuzzleIssuer issues and checks puzzles. The difficulty is changed with
+// SetDifficulty or Adjust while the issuer is in use; the other fields must
+// not be changed once it is in use. Instances of PuzzleIssuer are safe for
+// concurrent use.
+type PuzzleIssuer struct {
+	TTL           time.Duration
+	MinDifficulty int
+	MaxDifficulty int
+	Replays       ReplayCache      // If set, each solution is accepted once
+	Now           func() time.Time // Defaults to time.Now
+	key           []byte
+	difficulty    int32
+}
+
+// NewPuzzleIssuer creates a PuzzleIssuer that authenticates its puzzles with
+// key. Servers sharing a key accept each other's puzzles. If key is nil a
+// random key is used. Puzzles are not required until the difficulty is
+// raised.
+func NewPuzzleIssuer(key []byte) *PuzzleIssuer {
+	if key == nil {
+		key = make([]byte, 32)
+		if _, err := io.ReadFull(rand.Reader, key); err != nil {
+			panic(err)
+		}
+	}
+	return &PuzzleIssuer{
+		TTL:           DefaultPuzzleTTL,
+		MaxDifficulty: 20,
+		key:           key,
+	}
+}
+
+// Difficulty returns the difficulty of the puzzles being issued.
+func (p *PuzzleIssuer) Difficulty() int {
+	return int(atomic.LoadInt32(&p.difficulty))
+}
+
+// SetDifficulty sets the difficulty of new puzzles, within MinDifficulty and
+// MaxDifficulty. A difficulty of 0 turns puzzles off.
+func (p *PuzzleIssuer) SetDifficulty(d int) {
+	if d > p.MaxDifficulty {
+		d = p.MaxDifficulty
+	}
+	if d < p.MinDifficulty {
+		d = p.MinDifficulty
+	}
+	atomic.StoreInt32(&p.difficulty, int32(d))
+}
+
+// Adjust sets the difficulty from the load of the server, where 0 is idle
+// and 1 is full: MinDifficulty at 0 rising linearly to MaxDifficulty at 1.
+func (p *PuzzleIssuer) Adjust(load float64) {
+	if load < 0 {
+		load = 0
+	}
+	if load > 1 {
+		load = 1
+	}
+	p.SetDifficulty(p.MinDifficulty + int(load*float64(p.MaxDifficulty-p.MinDifficulty)+0.5))
+}
+
+// Required reports whether hellos must carry a solution.
+func (p *PuzzleIssuer) Required() bool {
+	return p.Difficulty() > 0
+}
+
+// Issue returns a new puzzle at the current difficulty.
+func (p *PuzzleIssuer) Issue() (*PuzzleChallenge, error) {
+	c := &PuzzleChallenge{
+		Seed:       make([]byte, puzzleSeedSize),
+		Difficulty: p.Difficulty(),
+		Expires:    p.now().Add(p.TTL).Unix(),
+	}
+	if _, err := io.ReadFull(rand.Reader, c.Seed); err != nil {
+		return nil, err
+	}
+	c.MAC = p.mac(c)
+	return c, nil
+}
+
+// Check returns nil if the hello may proceed: either puzzles are not
+// required or it carries a valid solution. Otherwise it returns one of the
+// ErrPuzzle errors, and the server should reply with a new puzzle.
+func (p *PuzzleIssuer) Check(hello *ClientHello) error {
+	sol := hello.Puzzle
+	if sol == nil {
+		if p.Required() {
+			return ErrPuzzleRequired
+		}
+		return nil
+	}
+	if !hmac.Equal(sol.MAC, p.mac(&sol.PuzzleChallenge)) {
+		return ErrPuzzleInvalid
+	}
+	now := p.now()
+	expires := time.Unix(sol.Expires, 0)
+	if !now.Before(expires) {
+		return ErrPuzzleExpired
+	}
+	if sol.Difficulty < p.Difficulty() {
+		return ErrPuzzleTooEasy
+	}
+	h := sha256.New()
+	sol.writeHash(h, hello.Username, hello.A)
+	sum := puzzleHash(h.Sum(nil), sol.Nonce)
+	if zeroBits(sum) < sol.Difficulty {
+		return ErrPuzzleWrong
+	}
+	if p.Replays != nil && p.Replays.Seen(sum, now, expires) {
+		return ErrPuzzleReplayed
+	}
+	return nil
+}
+
+func (p *PuzzleIssuer) mac(c *PuzzleChallenge) []byte {
+	var buf [8]byte
+	m := hmac.New(sha256.New, p.key)
+	m.Write(c.Seed)
+	m.Write([]byte{byte(c.Difficulty)})
+	binary.BigEndian.PutUint64(buf[:], uint64(c.Expires))
+	m.Write(buf[:])
+	return m.Sum(nil)
+}
+
+func (p *PuzzleIssuer) now() time.Time {
+	if p.Now != nil {
+		return p.Now()
+	}
+	return time.Now()
+}
+
+// MemoryReplayCache is a ReplayCache for a single server. Expired keys are
+// removed when the cache grows.
+type MemoryReplayCache struct {
+	mu    sync.Mutex
+	keys  map[string]time.Time
+	limit int
+}
+
+// NewMemoryReplayCache creates an empty MemoryReplayCache.
+func NewMemoryReplayCache() *MemoryReplayCache {
+	return &MemoryReplayCache{keys: make(map[string]time.Time), limit: 1024}
+}
+
+// Seen returns true if key was added before and has not expired at now.
+func (c *MemoryReplayCache) Seen(key []byte, now, expires time.Time) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if e, ok := c.keys[string(key)]; ok && !now.After(e) {
+		return true
+	}
+	c.keys[string(key)] = expires
+	if len(c.keys) > c.limit {
+		for k, e := range c.keys {
+			if now.After(e) {
+				delete(c.keys, k)
+			}
+		}
+		c.limit = 2 * len(c.keys)
+		if c.limit < 1024 {
+			c.limit = 1024
+		}
+	}
+	return false
+}
@@ -0,0 +1,219 @@
+// Copyright 2013 Tad Glines
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+package srp
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func newTestPuzzleIssuer() (*PuzzleIssuer, *testClock) {
+	clock := &testClock{time.Date(2013, 1, 1, 0, 0, 0, 0, time.UTC)}
+	p := NewPuzzleIssuer([]byte("test key"))
+	p.Now = clock.now
+	p.SetDifficulty(8)
+	return p, clock
+}
+
+func TestPuzzle(t *testing.T) {
+	p, clock := newTestPuzzleIssuer()
+	hello := &ClientHello{Username: []byte("test"), A: []byte{1, 2, 3}}
+	if err := p.Check(hello); err != ErrPuzzleRequired {
+		t.Fatalf("Expected ErrPuzzleRequired, got %v", err)
+	}
+
+	c, err := p.Issue()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Difficulty != 8 || c.Expires != clock.t.Add(DefaultPuzzleTTL).Unix() {
+		t.Fatalf("Unexpected puzzle: %+v", c)
+	}
+
+	// The challenge and the hello with its solution go over the wire.
+	data, err := c.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	rc := new(PuzzleChallenge)
+	if err := rc.UnmarshalBinary(data); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(c, rc) {
+		t.Fatalf("Binary round trip changed puzzle: %#v != %#v", c, rc)
+	}
+	if err := hello.SolvePuzzle(rc); err != nil {
+		t.Fatal(err)
+	}
+	if data, err = hello.MarshalBinary(); err != nil {
+		t.Fatal(err)
+	}
+	rhello := new(ClientHello)
+	if err := rhello.UnmarshalBinary(data); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(hello, rhello) {
+		t.Fatalf("Binary round trip changed hello: %#v != %#v", hello, rhello)
+	}
+	js, err := json.Marshal(hello)
+	if err != nil {
+		t.Fatal(err)
+	}
+	jhello := new(ClientHello)
+	if err := json.Unmarshal(js, jhello); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(hello, jhello) {
+		t.Fatalf("JSON round trip changed hello: %s", js)
+	}
+
+	if err := p.Check(rhello); err != nil {
+		t.Fatal(err)
+	}
+	// Without a ReplayCache the solution can be used again.
+	if err := p.Check(rhello); err != nil {
+		t.Fatal(err)
+	}
+
+	// The solution is bound to the username and A.
+	other := *rhello
+	other.A = []byte{1, 2, 4}
+	if err := p.Check(&other); err != ErrPuzzleWrong {
+		t.Errorf("Expected ErrPuzzleWrong for another A, got %v", err)
+	}
+	// The difficulty cannot be lowered by the client.
+	easy := *rhello.Puzzle
+	easy.Difficulty = 0
+	other = ClientHello{Username: hello.Username, A: hello.A, Puzzle: &easy}
+	if err := p.Check(&other); err != ErrPuzzleInvalid {
+		t.Errorf("Expected ErrPuzzleInvalid for a changed difficulty, got %v", err)
+	}
+	// Puzzles of another issuer are rejected.
+	if err := NewPuzzleIssuer(nil).Check(rhello); err != ErrPuzzleInvalid {
+		t.Errorf("Expected ErrPuzzleInvalid for another key, got %v", err)
+	}
+
+	clock.t = clock.t.Add(DefaultPuzzleTTL)
+	if err := p.Check(rhello); err != ErrPuzzleExpired {
+		t.Errorf("Expected ErrPuzzleExpired, got %v", err)
+	}
+}
+
+func TestPuzzleReplay(t *testing.T) {
+	p, _ := newTestPuzzleIssuer()
+	p.Replays = NewMemoryReplayCache()
+	c, err := p.Issue()
+	if err != nil {
+		t.Fatal(err)
+	}
+	hello := &ClientHello{Username: []byte("test"), A: []byte{1, 2, 3}}
+	if err := hello.SolvePuzzle(c); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Check(hello); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Check(hello); err != ErrPuzzleReplayed {
+		t.Fatalf("Expected ErrPuzzleReplayed, got %v", err)
+	}
+}
+
+func TestMemoryReplayCache(t *testing.T) {
+	c := NewMemoryReplayCache()
+	now := time.Date(2013, 1, 1, 0, 0, 0, 0, time.UTC)
+	for i := 0; i < 1025; i++ {
+		c.Seen([]byte(fmt.Sprint(i)), now, now.Add(time.Minute))
+	}
+	// The keys expire at the time of the issuer, not at the time of the host.
+	if !c.Seen([]byte("0"), now, now.Add(time.Minute)) {
+		t.Fatal("Expected the key to be remembered")
+	}
+	if c.Seen([]byte("0"), now.Add(2*time.Minute), now.Add(3*time.Minute)) {
+		t.Fatal("Expected the key to have expired")
+	}
+}
+
+func TestPuzzleRaisedDifficulty(t *testing.T) {
+	p, _ := newTestPuzzleIssuer()
+	c, err := p.Issue()
+	if err != nil {
+		t.Fatal(err)
+	}
+	hello := &ClientHello{Username: []byte("test"), A: []byte{1, 2, 3}}
+	if err := hello.SolvePuzzle(c); err != nil {
+		t.Fatal(err)
+	}
+
+	// Puzzles issued before the difficulty was raised are refused.
+	p.SetDifficulty(12)
+	if err := p.Check(hello); err != ErrPuzzleTooEasy {
+		t.Fatalf("Expected ErrPuzzleTooEasy, got %v", err)
+	}
+	// Harder puzzles are still accepted after the difficulty is lowered.
+	p.SetDifficulty(4)
+	if err := p.Check(hello); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestPuzzleDifficulty(t *testing.T) {
+	p := NewPuzzleIssuer(nil)
+	p.MinDifficulty, p.MaxDifficulty = 0, 16
+	hello := &ClientHello{Username: []byte("test"), A: []byte{1}}
+	for load, d := range map[float64]int{-1: 0, 0: 0, 0.5: 8, 1: 16, 2: 16} {
+		p.Adjust(load)
+		if p.Difficulty() != d {
+			t.Errorf("Load %v: expected difficulty %d, got %d", load, d, p.Difficulty())
+		}
+	}
+	p.SetDifficulty(100)
+	if p.Difficulty() != 16 {
+		t.Errorf("Expected the difficulty to be capped, got %d", p.Difficulty())
+	}
+
+	// Puzzles are only required above difficulty 0, but solutions that are
+	// sent anyway are checked.
+	p.SetDifficulty(0)
+	if err := p.Check(hello); err != nil {
+		t.Fatal(err)
+	}
+	hello.Puzzle = &PuzzleSolution{PuzzleChallenge: PuzzleChallenge{Seed: []byte{1}}}
+	if err := p.Check(hello); err != ErrPuzzleInvalid {
+		t.Errorf("Expected ErrPuzzleInvalid, got %v", err)
+	}
+
+	if _, err := (&PuzzleChallenge{Difficulty: MaxPuzzleDifficulty + 1}).Solve(hello.Username, hello.A); err == nil {
+		t.Error("Expected a puzzle above MaxPuzzleDifficulty to be refused")
+	}
+}
+
+func TestZeroBits(t *testing.T) {
+	for _, c := range []struct {
+		b []byte
+		n int
+	}{
+		{[]byte{0x80}, 0},
+		{[]byte{0x01}, 7},
+		{[]byte{0x00, 0x10}, 11},
+		{[]byte{0x00, 0x00}, 16},
+	} {
+		if n := zeroBits(c.b); n != c.n {
+			t.Errorf("zeroBits(%x) = %d, expected %d", c.b, n, c.n)
+		}
+	}
+}
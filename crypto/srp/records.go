@@ -0,0 +1,177 @@
+// Copyright 2013 Tad Glines
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+package srp
+
+import (
+	"bufio"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/big"
+	"strings"
+)
+
+// VerifierRecord is the information a server stores for a user: the salt and
+// verifier together with the group and the parameters (see
+// NewSRPWithParams) that were used to compute them.
+// The binary encoding is the same as that of the handshake messages.
+type VerifierRecord struct {
+	Username []byte            `json:"username"`
+	Group    string            `json:"group"`
+	Params   map[string]string `json:"params,omitempty"`
+	Salt     []byte            `json:"salt"`
+	Verifier []byte            `json:"verifier"`
+}
+
+// ParseVerifierRecord decodes a record from its JSON encoding or from the
+// base64 of its binary encoding.
+func ParseVerifierRecord(line string) (*VerifierRecord, error) {
+	r := new(VerifierRecord)
+	if strings.HasPrefix(line, "{") {
+		if err := json.Unmarshal([]byte(line), r); err != nil {
+			return nil, err
+		}
+		return r, nil
+	}
+	data, err := base64.StdEncoding.DecodeString(line)
+	if err != nil {
+		return nil, err
+	}
+	if err := r.UnmarshalBinary(data); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// ScanVerifierRecords calls fn with each record read from r, where records
+// are stored one per line in either of the encodings accepted by
+// ParseVerifierRecord. Empty lines and lines starting with # are skipped.
+func ScanVerifierRecords(r io.Reader, fn func(lineno int, rec *VerifierRecord, err error)) error {
+	s := bufio.NewScanner(r)
+	s.Buffer(nil, 4*MaxMessageSize)
+	for lineno := 1; s.Scan(); lineno++ {
+		line := strings.TrimSpace(s.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		rec, err := ParseVerifierRecord(line)
+		fn(lineno, rec, err)
+	}
+	return s.Err()
+}
+
+// ReadVerifierRecords reads and validates the records in r, see
+// ScanVerifierRecords. The records are returned by username. The first
+// invalid record is reported as an error.
+func ReadVerifierRecords(r io.Reader) (map[string]*VerifierRecord, error) {
+	records := make(map[string]*VerifierRecord)
+	var rerr error
+	err := ScanVerifierRecords(r, func(lineno int, rec *VerifierRecord, err error) {
+		if err == nil {
+			err = rec.Validate()
+		}
+		if err != nil {
+			if rerr == nil {
+				rerr = fmt.Errorf("line %d: %v", lineno, err)
+			}
+			return
+		}
+		records[string(rec.Username)] = rec
+	})
+	if err != nil {
+		return nil, err
+	}
+	if rerr != nil {
+		return nil, rerr
+	}
+	return records, nil
+}
+
+// NewVerifierRecord computes a new salt and verifier for the user.
+func NewVerifierRecord(group string, params map[string]string, username, password []byte) (*VerifierRecord, error) {
+	s, err := NewSRPWithParams(group, params)
+	if err != nil {
+		return nil, err
+	}
+	salt, v, err := s.ComputeUserVerifier(username, password)
+	if err != nil {
+		return nil, err
+	}
+	return &VerifierRecord{
+		Username: username,
+		Group:    group,
+		Params:   params,
+		Salt:     salt,
+		Verifier: v,
+	}, nil
+}
+
+// NewSRP returns the SRP context described by the record.
+func (r *VerifierRecord) NewSRP() (*SRP, error) {
+	return NewSRPWithParams(r.Group, r.Params)
+}
+
+// NewServerSession is a shortcut for creating the SRP context of the record
+// and a ServerSession for it.
+func (r *VerifierRecord) NewServerSession() (*SRP, *ServerSession, error) {
+	s, err := r.NewSRP()
+	if err != nil {
+		return nil, nil, err
+	}
+	return s, s.NewServerSession(r.Username, r.Salt, r.Verifier), nil
+}
+
+// Validate checks that the parameters of the record are usable and that the
+// verifier is in the range [1, N-1].
+func (r *VerifierRecord) Validate() error {
+	if len(r.Username) == 0 {
+		return fmt.Errorf("Missing username")
+	}
+	if len(r.Salt) == 0 {
+		return fmt.Errorf("Missing salt")
+	}
+	s, err := r.NewSRP()
+	if err != nil {
+		return err
+	}
+	v := new(big.Int).SetBytes(r.Verifier)
+	if v.Sign() == 0 || v.Cmp(s.Group.Prime) >= 0 {
+		return fmt.Errorf("Verifier out of range")
+	}
+	return nil
+}
+
+// MarshalBinary encodes the record using the binary encoding.
+func (r *VerifierRecord) MarshalBinary() ([]byte, error) {
+	w := newMsgWriter(msgVerifierRecord)
+	w.field(r.Username)
+	w.field([]byte(r.Group))
+	w.params(r.Params)
+	w.field(r.Salt)
+	w.field(r.Verifier)
+	return w.bytes()
+}
+
+// UnmarshalBinary decodes a record in the binary encoding.
+func (r *VerifierRecord) UnmarshalBinary(data []byte) error {
+	mr := newMsgReader(data, msgVerifierRecord)
+	r.Username = mr.field()
+	r.Group = string(mr.field())
+	r.Params = mr.params()
+	r.Salt = mr.field()
+	r.Verifier = mr.field()
+	return mr.done()
+}
@@ -0,0 +1,107 @@
+// Copyright 2013 Tad Glines
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+package srp
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestVerifierRecord(t *testing.T) {
+	params := map[string]string{ParamKDF: "pbkdf2", ParamIter: "10"}
+	username, password := []byte("test"), []byte("password")
+	r, err := NewVerifierRecord("rfc5054.1024", params, username, password)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Validate(); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := r.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	r2 := new(VerifierRecord)
+	if err := r2.UnmarshalBinary(data); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(r, r2) {
+		t.Fatalf("Binary round trip changed record: %#v != %#v", r, r2)
+	}
+	js, err := json.Marshal(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r2 = new(VerifierRecord)
+	if err := json.Unmarshal(js, r2); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(r, r2) {
+		t.Fatalf("JSON round trip changed record: %#v != %#v", r, r2)
+	}
+
+	// A client configured from the record's parameters can authenticate.
+	s, ss, err := r.NewServerSession()
+	if err != nil {
+		t.Fatal(err)
+	}
+	cs := s.NewClientSession(username, password)
+	ckey, err := cs.ComputeKey(r.Salt, ss.GetB())
+	if err != nil {
+		t.Fatal(err)
+	}
+	skey, err := ss.ComputeKey(cs.GetA())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(ckey, skey) {
+		t.Fatal("Keys don't match")
+	}
+
+	r.Verifier = s.Group.Prime.Bytes()
+	if r.Validate() == nil {
+		t.Error("Expected a verifier equal to N to be rejected")
+	}
+}
+
+func TestMessageFraming(t *testing.T) {
+	var buf bytes.Buffer
+	in := &ClientProof{M1: []byte{1, 2, 3}}
+	if err := WriteMessage(&buf, in); err != nil {
+		t.Fatal(err)
+	}
+	if err := WriteMessage(&buf, &ServerProof{M2: []byte{4}}); err != nil {
+		t.Fatal(err)
+	}
+	out := new(ClientProof)
+	if err := ReadMessage(&buf, out); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(in, out) {
+		t.Fatalf("Framing changed message: %#v != %#v", in, out)
+	}
+	if err := ReadMessage(&buf, out); err == nil {
+		t.Fatal("Expected a ServerProof to be rejected as a ClientProof")
+	}
+
+	buf.Reset()
+	buf.Write([]byte{0xff, 0xff, 0xff, 0xff})
+	if err := ReadMessage(&buf, out); err == nil {
+		t.Fatal("Expected an oversized message to be rejected")
+	}
+}
@@ -0,0 +1,250 @@
+// Copyright 2013 Tad Glines
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+package srp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"runtime"
+	"sync"
+	"sync/atomic"
+)
+
+// DefaultQueueSize is the number of computations per worker that a
+// Scheduler created with a queue size of 0 will hold.
+const DefaultQueueSize = 16
+
+// OverloadError is returned by a Scheduler whose queue is full.
+type OverloadError struct {
+	Depth int // Computations waiting when the work was rejected
+}
+
+func (e *OverloadError) Error() string {
+	return fmt.Sprintf("Server overloaded: %d computations queued", e.Depth)
+}
+
+// ErrSchedulerClosed is returned for work submitted to a closed Scheduler.
+var ErrSchedulerClosed = errors.New("Scheduler closed")
+
+const (
+	jobQueued = iota
+	jobRunning
+	jobCancelled
+)
+
+type job struct {
+	ctx   context.Context
+	fn    func() error
+	err   error
+	state int32
+	done  chan struct{}
+}
+
+// SchedulerStats are the counters of a Scheduler.
+type SchedulerStats struct {
+	Workers   int    // Size of the pool
+	QueueSize int    // Computations that can wait
+	Queued    int    // Computations waiting now
+	Running   int    // Computations running now
+	Completed uint64 // Computations that ran
+	Rejected  uint64 // Computations refused with an OverloadError
+	Expired   uint64 // Computations whose context ended while they waited
+}
+
+// Scheduler runs the expensive server side computations on a bounded pool of
+// goroutines, so that a burst of logins queues up instead of competing for
+// every CPU. Work waits in the queue until a worker is free or its context
+// is done, whichever comes first, and is rejected with an *OverloadError
+// when the queue is full.
+// Instances of Scheduler are safe for concurrent use.
+type Scheduler struct {
+	workers   int
+	queue     chan *job
+	quit      chan struct{}
+	mu        sync.RWMutex // Held for reading while submitting
+	closed    bool
+	wg        sync.WaitGroup
+	running   int32
+	completed uint64
+	rejected  uint64
+	expired   uint64
+}
+
+// NewScheduler starts a Scheduler with the given number of workers and
+// queue size. If workers is 0 or less GOMAXPROCS workers are used, and if
+// queueSize is 0 or less DefaultQueueSize computations per worker may wait.
+// Close must be called to stop the workers.
+func NewScheduler(workers, queueSize int) *Scheduler {
+	if workers <= 0 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+	if queueSize <= 0 {
+		queueSize = DefaultQueueSize * workers
+	}
+	s := &Scheduler{
+		workers: workers,
+		queue:   make(chan *job, queueSize),
+		quit:    make(chan struct{}),
+	}
+	s.wg.Add(workers)
+	for i := 0; i < workers; i++ {
+		go s.work()
+	}
+	return s
+}
+
+func (s *Scheduler) work() {
+	defer s.wg.Done()
+	for {
+		// Leave queued work to Close once it has been called.
+		select {
+		case <-s.quit:
+			return
+		default:
+		}
+		select {
+		case j := <-s.queue:
+			s.run(j)
+		case <-s.quit:
+			return
+		}
+	}
+}
+
+func (s *Scheduler) run(j *job) {
+	if !atomic.CompareAndSwapInt32(&j.state, jobQueued, jobRunning) {
+		// Do has returned already.
+		return
+	}
+	if err := j.ctx.Err(); err != nil {
+		atomic.AddUint64(&s.expired, 1)
+		j.err = err
+		close(j.done)
+		return
+	}
+	atomic.AddInt32(&s.running, 1)
+	j.err = j.fn()
+	atomic.AddInt32(&s.running, -1)
+	atomic.AddUint64(&s.completed, 1)
+	close(j.done)
+}
+
+// Do runs fn on a worker and returns its error. It returns an
+// *OverloadError at once if the queue is full, and ctx.Err() if ctx is done
+// before a worker picks fn up. Once fn has started Do waits for it to
+// return, so that fn never runs concurrently with the caller.
+func (s *Scheduler) Do(ctx context.Context, fn func() error) error {
+	j := &job{ctx: ctx, fn: fn, done: make(chan struct{})}
+	s.mu.RLock()
+	if s.closed {
+		s.mu.RUnlock()
+		return ErrSchedulerClosed
+	}
+	select {
+	case s.queue <- j:
+		s.mu.RUnlock()
+	default:
+		s.mu.RUnlock()
+		atomic.AddUint64(&s.rejected, 1)
+		return &OverloadError{Depth: len(s.queue)}
+	}
+
+	select {
+	case <-j.done:
+		return j.err
+	case <-ctx.Done():
+		if atomic.CompareAndSwapInt32(&j.state, jobQueued, jobCancelled) {
+			atomic.AddUint64(&s.expired, 1)
+			return ctx.Err()
+		}
+		<-j.done
+		return j.err
+	}
+}
+
+// NewServerSession creates a ServerSession on a worker, see Do.
+func (s *Scheduler) NewServerSession(ctx context.Context, srp *SRP, username, salt, verifier []byte) (*ServerSession, error) {
+	var ss *ServerSession
+	err := s.Do(ctx, func() error {
+		ss = srp.NewServerSession(username, salt, verifier)
+		return nil
+	})
+	return ss, err
+}
+
+// ComputeKey runs ss.ComputeKey on a worker, see Do.
+func (s *Scheduler) ComputeKey(ctx context.Context, ss *ServerSession, A []byte) ([]byte, error) {
+	var K []byte
+	err := s.Do(ctx, func() (err error) {
+		K, err = ss.ComputeKey(A)
+		return
+	})
+	return K, err
+}
+
+// ComputeUserVerifier runs srp.ComputeUserVerifier, which is dominated by
+// the key derivation function, on a worker, see Do.
+func (s *Scheduler) ComputeUserVerifier(ctx context.Context, srp *SRP, username, password []byte) (salt, verifier []byte, err error) {
+	err = s.Do(ctx, func() (err error) {
+		salt, verifier, err = srp.ComputeUserVerifier(username, password)
+		return
+	})
+	return
+}
+
+// QueueDepth returns the number of computations waiting for a worker,
+// including those whose context ended but have not been dropped yet.
+func (s *Scheduler) QueueDepth() int {
+	return len(s.queue)
+}
+
+// Stats returns the current counters of the scheduler.
+func (s *Scheduler) Stats() SchedulerStats {
+	return SchedulerStats{
+		Workers:   s.workers,
+		QueueSize: cap(s.queue),
+		Queued:    len(s.queue),
+		Running:   int(atomic.LoadInt32(&s.running)),
+		Completed: atomic.LoadUint64(&s.completed),
+		Rejected:  atomic.LoadUint64(&s.rejected),
+		Expired:   atomic.LoadUint64(&s.expired),
+	}
+}
+
+// Close stops accepting work, waits for running computations and fails the
+// queued ones with ErrSchedulerClosed. Close may be called more than once.
+func (s *Scheduler) Close() {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return
+	}
+	s.closed = true
+	s.mu.Unlock()
+	close(s.quit)
+	s.wg.Wait()
+	for {
+		select {
+		case j := <-s.queue:
+			if atomic.CompareAndSwapInt32(&j.state, jobQueued, jobRunning) {
+				j.err = ErrSchedulerClosed
+				close(j.done)
+			}
+		default:
+			return
+		}
+	}
+}
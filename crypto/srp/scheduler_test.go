@@ -0,0 +1,166 @@
+// Copyright 2013 Tad Glines
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+package srp
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"runtime"
+	"testing"
+	"time"
+)
+
+// block occupies the only worker of s until the returned channel is closed.
+func block(t *testing.T, s *Scheduler) chan struct{} {
+	started, release := make(chan struct{}), make(chan struct{})
+	go s.Do(context.Background(), func() error {
+		close(started)
+		<-release
+		return nil
+	})
+	<-started
+	return release
+}
+
+func TestSchedulerOverload(t *testing.T) {
+	s := NewScheduler(1, 1)
+	defer s.Close()
+	release := block(t, s)
+
+	queued := make(chan error)
+	go func() {
+		queued <- s.Do(context.Background(), func() error { return nil })
+	}()
+	for s.QueueDepth() != 1 {
+		time.Sleep(time.Millisecond)
+	}
+	err := s.Do(context.Background(), func() error {
+		t.Error("Rejected work was run")
+		return nil
+	})
+	if oerr, ok := err.(*OverloadError); !ok || oerr.Depth != 1 {
+		t.Fatalf("Expected an *OverloadError, got %v", err)
+	}
+
+	close(release)
+	if err := <-queued; err != nil {
+		t.Fatal(err)
+	}
+	st := s.Stats()
+	if st.Workers != 1 || st.QueueSize != 1 || st.Completed != 2 || st.Rejected != 1 || st.Queued != 0 {
+		t.Fatalf("Unexpected stats: %+v", st)
+	}
+}
+
+func TestSchedulerDeadline(t *testing.T) {
+	s := NewScheduler(1, 4)
+	defer s.Close()
+	release := block(t, s)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	ran := false
+	err := s.Do(ctx, func() error {
+		ran = true
+		return nil
+	})
+	if err != context.DeadlineExceeded {
+		t.Fatalf("Expected context.DeadlineExceeded, got %v", err)
+	}
+	close(release)
+
+	// The expired work is dropped once a worker reaches it.
+	if err := s.Do(context.Background(), func() error { return nil }); err != nil {
+		t.Fatal(err)
+	}
+	if ran {
+		t.Fatal("Expired work was run")
+	}
+	if st := s.Stats(); st.Expired != 1 || st.Completed != 2 {
+		t.Fatalf("Unexpected stats: %+v", st)
+	}
+}
+
+func TestSchedulerClose(t *testing.T) {
+	s := NewScheduler(1, 1)
+	release := block(t, s)
+	queued := make(chan error)
+	go func() {
+		queued <- s.Do(context.Background(), func() error { return nil })
+	}()
+	for s.QueueDepth() != 1 {
+		time.Sleep(time.Millisecond)
+	}
+
+	closed := make(chan struct{})
+	go func() {
+		s.Close()
+		close(closed)
+	}()
+	// Close waits for the running computation.
+	select {
+	case <-closed:
+		t.Fatal("Close returned while work was running")
+	case <-time.After(10 * time.Millisecond):
+	}
+	close(release)
+	<-closed
+	if err := <-queued; err != ErrSchedulerClosed {
+		t.Fatalf("Expected ErrSchedulerClosed for queued work, got %v", err)
+	}
+	if err := s.Do(context.Background(), func() error { return nil }); err != ErrSchedulerClosed {
+		t.Fatalf("Expected ErrSchedulerClosed, got %v", err)
+	}
+	s.Close()
+}
+
+func TestSchedulerSession(t *testing.T) {
+	s := NewScheduler(0, 0)
+	defer s.Close()
+	if st := s.Stats(); st.Workers != runtime.GOMAXPROCS(0) || st.QueueSize != DefaultQueueSize*st.Workers {
+		t.Fatalf("Unexpected defaults: %+v", st)
+	}
+
+	srp, err := NewSRP("rfc5054.1024", sha256.New, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	username, password := []byte("test"), []byte("password")
+	salt, v, err := s.ComputeUserVerifier(ctx, srp, username, password)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ss, err := s.NewServerSession(ctx, srp, username, salt, v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cs := srp.NewClientSession(username, password)
+	skey, err := s.ComputeKey(ctx, ss, cs.GetA())
+	if err != nil {
+		t.Fatal(err)
+	}
+	ckey, err := cs.ComputeKey(salt, ss.GetB())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(skey, ckey) {
+		t.Fatal("Keys do not match")
+	}
+	if _, err := s.ComputeKey(ctx, srp.NewServerSession(username, salt, v), []byte{0}); err == nil {
+		t.Fatal("Expected the error of ComputeKey to be returned")
+	}
+}
@@ -0,0 +1,259 @@
+// Copyright 2013 Tad Glines
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+package srp
+
+/*
+	SelfTest checks that the module computes what it should before it is
+	relied upon:
+
+		hashes     the digest of "abc" for every registered hash with a
+		           known answer (those registered by the package)
+		kdfs       RFC 6070 for pbkdf2 and RFC 7914 for scrypt
+		sessions   the vectors of RFC 5054 appendix B, computed by a
+		           ClientSession and a ServerSession with the given a and b
+		groups     for every registered group, that N is odd, has the
+		           registered size and passes a Fermat test to base g, and
+		           that the sessions of a handshake agree with math/big
+
+	The tests only use public values and do not depend on the policy.
+*/
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"github.com/lann/go-pkgs/crypto/srp/pbkdf2"
+	"github.com/lann/go-pkgs/crypto/srp/scrypt"
+	"math/big"
+	"sort"
+)
+
+// SelfTestError is returned by SelfTest.
+type SelfTestError struct {
+	Test string // The failed test, such as "hash sha256" or "group rfc5054.2048"
+	Err  error
+}
+
+func (e *SelfTestError) Error() string {
+	return fmt.Sprintf("Self-test %s failed: %v", e.Test, e.Err)
+}
+
+// Digests of "abc".
+var selfTestHashes = map[string]string{
+	"sha1":   "a9993e364706816aba3e25717850c26c9cd0d89d",
+	"sha224": "23097d223405d8228642a477bda255b32aadbce4bda0b3f7e36c9da7",
+	"sha256": "ba7816bf8f01cfea414140de5dae2223b00361a396177a9cb410ff61f20015ad",
+	"sha384": "cb00753f45a35e8bb5a03d699ac65007272c32ab0eded1631a8b605a43ff5bed8086072ba1e7cc2358baeca134c825a7",
+	"sha512": "ddaf35a193617abacc417349ae20413112e6fa4e89a97ea20a9eeee64b55d39a2192992a274fc1a836ba3c23a3feebbd454d4423643ce80e2a9ac94fa54ca49f",
+}
+
+// The vectors of RFC 5054 appendix B, which use SHA-1 and
+// x = H(s | H(I | ":" | P)).
+var selfTestRFC5054 = struct {
+	I, P                      string
+	s, k, x, v, a, b, A, B, u string
+	S                         string
+}{
+	I: "alice",
+	P: "password123",
+	s: "BEB25379D1A8581EB5A727673A2441EE",
+	k: "7556AA045AEF2CDD07ABAF0F665C3E818913186F",
+	x: "94B7555AABE9127CC58CCF4993DB6CF84D16C124",
+	v: "7E273DE8696FFC4F4E337D05B4B375BEB0DDE1569E8FA00A9886D8129BADA1F1822223CA1A605B530E379BA4729FDC59" +
+		"F105B4787E5186F5C671085A1447B52A48CF1970B4FB6F8400BBF4CEBFBB168152E08AB5EA53D15C1AFF87B2B9DA6E04" +
+		"E058AD51CC72BFC9033B564E26480D78E955A5E29E7AB245DB2BE315E2099AFB",
+	a: "60975527035CF2AD1989806F0407210BC81EDC04E2762A56AFD529DDDA2D4393",
+	b: "E487CB59D31AC550471E81F00F6928E01DDA08E974A004F49E61F5D105284D20",
+	A: "61D5E490F6F1B79547B0704C436F523DD0E560F0C64115BB72557EC44352E8903211C04692272D8B2D1A5358A2CF1B6E" +
+		"0BFCF99F921530EC8E39356179EAE45E42BA92AEACED825171E1E8B9AF6D9C03E1327F44BE087EF06530E69F66615261" +
+		"EEF54073CA11CF5858F0EDFDFE15EFEAB349EF5D76988A3672FAC47B0769447B",
+	B: "BD0C61512C692C0CB6D041FA01BB152D4916A1E77AF46AE105393011BAF38964DC46A0670DD125B95A981652236F99D9" +
+		"B681CBF87837EC996C6DA04453728610D0C6DDB58B318885D7D82C7F8DEB75CE7BD4FBAA37089E6F9C6059F388838E7A" +
+		"00030B331EB76840910440B1B27AAEAEEB4012B7D7665238A8E3FB004B117B58",
+	u: "CE38B9593487DA98554ED47D70A7AE5F462EF019",
+	S: "B0DC82BABCF30674AE450C0287745E7990A3381F63B387AAF271A10D233861E359B48220F7C4693C9AE12B0A6F67809F" +
+		"0876E2D013800D6C41BB59B6D5979B5C00A172B4A2A5903A0BDCAF8A709585EB2AFAFA8F3499B200210DCC1F10EB3394" +
+		"3CD67FC88A2F39A4BE5BEC4EC0A3212DC346D7E474B29EDE8A469FFECA686E5A",
+}
+
+type selfTest struct {
+	name string
+	fn   func() error
+}
+
+// SelfTest runs the known-answer tests of the package and returns a
+// *SelfTestError for the first one that fails. It takes up to a few hundred
+// milliseconds, mostly for the largest groups.
+// This function must be called by only one goroutine at a time.
+func SelfTest() error {
+	tests := []selfTest{
+		{"kdf pbkdf2", selfTestPBKDF2},
+		{"kdf scrypt", selfTestScrypt},
+		{"sessions rfc5054", selfTestSessions},
+	}
+	for _, name := range sortedNames(srp_hashes) {
+		if want, ok := selfTestHashes[name]; ok {
+			h := srp_hashes[name]
+			tests = append(tests, selfTest{"hash " + name, func() error { return selfTestHash(h, want) }})
+		}
+	}
+	for _, name := range GroupNames() {
+		grp := srp_groups[name]
+		tests = append(tests, selfTest{"group " + name, func() error { return selfTestGroup(grp) }})
+	}
+	for _, t := range tests {
+		if err := t.fn(); err != nil {
+			return &SelfTestError{t.name, err}
+		}
+	}
+	return nil
+}
+
+func sortedNames(m map[string]HashFunc) []string {
+	names := make([]string, 0, len(m))
+	for name := range m {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func selfTestHash(h HashFunc, want string) error {
+	d := h()
+	d.Write([]byte("abc"))
+	return expectHex("digest", d.Sum(nil), want)
+}
+
+func selfTestPBKDF2() error {
+	// RFC 6070, c = 2
+	k := pbkdf2.NewPBKDF2(2, sha1.New)([]byte("salt"), []byte("password"))
+	return expectHex("key", k, "ea6c014dc72d6f8ccd1ed92ace1d41f0d8de8957")
+}
+
+func selfTestScrypt() error {
+	// RFC 7914, N = 16, r = 1, p = 1, the first 32 bytes
+	kd, err := scrypt.NewScrypt(16, 1, 1)
+	if err != nil {
+		return err
+	}
+	return expectHex("key", kd(nil, nil), "77d6576238657b203b19ca42c18a0497f16b4844e3074ae8dfdffa3fede21442")
+}
+
+func selfTestSessions() error {
+	v := selfTestRFC5054
+	s, err := newSRP("rfc5054.1024", sha1.New, nil)
+	if err != nil {
+		return err
+	}
+	s.Profile = &Profile{Name: "rfc5054", ComputeX: bouncycastle_profile.ComputeX}
+	I, P, salt := []byte(v.I), []byte(v.P), mustHex(v.s)
+	if err := expectHex("k", s.get_k().Bytes(), v.k); err != nil {
+		return err
+	}
+	x := s.compute_x(I, salt, P)
+	if err := expectHex("x", x.Bytes(), v.x); err != nil {
+		return err
+	}
+	verifier := s.Group.exp(x, s.x_bits(x)).Bytes()
+	if err := expectHex("v", verifier, v.v); err != nil {
+		return err
+	}
+
+	a, b := new(big.Int).SetBytes(mustHex(v.a)), new(big.Int).SetBytes(mustHex(v.b))
+	cs := s.newClientSession(I, P, a)
+	ss := s.newServerSession(I, salt, verifier, &ephemeral{b: b, gb: s.Group.expMont(b, int(s.ABSize))})
+	if err := expectHex("A", cs.GetA(), v.A); err != nil {
+		return err
+	}
+	if err := expectHex("B", ss.GetB(), v.B); err != nil {
+		return err
+	}
+	if _, err := ss.ComputeKey(cs.GetA()); err != nil {
+		return err
+	}
+	if _, err := cs.ComputeKey(salt, ss.GetB()); err != nil {
+		return err
+	}
+	if err := expectHex("u", cs._u.Bytes(), v.u); err != nil {
+		return err
+	}
+	if err := expectHex("client S", cs._S.Bytes(), v.S); err != nil {
+		return err
+	}
+	return expectHex("server S", ss._S.Bytes(), v.S)
+}
+
+// selfTestGroup checks grp and runs a handshake with fixed values, checking
+// the premaster secrets against math/big.
+func selfTestGroup(grp *SRPGroup) error {
+	N, g := grp.Prime, grp.Generator
+	if N.Bit(0) == 0 || N.BitLen() != grp.Size {
+		return fmt.Errorf("N is not an odd number of %d bits", grp.Size)
+	}
+	if g.Cmp(big.NewInt(1)) <= 0 || g.Cmp(N) >= 0 {
+		return fmt.Errorf("g is out of range")
+	}
+	Nm1 := new(big.Int).Sub(N, big.NewInt(1))
+	if new(big.Int).Exp(g, Nm1, N).Cmp(big.NewInt(1)) != 0 {
+		return fmt.Errorf("N is not prime")
+	}
+
+	s := &SRP{ABSize: DefaultABSize, HashFunc: srp_hashes[DefaultHash], Group: grp}
+	s.compute_k()
+	s.KeyDerivationFunc = func(salt, password []byte) []byte {
+		return hashBytes(s, salt, password)
+	}
+	I, P, salt := []byte("self-test"), []byte("self-test"), []byte("self-test")
+	a := new(big.Int).SetBytes(hashBytes(s, []byte("a")))
+	b := new(big.Int).SetBytes(hashBytes(s, []byte("b")))
+	x := s.compute_x(I, salt, P)
+	v := new(big.Int).Exp(g, x, N)
+
+	cs := s.newClientSession(I, P, a)
+	ss := s.newServerSession(I, salt, v.Bytes(), &ephemeral{b: b, gb: grp.expMont(b, int(s.ABSize))})
+	if _, err := ss.ComputeKey(cs.GetA()); err != nil {
+		return err
+	}
+	if _, err := cs.ComputeKey(salt, ss.GetB()); err != nil {
+		return err
+	}
+	// S = (A * v^u)^b
+	A := new(big.Int).Exp(g, a, N)
+	S := new(big.Int).Exp(v, ss._u, N)
+	S.Mul(S, A).Mod(S, N).Exp(S, b, N)
+	if cs._S.Cmp(S) != 0 || ss._S.Cmp(S) != 0 {
+		return fmt.Errorf("The premaster secrets do not match")
+	}
+	if !ss.VerifyClientAuthenticator(cs.ComputeAuthenticator()) {
+		return fmt.Errorf("The client authenticator was rejected")
+	}
+	return nil
+}
+
+func mustHex(s string) []byte {
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		panic(err)
+	}
+	return b
+}
+
+func expectHex(name string, got []byte, want string) error {
+	if !bytes.Equal(got, mustHex(want)) {
+		return fmt.Errorf("Unexpected %s: %X", name, got)
+	}
+	return nil
+}
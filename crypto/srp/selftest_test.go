@@ -0,0 +1,36 @@
+// Copyright 2013 Tad Glines
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+package srp
+
+import (
+	"math/big"
+	"testing"
+)
+
+func TestSelfTest(t *testing.T) {
+	if err := SelfTest(); err != nil {
+		t.Fatal(err)
+	}
+
+	// A group whose N is not prime.
+	grp := srp_groups["rfc5054.1024"]
+	N := new(big.Int).Add(grp.Prime, big.NewInt(2))
+	RegisterGroup("broken.1024", &SRPGroup{Size: 1024, Prime: N, Generator: grp.Generator})
+	defer delete(srp_groups, "broken.1024")
+	err, ok := SelfTest().(*SelfTestError)
+	if !ok || err.Test != "group broken.1024" {
+		t.Fatalf("Expected the broken group to fail, got %v", err)
+	}
+}
@@ -14,6 +14,19 @@
 
 // Package srp provides an implementation of SRP-6a as detailed
 // at: http://srp.stanford.edu/design.html
+//
+// The older SRP-6 and SRP-3 (RFC2945) protocols are available through the
+// legacy "srp6" and "srp3" profiles so that existing verifiers can continue to
+// be used. They should not be used for new deployments.
+//
+// Migrating openssl groups: the openssl.* groups used to decode N with the
+// bytes of each 64 bit word reversed, which made N even or not prime. They
+// now use the correct primes, the same as the rfc5054.* group of each size.
+// Verifiers and VerifierRecords created for an openssl group before this
+// change no longer match and those users cannot log in. They must enroll
+// again with a new verifier, preferably for an rfc5054 group, for example
+// after a password reset. SelfTest reports a registered group whose N is
+// even or not prime.
 package srp
 
 import (
@@ -23,6 +36,7 @@ import (
 	"hash"
 	"io"
 	"math/big"
+	"time"
 )
 
 const (
@@ -34,49 +48,97 @@ type KeyDerivationFunc func(salt, password []byte) []byte
 
 type HashFunc func() hash.Hash
 
+// Profile selects the formulas used to compute the multiplier k, the private
+// key x, the scrambling parameter u, the session key K and the authenticators.
+// Profiles exist so that peers built on other SRP implementations, which
+// differ in how these values are hashed and padded, can be talked to.
+// Any nil function falls back to the SRP-6a computation used by this package.
+type Profile struct {
+	Name                string
+	Legacy              bool // Set for profiles implementing superseded protocols
+	UsesKDF             bool // Set if ComputeX derives x from the KeyDerivationFunc
+	IntegerSalt         bool // Set if the salt is hashed as an integer, without leading zero bytes
+	ComputeK            func(s *SRP) *big.Int
+	ComputeX            func(s *SRP, username, salt, password []byte) *big.Int
+	ComputeU            func(s *SRP, A, B *big.Int) *big.Int
+	ComputeKey          func(s *SRP, S, u *big.Int) []byte
+	ClientAuthenticator func(s *SRP, p *ProofValues) []byte
+	ServerAuthenticator func(s *SRP, p *ProofValues) []byte
+}
+
+// ProofValues holds the session values that a Profile may use to compute the
+// client (M1) and server (M2) authenticators.
+type ProofValues struct {
+	Username []byte
+	Salt     []byte
+	A        *big.Int
+	B        *big.Int
+	S        *big.Int
+	K        []byte
+	M1       []byte // Only set when computing the server authenticator
+}
+
 // SRP contains values that must be the the same for both the client and server.
-// SaltLength and ABSize are defaulted by NewSRP but can be changed after an SRP
+// SaltLength, ABSize and the limits on values received from the other party
+// (see InputError) are defaulted by NewSRP but can be changed after an SRP
 // instance is created.
-// Instances of SRP are safe for concurrent use.
+// Instances of SRP are safe for concurrent use if Rand is.
 type SRP struct {
 	SaltLength        int  // The size of the salt in bytes
 	ABSize            uint // The size of a and b in bits
+	MaxUsernameLength int  // 0 for no limit
+	MaxSaltLength     int  // 0 for no limit
 	HashFunc          HashFunc
 	KeyDerivationFunc KeyDerivationFunc
 	Group             *SRPGroup
+	Profile           *Profile       // If nil the default SRP-6a formulas are used
+	Guard             Guard          // If set, limits the logins of ServerSessions
+	Observer          Observer       // If set, receives the events of sessions
+	Pool              *EphemeralPool // If set, supplies b and g^b to ServerSessions
+	Rand              io.Reader      // Source of salts, a and b; crypto/rand if nil
+	Debug             bool           // If set, sessions record a Transcript, secrets included
 	_k                *big.Int
 }
 
 // ClientSession represents the client side of an SRP authentication session.
-// ClientSession instances cannot be reused.
+// ClientSession instances cannot be reused. Destroy should be called once the
+// session is no longer needed to wipe its secrets from memory.
 // Instances of ClientSession are NOT safe for concurrent use.
 type ClientSession struct {
-	SRP      *SRP
-	username []byte
-	salt     []byte
-	password []byte
-	_a       *big.Int
-	_A       *big.Int
-	_B       *big.Int
-	_u       *big.Int
-	key      []byte
-	_M       []byte
+	SRP        *SRP
+	username   []byte
+	salt       []byte
+	password   []byte
+	_a         *big.Int
+	_A         *big.Int
+	_B         *big.Int
+	_u         *big.Int
+	_S         *big.Int
+	key        []byte
+	_M         []byte
+	bound      []byte
+	transcript *Transcript
 }
 
 // ServerSession represents the client side of an SRP authentication session.
-// ServerSession instances cannot be reused.
+// ServerSession instances cannot be reused. Destroy should be called once the
+// session is no longer needed to wipe its secrets from memory.
 // Instances of ServerSession are NOT safe for concurrent use.
 type ServerSession struct {
-	SRP      *SRP
-	username []byte
-	salt     []byte
-	verifier []byte
-	_v       *big.Int
-	_b       *big.Int
-	_A       *big.Int
-	_B       *big.Int
-	_u       *big.Int
-	key      []byte
+	SRP        *SRP
+	RemoteAddr string // The address of the client, if known, for SRP.Guard
+	username   []byte
+	salt       []byte
+	verifier   []byte
+	_v         *big.Int
+	_b         *big.Int
+	_A         *big.Int
+	_B         *big.Int
+	_u         *big.Int
+	_S         *big.Int
+	key        []byte
+	bound      []byte
+	transcript *Transcript
 }
 
 // NewSRP creates a new SRP context that will use the specified group and hash
@@ -99,15 +161,30 @@ type ServerSession struct {
 //		stanford.8192
 // The rfc5054 groups are from RFC5054
 // The stanford groups where extracted from the stanford patch to OpenSSL.
+// A *PolicyError is returned if the configuration is not allowed by the
+// policy set with SetPolicy.
 func NewSRP(group string, h HashFunc, kd KeyDerivationFunc) (*SRP, error) {
+	if err := srp_policy.check(group, h, kd); err != nil {
+		return nil, err
+	}
+	return newSRP(group, h, kd)
+}
+
+// newSRP is NewSRP without the policy check.
+func newSRP(group string, h HashFunc, kd KeyDerivationFunc) (*SRP, error) {
 	srp := new(SRP)
 	srp.SaltLength = DefaultSaltLength
 	srp.ABSize = DefaultABSize
+	srp.MaxUsernameLength = DefaultMaxUsernameLength
+	srp.MaxSaltLength = DefaultMaxSaltLength
 	srp.HashFunc = h
 	grp, ok := srp_groups[group]
 	if !ok {
 		return nil, fmt.Errorf("Invalid Group: %s", group)
 	}
+	if grp.Prime.Bit(0) == 0 {
+		return nil, fmt.Errorf("Invalid Group: %s has an even prime", group)
+	}
 	srp.Group = grp
 
 	srp.compute_k()
@@ -128,49 +205,102 @@ func NewSRP(group string, h HashFunc, kd KeyDerivationFunc) (*SRP, error) {
 // ComputeVerifier generates a random salt and computes the verifier value that
 // is associated with the user on the server.
 func (s *SRP) ComputeVerifier(password []byte) (salt []byte, verifier []byte, err error) {
+	return s.ComputeUserVerifier(nil, password)
+}
+
+// ComputeUserVerifier is like ComputeVerifier but also takes the username,
+// which is needed when the Profile includes it in the private key x.
+func (s *SRP) ComputeUserVerifier(username, password []byte) (salt []byte, verifier []byte, err error) {
 	//  x = H(s, p)               (s is chosen randomly)
 	salt = make([]byte, s.SaltLength)
-	n, err := io.ReadFull(rand.Reader, salt)
+	n, err := io.ReadFull(s.rand(), salt)
 	if err != nil {
 		return nil, nil, err
 	}
 	if n != len(salt) {
 		return nil, nil, fmt.Errorf("Expected %d random bytes but only got %d bytes", s.SaltLength, n)
 	}
+	// A salt hashed as an integer must not start with a zero byte, so that it
+	// hashes the same whether a peer treats it as bytes or as an integer.
+	for s.Profile != nil && s.Profile.IntegerSalt && len(salt) > 0 && salt[0] == 0 {
+		if _, err := io.ReadFull(s.rand(), salt[:1]); err != nil {
+			return nil, nil, err
+		}
+	}
 
 	//  v = g^x                   (computes password verifier)
-	x := new(big.Int).SetBytes(s.KeyDerivationFunc(salt, password))
-	v := new(big.Int).Exp(s.Group.Generator, x, s.Group.Prime)
-
+	start := time.Now()
+	x := s.compute_x(username, salt, password)
+	kdf := time.Since(start)
+	v := s.Group.exp(x, s.x_bits(x))
+	wipeInt(x)
+	total := time.Since(start)
+
+	s.observe(&Event{Type: EventVerifierComputed, KDFTime: kdf, ExpTime: total - kdf, Duration: total})
 	return salt, v.Bytes(), nil
 }
 
 // NewClientSession creates a new ClientSession.
+// The session keeps a copy of password until ComputeKey has derived the
+// private key x from it, after which the copy is wiped. The caller's password
+// slice is never modified.
 func (s *SRP) NewClientSession(username, password []byte) *ClientSession {
+	return s.newClientSession(username, password, s.gen_rand_ab())
+}
+
+func (s *SRP) newClientSession(username, password []byte, a *big.Int) *ClientSession {
 	cs := new(ClientSession)
 	cs.SRP = s
 	cs.username = username
-	cs.password = password
-	cs._a = s.gen_rand_ab()
+	cs.password = append(make([]byte, 0, len(password)), password...)
+	cs._a = a
 
 	// g^a
-	cs._A = new(big.Int).Exp(cs.SRP.Group.Generator, cs._a, cs.SRP.Group.Prime)
+	start := time.Now()
+	cs._A = cs.SRP.Group.exp(cs._a, int(cs.SRP.ABSize))
+	d := time.Since(start)
+	s.observe(&Event{Type: EventSessionCreated, Role: RoleClient, ExpTime: d, Duration: d})
+	if cs.transcript = s.newTranscript(RoleClient); cs.transcript != nil {
+		cs.transcript.add("username", username, false)
+		cs.transcript.add("a", cs._a.Bytes(), true)
+		cs.transcript.add("A", cs.GetA(), false)
+	}
 	return cs
 }
 
 // NewServerSession creates a new ServerSession.
 func (s *SRP) NewServerSession(username, salt, verifier []byte) *ServerSession {
+	return s.newServerSession(username, salt, verifier, nil)
+}
+
+// newServerSession creates a ServerSession using b and g^b from e, or from
+// SRP.Pool if e is nil.
+func (s *SRP) newServerSession(username, salt, verifier []byte, e *ephemeral) *ServerSession {
 	ss := new(ServerSession)
 	ss.SRP = s
 	ss.username = username
 	ss.salt = salt
 	ss.verifier = verifier
-	ss._b = s.gen_rand_ab()
 	ss._v = new(big.Int).SetBytes(verifier)
 
 	// kv + g^b
-	ss._B = new(big.Int).Mul(ss.SRP._k, ss._v)
-	ss._B.Add(ss._B, new(big.Int).Exp(ss.SRP.Group.Generator, ss._b, ss.SRP.Group.Prime))
+	start := time.Now()
+	if e == nil {
+		e = s.Pool.get(s)
+	}
+	ss._b = e.b
+	m := s.Group.modulus()
+	kv := m.mul(m.toMont(s.get_k()), m.toMont(ss._v))
+	ss._B = m.fromMont(m.add(kv, e.gb))
+	wipeLimbs(e.gb)
+	d := time.Since(start)
+	s.observe(&Event{Type: EventSessionCreated, Role: RoleServer, ExpTime: d, Duration: d})
+	if ss.transcript = s.newTranscript(RoleServer); ss.transcript != nil {
+		ss.transcript.add("username", username, false)
+		ss.transcript.add("salt", salt, false)
+		ss.transcript.add("b", ss._b.Bytes(), true)
+		ss.transcript.add("B", ss.GetB(), false)
+	}
 	return ss
 }
 
@@ -181,10 +311,14 @@ func (cs *ClientSession) GetA() []byte {
 
 // SetB sets the value of B that was returned by the server
 func (cs *ClientSession) setB(B []byte) error {
-	cs._B = new(big.Int).SetBytes(B)
-	if !cs.SRP.is_AB_valid(cs._B) {
-		return fmt.Errorf("B%%N == 0")
+	if err := cs.SRP.checkSalt(cs.salt); err != nil {
+		return err
+	}
+	b, err := cs.SRP.checkPublicValue("B", B)
+	if err != nil {
+		return err
 	}
+	cs._B = b
 	cs._u = cs.SRP.compute_u(cs._A, cs._B)
 	if cs._u.BitLen() == 0 {
 		return fmt.Errorf("H(A, B) == 0")
@@ -193,35 +327,75 @@ func (cs *ClientSession) setB(B []byte) error {
 }
 
 // ComputeKey computes the session key given the salt and the value of B.
+// An *InputError is returned if the salt or B is rejected.
 func (cs *ClientSession) ComputeKey(salt, B []byte) ([]byte, error) {
+	start := time.Now()
 	cs.salt = salt
+	cs.transcript.add("salt", salt, false)
+	cs.transcript.add("B", B, false)
 
 	err := cs.setB(B)
 	if err != nil {
+		cs.SRP.observe(&Event{Type: EventKeyFailed, Role: RoleClient, Err: err, Duration: time.Since(start)})
 		return nil, err
 	}
 
-	h := cs.SRP.HashFunc()
-
 	// x = H(s, p)                 (user enters password)
-	x := new(big.Int).SetBytes(cs.SRP.KeyDerivationFunc(cs.salt, cs.password))
+	kdfStart := time.Now()
+	x := cs.SRP.compute_x(cs.username, cs.salt, cs.password)
+	expStart := time.Now()
+	defer wipeInt(x)
+	if cs.transcript != nil {
+		cs.transcript.add("u", cs._u.Bytes(), false)
+	}
+	// The password is not needed once x is known.
+	wipeBytes(cs.password)
+	cs.password = nil
+
+	// The arithmetic below is done in constant time (see srp_montgomery.go)
+	// with exponent sizes that only depend on public values.
+	m := cs.SRP.Group.modulus()
+	xbits := cs.SRP.x_bits(x)
+	ebits := int(cs.SRP.ABSize)
+	if cs._u.BitLen()+xbits > ebits {
+		ebits = cs._u.BitLen() + xbits
+	}
+	ebits++
 
 	// S = (B - kg^x) ^ (a + ux)   (computes session key)
-	// t1 = g^x
-	t1 := new(big.Int).Exp(cs.SRP.Group.Generator, x, cs.SRP.Group.Prime)
-	// t1 = kg^x
-	t1.Mul(cs.SRP._k, t1)
+	// gx = g^x
+	gx := cs.SRP.Group.expMont(x, xbits)
+	// kgx = kg^x
+	kgx := m.mul(m.toMont(cs.SRP.get_k()), gx)
+	wipeLimbs(gx)
 	// t1 = B - kg^x
-	t1.Sub(cs._B, t1)
+	t1 := m.sub(m.toMont(cs._B), kgx)
+	wipeLimbs(kgx)
 	// t2 = ux
 	t2 := new(big.Int).Mul(cs._u, x)
+	defer wipeInt(t2)
 	// t2 = a + ux
 	t2.Add(cs._a, t2)
 	// t1 = (B - kg^x) ^ (a + ux)
-	t1.Exp(t1, t2, cs.SRP.Group.Prime)
+	S := m.exp(t1, t2, ebits)
+	wipeLimbs(t1)
+	cs._S = m.fromMont(S)
+	wipeLimbs(S)
+	exp := time.Since(expStart)
 	// K = H(S)
-	cs.key = h.Sum(t1.Bytes())
+	cs.key = cs.SRP.compute_key(cs._S, cs._u)
+	if cs.transcript != nil {
+		cs.transcript.add("S", cs._S.Bytes(), true)
+		cs.transcript.add("K", cs.key, true)
+	}
 
+	cs.SRP.observe(&Event{
+		Type:     EventKeyComputed,
+		Role:     RoleClient,
+		KDFTime:  expStart.Sub(kdfStart),
+		ExpTime:  exp,
+		Duration: time.Since(start),
+	})
 	return cs.key, nil
 }
 
@@ -258,15 +432,42 @@ func computeServerAuthenticator(h hash.Hash, A, M, K []byte) []byte {
 // ComputeAuthenticator computes an authenticator that is to be passed to the
 // server for validation
 func (cs *ClientSession) ComputeAuthenticator() []byte {
-	cs._M = computeClientAutneticator(cs.SRP.HashFunc(), cs.SRP.Group, cs.username, cs.salt, cs._A.Bytes(), cs._B.Bytes(), cs.key)
+	cs._M = cs.SRP.bind_authenticator(cs.SRP.client_authenticator(cs.proofValues(nil)), cs.bound)
+	cs.transcript.add("M1", cs._M, false)
 	return cs._M
 }
 
 // VerifyServerAuthenticator returns true if the authenticator returned by the
 // server is valid
 func (cs *ClientSession) VerifyServerAuthenticator(sauth []byte) bool {
-	sa := computeServerAuthenticator(cs.SRP.HashFunc(), cs._A.Bytes(), cs._M, cs.key)
-	return subtle.ConstantTimeCompare(sa, sauth) == 1
+	// Without a key the authenticator would only depend on public values.
+	valid := false
+	if cs._S != nil && cs.key != nil {
+		sa := cs.SRP.bind_authenticator(cs.SRP.server_authenticator(cs.proofValues(cs._M)), cs.bound)
+		valid = subtle.ConstantTimeCompare(sa, sauth) == 1
+		cs.transcript.add("M2", sa, true)
+	}
+	cs.transcript.add("received M2", sauth, false)
+	cs.SRP.observe(&Event{Type: proofEvent(valid), Role: RoleClient})
+	return valid
+}
+
+// Destroy wipes the password, a, S, the session key, the authenticator and
+// the secret values of the transcript held by the session. The slices returned by ComputeKey, GetKey and
+// ComputeAuthenticator are wiped as well, so they must be copied first if
+// they are still needed. The session cannot be used after calling Destroy.
+func (cs *ClientSession) Destroy() {
+	wipeBytes(cs.password)
+	wipeInt(cs._a)
+	wipeInt(cs._S)
+	wipeBytes(cs.key)
+	wipeBytes(cs._M)
+	cs.transcript.Wipe()
+	cs.password = nil
+	cs._a = nil
+	cs._S = nil
+	cs.key = nil
+	cs._M = nil
 }
 
 // Return the bytes for the value of B.
@@ -275,10 +476,14 @@ func (ss *ServerSession) GetB() []byte {
 }
 
 func (ss *ServerSession) setA(A []byte) error {
-	ss._A = new(big.Int).SetBytes(A)
-	if !ss.SRP.is_AB_valid(ss._A) {
-		return fmt.Errorf("A%%N == 0")
+	if err := ss.SRP.checkUsername(ss.username); err != nil {
+		return err
 	}
+	a, err := ss.SRP.checkPublicValue("A", A)
+	if err != nil {
+		return err
+	}
+	ss._A = a
 	ss._u = ss.SRP.compute_u(ss._A, ss._B)
 	if ss._u.BitLen() == 0 {
 		return fmt.Errorf("H(A, B) == 0")
@@ -287,32 +492,139 @@ func (ss *ServerSession) setA(A []byte) error {
 }
 
 // ComputeKey computes the session key given the value of A.
+// An *InputError is returned if A or the username is rejected.
+// If SRP.Guard refuses the login its error is returned.
 func (ss *ServerSession) ComputeKey(A []byte) ([]byte, error) {
+	start := time.Now()
+	ss.transcript.add("A", A, false)
+	// The username and A are checked first, so that a rejected login is not
+	// counted by the guard and an invalid username never reaches its store.
 	err := ss.setA(A)
 	if err != nil {
+		ss.SRP.observe(&Event{Type: EventKeyFailed, Role: RoleServer, Err: err, Duration: time.Since(start)})
 		return nil, err
 	}
+	if g := ss.SRP.Guard; g != nil {
+		if err := g.Check(string(ss.username), ss.RemoteAddr); err != nil {
+			ss.SRP.observe(&Event{Type: EventKeyFailed, Role: RoleServer, Err: guardEventError(err), Duration: time.Since(start)})
+			return nil, err
+		}
+	}
 
 	// S = (Av^u) ^ b              (computes session key)
-	S := new(big.Int).Exp(ss._v, ss._u, ss.SRP.Group.Prime)
-	S.Mul(ss._A, S)
-	S.Exp(S, ss._b, ss.SRP.Group.Prime)
+	// v and b are secret so this is done in constant time.
+	expStart := time.Now()
+	m := ss.SRP.Group.modulus()
+	v := m.toMont(ss._v)
+	t := m.exp(v, ss._u, ss._u.BitLen())
+	wipeLimbs(v)
+	t = m.mul(m.toMont(ss._A), t)
+	S := m.exp(t, ss._b, int(ss.SRP.ABSize))
+	wipeLimbs(t)
+	ss._S = m.fromMont(S)
+	wipeLimbs(S)
+	exp := time.Since(expStart)
 	// K = H(S)
-	h := ss.SRP.HashFunc()
-	ss.key = h.Sum(S.Bytes())
+	ss.key = ss.SRP.compute_key(ss._S, ss._u)
+	if ss.transcript != nil {
+		ss.transcript.add("u", ss._u.Bytes(), false)
+		ss.transcript.add("S", ss._S.Bytes(), true)
+		ss.transcript.add("K", ss.key, true)
+	}
+
+	ss.SRP.observe(&Event{Type: EventKeyComputed, Role: RoleServer, ExpTime: exp, Duration: time.Since(start)})
 	return ss.key, nil
 }
 
 // ComputeAuthenticator computes an authenticator to be passed to the client.
 func (ss *ServerSession) ComputeAuthenticator(cauth []byte) []byte {
-	return computeServerAuthenticator(ss.SRP.HashFunc(), ss._A.Bytes(), cauth, ss.key)
+	M := ss.SRP.bind_authenticator(ss.SRP.server_authenticator(ss.proofValues(cauth)), ss.bound)
+	ss.transcript.add("M2", M, false)
+	return M
 }
 
 // VerifyClientAuthenticator returns true if the client authenticator
-// is valid.
+// is valid. The result is reported to SRP.Guard, if set. Errors of the guard
+// cannot be returned and are ignored.
 func (ss *ServerSession) VerifyClientAuthenticator(cauth []byte) bool {
-	M := computeClientAutneticator(ss.SRP.HashFunc(), ss.SRP.Group, ss.username, ss.salt, ss._A.Bytes(), ss._B.Bytes(), ss.key)
-	return subtle.ConstantTimeCompare(M, cauth) == 1
+	valid := false
+	if ss._S != nil {
+		M := ss.SRP.bind_authenticator(ss.SRP.client_authenticator(ss.proofValues(nil)), ss.bound)
+		valid = subtle.ConstantTimeCompare(M, cauth) == 1
+		ss.transcript.add("M1", M, true)
+	}
+	ss.transcript.add("received M1", cauth, false)
+	if g := ss.SRP.Guard; g != nil {
+		if valid {
+			g.Success(string(ss.username), ss.RemoteAddr)
+		} else {
+			g.Failure(string(ss.username), ss.RemoteAddr)
+		}
+	}
+	ss.SRP.observe(&Event{Type: proofEvent(valid), Role: RoleServer})
+	return valid
+}
+
+func proofEvent(valid bool) EventType {
+	if valid {
+		return EventProofVerified
+	}
+	return EventProofFailed
+}
+
+// Destroy wipes b, S, the session key, the session's copy of the verifier and
+// the secret values of the transcript. The verifier slice passed to NewServerSession belongs to the caller and is
+// only released. The slice returned by ComputeKey is wiped as well. The
+// session cannot be used after calling Destroy.
+func (ss *ServerSession) Destroy() {
+	wipeInt(ss._b)
+	wipeInt(ss._v)
+	wipeInt(ss._S)
+	wipeBytes(ss.key)
+	ss.transcript.Wipe()
+	ss.verifier = nil
+	ss._b = nil
+	ss._v = nil
+	ss._S = nil
+	ss.key = nil
+}
+
+func (cs *ClientSession) proofValues(M1 []byte) *ProofValues {
+	return &ProofValues{
+		Username: cs.username,
+		Salt:     cs.salt,
+		A:        cs._A,
+		B:        cs._B,
+		S:        cs._S,
+		K:        cs.key,
+		M1:       M1,
+	}
+}
+
+func (ss *ServerSession) proofValues(M1 []byte) *ProofValues {
+	return &ProofValues{
+		Username: ss.username,
+		Salt:     ss.salt,
+		A:        ss._A,
+		B:        ss._B,
+		S:        ss._S,
+		K:        ss.key,
+		M1:       M1,
+	}
+}
+
+func (s *SRP) client_authenticator(p *ProofValues) []byte {
+	if s.Profile != nil && s.Profile.ClientAuthenticator != nil {
+		return s.Profile.ClientAuthenticator(s, p)
+	}
+	return computeClientAutneticator(s.HashFunc(), s.Group, p.Username, p.Salt, p.A.Bytes(), p.B.Bytes(), p.K)
+}
+
+func (s *SRP) server_authenticator(p *ProofValues) []byte {
+	if s.Profile != nil && s.Profile.ServerAuthenticator != nil {
+		return s.Profile.ServerAuthenticator(s, p)
+	}
+	return computeServerAuthenticator(s.HashFunc(), p.A.Bytes(), p.M1, p.K)
 }
 
 func (s *SRP) pad(n *big.Int) []byte {
@@ -327,6 +639,9 @@ func (s *SRP) pad(n *big.Int) []byte {
 }
 
 func (s *SRP) compute_u(A, B *big.Int) *big.Int {
+	if s.Profile != nil && s.Profile.ComputeU != nil {
+		return s.Profile.ComputeU(s, A, B)
+	}
 	// u = H(A, B) where A and B are padded to the same size as N
 	h := s.HashFunc()
 	h.Write(s.pad(A))
@@ -342,16 +657,88 @@ func (s *SRP) compute_k() {
 	s._k = new(big.Int).SetBytes(h.Sum(nil))
 }
 
+func (s *SRP) get_k() *big.Int {
+	if s.Profile != nil && s.Profile.ComputeK != nil {
+		return s.Profile.ComputeK(s)
+	}
+	return s._k
+}
+
+func (s *SRP) compute_x(username, salt, password []byte) *big.Int {
+	if s.Profile != nil && s.Profile.ComputeX != nil {
+		return s.Profile.ComputeX(s, username, salt, password)
+	}
+	key := s.KeyDerivationFunc(salt, password)
+	defer wipeBytes(key)
+	return new(big.Int).SetBytes(key)
+}
+
+// x_bits returns the bit length used when exponentiating by x. It is the
+// hash size unless the KeyDerivationFunc or Profile produces larger values,
+// so it depends on the configuration rather than the password.
+func (s *SRP) x_bits(x *big.Int) int {
+	bits := 8 * s.HashFunc().Size()
+	if x.BitLen() > bits {
+		bits = s.Group.Size
+	}
+	return bits
+}
+
+func (s *SRP) compute_key(S, u *big.Int) []byte {
+	if s.Profile != nil && s.Profile.ComputeKey != nil {
+		return s.Profile.ComputeKey(s, S, u)
+	}
+	h := s.HashFunc()
+	Sb := S.Bytes()
+	defer wipeBytes(Sb)
+	return h.Sum(Sb)
+}
+
 func (s *SRP) gen_rand_ab() *big.Int {
-	max := new(big.Int).Lsh(big.NewInt(1), s.ABSize)
-	r, err := rand.Int(rand.Reader, max)
+	return randBits(s.rand(), s.ABSize)
+}
+
+func (s *SRP) rand() io.Reader {
+	if s.Rand != nil {
+		return s.Rand
+	}
+	return rand.Reader
+}
+
+// randBits returns a random number of up to n bits read from r.
+func randBits(r io.Reader, n uint) *big.Int {
+	max := new(big.Int).Lsh(big.NewInt(1), n)
+	x, err := rand.Int(r, max)
 	if err != nil {
 		panic(err)
 	}
-	return r
+	return x
+}
+
+// wipeBytes overwrites b with zeros.
+func wipeBytes(b []byte) {
+	for i := range b {
+		b[i] = 0
+	}
 }
 
-func (s *SRP) is_AB_valid(AB *big.Int) bool {
-	ABmodN := new(big.Int).Mod(AB, s.Group.Prime)
-	return ABmodN.BitLen() != 0
+// wipeInt overwrites the limbs of x, including any unused capacity, with
+// zeros and sets x to 0.
+func wipeInt(x *big.Int) {
+	if x == nil {
+		return
+	}
+	w := x.Bits()
+	w = w[:cap(w)]
+	for i := range w {
+		w[i] = 0
+	}
+	x.SetInt64(0)
+}
+
+// wipeLimbs overwrites x with zeros.
+func wipeLimbs(x []uint) {
+	for i := range x {
+		x[i] = 0
+	}
 }
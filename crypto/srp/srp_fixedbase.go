@@ -0,0 +1,96 @@
+// Copyright 2013 Tad Glines
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+package srp
+
+import (
+	"math/big"
+)
+
+// The width in bits of the exponent digits used by fixedBaseTable.
+const fixedBaseWindow = montWindow
+
+// fixedBaseTable holds g^(j * 2^(w*i)) mod N in Montgomery form for every
+// digit position i and digit value j, so that g^e can be computed with one
+// multiplication per digit of e and no squarings. Each digit is looked up
+// with ctLookupInto so the table is as safe to use with secret exponents as
+// montModulus.exp.
+type fixedBaseTable struct {
+	bits int
+	rows [][][]uint // rows[i][j] = g^(j * 2^(w*i))
+}
+
+// Precompute builds a table of powers of the generator that speeds up g^a,
+// g^b and verifier generation for exponents of up to bits bits. Larger
+// exponents fall back to the generic exponentiation. The table needs about
+// (bits/4)*16*Size/8 bytes of memory.
+// bits should be the larger of SRP.ABSize and the size of the private key x,
+// which is usually the hash size.
+// This function must be called by only one goroutine at a time and before the
+// group is used by any session.
+func (g *SRPGroup) Precompute(bits int) {
+	m := g.modulus()
+	t := &fixedBaseTable{bits: bits}
+	base := m.toMont(g.Generator)
+	digits := 1 << fixedBaseWindow
+	for i := 0; i*fixedBaseWindow < bits; i++ {
+		row := make([][]uint, digits)
+		row[0] = m.one
+		for j := 1; j < digits; j++ {
+			row[j] = m.mul(row[j-1], base)
+		}
+		t.rows = append(t.rows, row)
+		// base = base^(2^w)
+		base = m.mul(row[digits-1], base)
+	}
+	g.table = t
+}
+
+// exp returns g^e mod N. ebits is a public upper bound on the bit length of
+// e, see montModulus.exp.
+func (g *SRPGroup) exp(e *big.Int, ebits int) *big.Int {
+	return g.modulus().fromMont(g.expMont(e, ebits))
+}
+
+// expMont returns g^e mod N in Montgomery form.
+func (g *SRPGroup) expMont(e *big.Int, ebits int) []uint {
+	m := g.modulus()
+	t := g.table
+	if t == nil || e.Sign() < 0 || ebits > t.bits || e.BitLen() > t.bits {
+		return m.exp(m.toMont(g.Generator), e, ebits)
+	}
+	el := expLimbs(e, t.bits)
+	defer wipeLimbs(el)
+	w := make([]uint, len(m.n))
+	defer wipeLimbs(w)
+	z := m.one
+	for i, row := range t.rows {
+		ctLookupInto(w, row, window(el, i*fixedBaseWindow))
+		prev := z
+		z = m.mul(z, w)
+		if i > 0 {
+			wipeLimbs(prev)
+		}
+	}
+	return z
+}
+
+// modulus returns the constant-time arithmetic for the group, creating it on
+// first use.
+func (g *SRPGroup) modulus() *montModulus {
+	g.once.Do(func() {
+		g.mont = newMontModulus(g.Prime)
+	})
+	return g.mont
+}
@@ -0,0 +1,79 @@
+// Copyright 2013 Tad Glines
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+package srp
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"math/big"
+	"testing"
+)
+
+// precomputedGroup returns a copy of a registered group with a table, so
+// that the registered groups are left untouched.
+func precomputedGroup(t testing.TB, name string, bits int) *SRPGroup {
+	grp, err := GetGroup(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pg := &SRPGroup{Size: grp.Size, Prime: grp.Prime, Generator: grp.Generator}
+	pg.Precompute(bits)
+	return pg
+}
+
+func TestFixedBaseExp(t *testing.T) {
+	for _, name := range []string{"rfc5054.1024", "openssl.3072", "rfc5054.8192"} {
+		grp := precomputedGroup(t, name, 512)
+		exps := []*big.Int{big.NewInt(0), big.NewInt(1), big.NewInt(16)}
+		for _, bits := range []int{1, 4, 255, 256, 511, 512, 513, 1024} {
+			e, _ := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), uint(bits)))
+			exps = append(exps, e, new(big.Int).SetBit(e, bits-1, 1))
+		}
+		for _, e := range exps {
+			expected := new(big.Int).Exp(grp.Generator, e, grp.Prime)
+			if grp.exp(e, e.BitLen()).Cmp(expected) != 0 {
+				t.Fatalf("%s: g^%x is wrong", name, e)
+			}
+		}
+	}
+}
+
+func TestPrecomputedHandshake(t *testing.T) {
+	s, err := NewSRP("rfc5054.2048", sha256.New, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Group = precomputedGroup(t, "rfc5054.2048", 256)
+	testSession(t, s, []byte("test"), []byte("password"))
+}
+
+func BenchmarkGeneratorExp(b *testing.B) {
+	for _, name := range groups {
+		grp, _ := GetGroup(name)
+		pg := precomputedGroup(b, name, DefaultABSize)
+		e, _ := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), DefaultABSize))
+
+		b.Run(name+"/exp", func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				new(big.Int).Exp(grp.Generator, e, grp.Prime)
+			}
+		})
+		b.Run(name+"/precomputed", func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				pg.exp(e, DefaultABSize)
+			}
+		})
+	}
+}
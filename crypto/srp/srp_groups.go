@@ -23,14 +23,21 @@ package srp
 import (
 	"fmt"
 	"math/big"
+	"sync"
 )
 
 type SRPGroup struct {
 	Size      int      // Size in bits
 	Prime     *big.Int // N
 	Generator *big.Int // g
+	table     *fixedBaseTable
+	once      sync.Once
+	mont      *montModulus
 }
 
+// The openssl primes are copied from the bn_ulong arrays of OpenSSL, which
+// hold N as 64 bit words starting with the least significant one. They are
+// the same primes as the rfc5054 groups.
 var openssl_prime1024data []byte = []byte{
 	0x9F, 0xC6, 0x1D, 0x2F, 0xC0, 0xEB, 0x06, 0xE3, 0xFD, 0x51, 0x38, 0xFE, 0x83, 0x76, 0x43, 0x5B,
 	0x2F, 0xD4, 0xCB, 0xF4, 0x97, 0x6E, 0xAA, 0x9A, 0x68, 0xED, 0xBC, 0x3C, 0x05, 0x72, 0x6C, 0xC0,
@@ -483,43 +490,43 @@ var rfc5054_prime8192data []byte = []byte{
 
 var openssl_group1024 *SRPGroup = &SRPGroup{
 	Size:      1024,
-	Prime:     big.NewInt(0).SetBytes(openssl_prime1024data),
+	Prime:     fromLimbs(openssl_prime1024data),
 	Generator: big.NewInt(2),
 }
 
 var openssl_group1536 *SRPGroup = &SRPGroup{
 	Size:      1536,
-	Prime:     big.NewInt(0).SetBytes(openssl_prime1536data),
+	Prime:     fromLimbs(openssl_prime1536data),
 	Generator: big.NewInt(2),
 }
 
 var openssl_group2048 *SRPGroup = &SRPGroup{
 	Size:      2048,
-	Prime:     big.NewInt(0).SetBytes(openssl_prime2048data),
+	Prime:     fromLimbs(openssl_prime2048data),
 	Generator: big.NewInt(2),
 }
 
 var openssl_group3072 *SRPGroup = &SRPGroup{
 	Size:      3072,
-	Prime:     big.NewInt(0).SetBytes(openssl_prime3072data),
+	Prime:     fromLimbs(openssl_prime3072data),
 	Generator: big.NewInt(5),
 }
 
 var openssl_group4096 *SRPGroup = &SRPGroup{
 	Size:      4096,
-	Prime:     big.NewInt(0).SetBytes(openssl_prime4096data),
+	Prime:     fromLimbs(openssl_prime4096data),
 	Generator: big.NewInt(5),
 }
 
 var openssl_group6144 *SRPGroup = &SRPGroup{
 	Size:      6144,
-	Prime:     big.NewInt(0).SetBytes(openssl_prime6144data),
+	Prime:     fromLimbs(openssl_prime6144data),
 	Generator: big.NewInt(5),
 }
 
 var openssl_group8192 *SRPGroup = &SRPGroup{
 	Size:      8192,
-	Prime:     big.NewInt(0).SetBytes(openssl_prime8192data),
+	Prime:     fromLimbs(openssl_prime8192data),
 	Generator: big.NewInt(19),
 }
 
@@ -565,6 +572,16 @@ var rfc5054_group8192 *SRPGroup = &SRPGroup{
 	Generator: big.NewInt(19),
 }
 
+// fromLimbs returns the number stored in data as big endian 64 bit words,
+// least significant word first.
+func fromLimbs(data []byte) *big.Int {
+	be := make([]byte, 0, len(data))
+	for i := len(data); i > 0; i -= 8 {
+		be = append(be, data[i-8:i]...)
+	}
+	return new(big.Int).SetBytes(be)
+}
+
 var srp_groups map[string]*SRPGroup = map[string]*SRPGroup{
 	"openssl.1024": openssl_group1024,
 	"openssl.1536": openssl_group1536,
@@ -593,7 +610,8 @@ func GetGroup(group string) (*SRPGroup, error) {
 	return grp, nil
 }
 
-// RegisterGroup will register a SRPGroup for use with SRP.
+// RegisterGroup will register a SRPGroup for use with SRP. NewSRP rejects a
+// group whose prime is even.
 // This function must be called by only one goroutine at a time.
 func RegisterGroup(name string, group *SRPGroup) {
 	srp_groups[name] = group
@@ -0,0 +1,263 @@
+// Copyright 2013 Tad Glines
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+package srp
+
+/*
+	Constant-time modular arithmetic for operations involving secrets.
+
+	math/big is not constant-time: Exp skips work for zero bits and windows
+	and every result is normalized to its shortest length. The arithmetic
+	here works on little-endian limbs whose count is fixed by the size of N,
+	uses Montgomery multiplication with a branch free final subtraction and
+	exponentiates using fixed 4 bit windows with table lookups that touch
+	every entry. The number of windows is derived from a bit length that
+	depends only on public parameters (ABSize, hash size, group size), never
+	on the value of the exponent.
+
+	Values in Montgomery form (xR mod N) are plain []uint of length
+	len(montModulus.n).
+
+	Montgomery multiplication requires an odd N. An even N is never a
+	valid group, and NewSRP rejects groups with one, so that every session
+	uses the constant-time arithmetic.
+*/
+
+import (
+	"math/big"
+	"math/bits"
+)
+
+const montWindow = 4
+
+type montModulus struct {
+	N   *big.Int
+	n   []uint // N as limbs
+	n0  uint   // -N^-1 mod 2^_W
+	rr  []uint // R^2 mod N
+	one []uint // R mod N, which is 1 in Montgomery form
+}
+
+func newMontModulus(N *big.Int) *montModulus {
+	if N.Bit(0) == 0 {
+		panic("Montgomery arithmetic requires an odd modulus")
+	}
+	m := &montModulus{N: N}
+	size := len(N.Bits())
+	m.n = limbs(N, size)
+
+	// Newton's iteration for N^-1 mod 2^_W, which doubles the number of
+	// correct bits each step starting with 1 bit (N is odd).
+	inv := uint(1)
+	for i := 0; i < 7; i++ {
+		inv *= 2 - m.n[0]*inv
+	}
+	m.n0 = -inv
+
+	R := new(big.Int).Lsh(big.NewInt(1), uint(size*bits.UintSize))
+	m.one = limbs(new(big.Int).Mod(R, N), size)
+	R.Mul(R, R)
+	m.rr = limbs(R.Mod(R, N), size)
+	return m
+}
+
+// limbs returns x as exactly size little-endian limbs. x must fit.
+func limbs(x *big.Int, size int) []uint {
+	z := make([]uint, size)
+	for i, w := range x.Bits() {
+		z[i] = uint(w)
+	}
+	return z
+}
+
+// toMont converts x to Montgomery form. Values outside of [0, N) are reduced
+// first, which is only expected for public values.
+func (m *montModulus) toMont(x *big.Int) []uint {
+	if x.Sign() < 0 || x.Cmp(m.N) >= 0 {
+		x = new(big.Int).Mod(x, m.N)
+	}
+	return m.mul(limbs(x, len(m.n)), m.rr)
+}
+
+// fromMont converts x out of Montgomery form.
+func (m *montModulus) fromMont(x []uint) *big.Int {
+	one := make([]uint, len(m.n))
+	one[0] = 1
+	return toBig(m.mul(x, one))
+}
+
+func toBig(x []uint) *big.Int {
+	w := make([]big.Word, len(x))
+	for i := range x {
+		w[i] = big.Word(x[i])
+	}
+	return new(big.Int).SetBits(w)
+}
+
+// mul returns x*y/R mod N.
+func (m *montModulus) mul(x, y []uint) []uint {
+	z := make([]uint, len(m.n))
+	m.mulInto(z, x, y, make([]uint, len(m.n)+1))
+	return z
+}
+
+// mulInto sets z to x*y/R mod N using the CIOS method with the
+// multiplication and reduction loops fused. t is scratch space of
+// len(m.n)+1 limbs; z may alias x or y.
+func (m *montModulus) mulInto(z, x, y, t []uint) {
+	n := len(m.n)
+	for i := range t {
+		t[i] = 0
+	}
+	for i := 0; i < n; i++ {
+		yi := y[i]
+		c1, s := mulAdd(x[0], yi, t[0], 0)
+		u := s * m.n0
+		c2, _ := mulAdd(u, m.n[0], s, 0)
+		for j := 1; j < n; j++ {
+			c1, s = mulAdd(x[j], yi, t[j], c1)
+			c2, t[j-1] = mulAdd(u, m.n[j], s, c2)
+		}
+		var a, b uint
+		s, a = bits.Add(t[n], c1, 0)
+		t[n-1], b = bits.Add(s, c2, 0)
+		t[n] = a + b
+	}
+
+	// t < 2N, so subtract N if t >= N.
+	var borrow uint
+	for i := 0; i < n; i++ {
+		z[i], borrow = bits.Sub(t[i], m.n[i], borrow)
+	}
+	// Keep t if the subtraction underflowed and t had no carry limb.
+	ctSelect(z, t[:n], borrow&^t[n]&1)
+}
+
+// add returns x+y mod N.
+func (m *montModulus) add(x, y []uint) []uint {
+	n := len(m.n)
+	z := make([]uint, n)
+	d := make([]uint, n)
+	var carry, borrow uint
+	for i := 0; i < n; i++ {
+		z[i], carry = bits.Add(x[i], y[i], carry)
+	}
+	for i := 0; i < n; i++ {
+		d[i], borrow = bits.Sub(z[i], m.n[i], borrow)
+	}
+	// Use x+y-N unless it underflowed without a carry out of x+y.
+	ctSelect(z, d, 1^(borrow&^carry))
+	return z
+}
+
+// sub returns x-y mod N.
+func (m *montModulus) sub(x, y []uint) []uint {
+	n := len(m.n)
+	z := make([]uint, n)
+	d := make([]uint, n)
+	var borrow, carry uint
+	for i := 0; i < n; i++ {
+		z[i], borrow = bits.Sub(x[i], y[i], borrow)
+	}
+	for i := 0; i < n; i++ {
+		d[i], carry = bits.Add(z[i], m.n[i], carry)
+	}
+	ctSelect(z, d, borrow)
+	return z
+}
+
+// exp returns x^e in Montgomery form, where x is in Montgomery form. ebits
+// must be an upper bound on the bit length of e that does not depend on
+// secrets; the running time only depends on ebits and the size of N.
+func (m *montModulus) exp(x []uint, e *big.Int, ebits int) []uint {
+	table := make([][]uint, 1<<montWindow)
+	table[0] = m.one
+	table[1] = x
+	for i := 2; i < len(table); i++ {
+		table[i] = m.mul(table[i-1], x)
+	}
+
+	el := expLimbs(e, ebits)
+	z := make([]uint, len(m.n))
+	copy(z, m.one)
+	t := make([]uint, len(m.n)+1)
+	w := make([]uint, len(m.n))
+	// Everything but z is derived from x or e, which may be secret.
+	defer func() {
+		for _, p := range table[2:] {
+			wipeLimbs(p)
+		}
+		wipeLimbs(el)
+		wipeLimbs(t)
+		wipeLimbs(w)
+	}()
+	for i := len(el)*bits.UintSize - montWindow; i >= 0; i -= montWindow {
+		for k := 0; k < montWindow; k++ {
+			m.mulInto(z, z, z, t)
+		}
+		ctLookupInto(w, table, window(el, i))
+		m.mulInto(z, z, w, t)
+	}
+	return z
+}
+
+// expLimbs returns e as a fixed number of limbs that covers ebits bits.
+func expLimbs(e *big.Int, ebits int) []uint {
+	if e.BitLen() > ebits {
+		// Only reachable if the caller's bound is wrong, which is a bug
+		// rather than a secret dependent condition.
+		ebits = e.BitLen()
+	}
+	return limbs(e, (ebits+bits.UintSize-1)/bits.UintSize)
+}
+
+// window returns the montWindow bits of e starting at bit i.
+func window(e []uint, i int) uint {
+	return (e[i/bits.UintSize] >> uint(i%bits.UintSize)) & (1<<montWindow - 1)
+}
+
+// ctLookupInto sets z to table[idx], reading every entry.
+func ctLookupInto(z []uint, table [][]uint, idx uint) {
+	for i := range z {
+		z[i] = 0
+	}
+	for i, t := range table {
+		ctSelect(z, t, ctEq(uint(i), idx))
+	}
+}
+
+// ctSelect sets z to x if v == 1 and leaves it unchanged if v == 0.
+func ctSelect(z, x []uint, v uint) {
+	mask := -v
+	for i := range z {
+		z[i] = z[i]&^mask | x[i]&mask
+	}
+}
+
+// ctEq returns 1 if x == y and 0 otherwise.
+func ctEq(x, y uint) uint {
+	d := x ^ y
+	return 1 ^ ((d | -d) >> (bits.UintSize - 1))
+}
+
+// mulAdd returns the high and low limbs of x*y + z + c.
+func mulAdd(x, y, z, c uint) (hi, lo uint) {
+	hi, lo = bits.Mul(x, y)
+	var cc uint
+	lo, cc = bits.Add(lo, z, 0)
+	hi += cc
+	lo, cc = bits.Add(lo, c, 0)
+	hi += cc
+	return
+}
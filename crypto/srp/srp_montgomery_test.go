@@ -0,0 +1,192 @@
+// Copyright 2013 Tad Glines
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+package srp
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"math"
+	"math/big"
+	mrand "math/rand"
+	"os"
+	"sort"
+	"testing"
+	"time"
+)
+
+func randInt(t testing.TB, max *big.Int) *big.Int {
+	r, err := rand.Int(rand.Reader, max)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return r
+}
+
+func TestMontgomeryArithmetic(t *testing.T) {
+	for _, name := range []string{"rfc5054.1024", "openssl.1536", "openssl.3072", "rfc5054.3072"} {
+		grp, _ := GetGroup(name)
+		N := grp.Prime
+		m := newMontModulus(N)
+		Nm1 := new(big.Int).Sub(N, big.NewInt(1))
+		values := []*big.Int{big.NewInt(0), big.NewInt(1), Nm1, randInt(t, N), randInt(t, N)}
+		for _, x := range values {
+			xm := m.toMont(x)
+			if m.fromMont(xm).Cmp(x) != 0 {
+				t.Fatalf("%s: fromMont(toMont(x)) != x", name)
+			}
+			for _, y := range values {
+				ym := m.toMont(y)
+				expected := new(big.Int).Mul(x, y)
+				expected.Mod(expected, N)
+				if m.fromMont(m.mul(xm, ym)).Cmp(expected) != 0 {
+					t.Fatalf("%s: %x * %x is wrong", name, x, y)
+				}
+				expected.Add(x, y).Mod(expected, N)
+				if m.fromMont(m.add(xm, ym)).Cmp(expected) != 0 {
+					t.Fatalf("%s: %x + %x is wrong", name, x, y)
+				}
+				expected.Sub(x, y).Mod(expected, N)
+				if m.fromMont(m.sub(xm, ym)).Cmp(expected) != 0 {
+					t.Fatalf("%s: %x - %x is wrong", name, x, y)
+				}
+			}
+			for _, e := range []*big.Int{big.NewInt(0), big.NewInt(1), big.NewInt(0x10001), randInt(t, N)} {
+				expected := new(big.Int).Exp(x, e, N)
+				if m.fromMont(m.exp(xm, e, e.BitLen())).Cmp(expected) != 0 {
+					t.Fatalf("%s: %x ^ %x is wrong", name, x, e)
+				}
+				if m.fromMont(m.exp(xm, e, 2*N.BitLen())).Cmp(expected) != 0 {
+					t.Fatalf("%s: %x ^ %x with a wide exponent is wrong", name, x, e)
+				}
+			}
+		}
+	}
+}
+
+func TestEvenGroup(t *testing.T) {
+	grp := srp_groups["rfc5054.1024"]
+	N := new(big.Int).Add(grp.Prime, big.NewInt(1))
+	RegisterGroup("even.1024", &SRPGroup{Size: 1024, Prime: N, Generator: grp.Generator})
+	defer delete(srp_groups, "even.1024")
+	if _, err := NewSRP("even.1024", sha256.New, nil); err == nil {
+		t.Fatal("Expected a group with an even prime to be rejected")
+	}
+}
+
+// timingLeak measures op on inputs of two classes in random order and returns
+// Welch's t statistic for the difference in running time, as done by dudect
+// (https://eprint.iacr.org/2016/1123). Measurements above the 90th percentile
+// are dropped to reduce noise from the scheduler and the garbage collector.
+func timingLeak(samples int, op func(class int)) float64 {
+	classes := make([]int, samples)
+	times := make([]float64, samples)
+	for i := range classes {
+		classes[i] = mrand.Intn(2)
+		start := time.Now()
+		op(classes[i])
+		times[i] = float64(time.Since(start))
+	}
+
+	sorted := append([]float64{}, times...)
+	sort.Float64s(sorted)
+	limit := sorted[samples*9/10]
+
+	var n, mean, m2 [2]float64
+	for i, t := range times {
+		if t > limit {
+			continue
+		}
+		c := classes[i]
+		n[c]++
+		d := t - mean[c]
+		mean[c] += d / n[c]
+		m2[c] += d * (t - mean[c])
+	}
+	v0, v1 := m2[0]/(n[0]-1), m2[1]/(n[1]-1)
+	return (mean[0] - mean[1]) / math.Sqrt(v0/n[0]+v1/n[1])
+}
+
+// The threshold used by dudect to report that an implementation is
+// definitely not constant-time.
+const timingLeakThreshold = 10
+
+func TestConstantTimeExp(t *testing.T) {
+	if os.Getenv("SRP_TIMING_TESTS") == "" {
+		t.Skip("Set SRP_TIMING_TESTS=1 to run the timing test on an idle machine")
+	}
+	grp, _ := GetGroup("rfc5054.1024")
+	m := newMontModulus(grp.Prime)
+	max := new(big.Int).Lsh(big.NewInt(1), DefaultABSize)
+	x := m.toMont(randInt(t, grp.Prime))
+
+	// Class 0 uses the exponent 1 and class 1 random exponents, which
+	// math/big handles in very different times.
+	exps := [2][]*big.Int{}
+	for i := 0; i < 64; i++ {
+		exps[0] = append(exps[0], big.NewInt(1))
+		exps[1] = append(exps[1], randInt(t, max))
+	}
+	i := 0
+	bigT := timingLeak(500, func(class int) {
+		i++
+		new(big.Int).Exp(grp.Generator, exps[class][i%64], grp.Prime)
+	})
+	if math.Abs(bigT) < timingLeakThreshold {
+		t.Fatalf("The timing test did not detect the math/big leak (t = %.2f)", bigT)
+	}
+
+	montT := timingLeak(3000, func(class int) {
+		i++
+		m.exp(x, exps[class][i%64], DefaultABSize)
+	})
+	if math.Abs(montT) > timingLeakThreshold {
+		t.Fatalf("Exponentiation time depends on the exponent (t = %.2f)", montT)
+	}
+
+	// The same for the base, with 0 against random values.
+	bases := [2][][]uint{}
+	for i := 0; i < 64; i++ {
+		bases[0] = append(bases[0], m.toMont(big.NewInt(0)))
+		bases[1] = append(bases[1], m.toMont(randInt(t, grp.Prime)))
+	}
+	montT = timingLeak(3000, func(class int) {
+		i++
+		m.exp(bases[class][i%64], exps[1][i%64], DefaultABSize)
+	})
+	if math.Abs(montT) > timingLeakThreshold {
+		t.Fatalf("Exponentiation time depends on the base (t = %.2f)", montT)
+	}
+}
+
+func BenchmarkModExp(b *testing.B) {
+	for _, name := range groups {
+		grp, _ := GetGroup(name)
+		m := newMontModulus(grp.Prime)
+		x := randInt(b, grp.Prime)
+		xm := m.toMont(x)
+		e := randInt(b, new(big.Int).Lsh(big.NewInt(1), DefaultABSize))
+
+		b.Run(name+"/big", func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				new(big.Int).Exp(x, e, grp.Prime)
+			}
+		})
+		b.Run(name+"/montgomery", func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				m.exp(xm, e, DefaultABSize)
+			}
+		})
+	}
+}
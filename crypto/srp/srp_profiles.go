@@ -0,0 +1,294 @@
+// Copyright 2013 Tad Glines
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+package srp
+
+/*
+	Profiles for interoperating with other SRP-6a implementations. Each one
+	reproduces the way a library hashes and pads the protocol values:
+
+	pysrp:         the Python srp package (without rfc5054_enable)
+	csrp:          csrp, which follows pysrp except for how x is hashed
+	bouncycastle:  Bouncy Castle's SRP6Client and SRP6Server
+	thinbus:       the Thinbus browser client, which hashes hex strings
+
+	Since x includes the username for all of these, verifiers must be
+	created with ComputeUserVerifier.
+
+	pysrp and csrp hash the salt of a session as an integer, dropping
+	leading zero bytes, but hash the salt of a new verifier as bytes. The
+	salts they generate never start with a zero byte, so the two agree, and
+	ComputeUserVerifier does the same for profiles with IntegerSalt set.
+
+	The legacy profiles implement the protocols that preceded SRP-6a:
+
+	srp6:          SRP-6, which uses k = 3
+	srp3:          SRP-3 from RFC2945, which has no k (B = v + g^b), uses
+	               the first 32 bits of H(B) as u and derives K with
+	               SHA_Interleave. x includes the username, so verifiers must
+	               be created with ComputeUserVerifier.
+*/
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"math/big"
+	"strings"
+)
+
+func hashBytes(s *SRP, data ...[]byte) []byte {
+	h := s.HashFunc()
+	for _, d := range data {
+		h.Write(d)
+	}
+	return h.Sum(nil)
+}
+
+func hashInt(s *SRP, data ...[]byte) *big.Int {
+	return new(big.Int).SetBytes(hashBytes(s, data...))
+}
+
+// hashHex hashes the concatenation of the lower case hex strings of values.
+func hashHex(s *SRP, values ...*big.Int) []byte {
+	h := s.HashFunc()
+	for _, v := range values {
+		h.Write([]byte(v.Text(16)))
+	}
+	return h.Sum(nil)
+}
+
+func identityHash(s *SRP, username, password []byte) []byte {
+	return hashBytes(s, username, []byte(":"), password)
+}
+
+// hashNxorg returns H(N) xor H(g) without dropping leading zero bytes.
+func hashNxorg(s *SRP) []byte {
+	hn := hashBytes(s, s.Group.Prime.Bytes())
+	hg := hashBytes(s, s.Group.Generator.Bytes())
+	for i := range hn {
+		hn[i] ^= hg[i]
+	}
+	return hn
+}
+
+func pysrpK(s *SRP) *big.Int {
+	// k = H(N | g)
+	return hashInt(s, s.Group.Prime.Bytes(), s.Group.Generator.Bytes())
+}
+
+func pysrpU(s *SRP, A, B *big.Int) *big.Int {
+	// u = H(A | B)
+	return hashInt(s, A.Bytes(), B.Bytes())
+}
+
+func pysrpKey(s *SRP, S, u *big.Int) []byte {
+	// K = H(S)
+	return hashBytes(s, S.Bytes())
+}
+
+func pysrpClientAuthenticator(s *SRP, p *ProofValues) []byte {
+	// M = H(H(N) xor H(g) | H(I) | s | A | B | K)
+	salt := new(big.Int).SetBytes(p.Salt).Bytes()
+	return hashBytes(s, hashNxorg(s), hashBytes(s, p.Username), salt, p.A.Bytes(), p.B.Bytes(), p.K)
+}
+
+func pysrpServerAuthenticator(s *SRP, p *ProofValues) []byte {
+	// H(A | M | K)
+	return hashBytes(s, p.A.Bytes(), p.M1, p.K)
+}
+
+var pysrp_profile *Profile = &Profile{
+	Name:        "pysrp",
+	IntegerSalt: true,
+	ComputeK:    pysrpK,
+	ComputeX: func(s *SRP, username, salt, password []byte) *big.Int {
+		// x = H(s | H(I | ":" | P)) where s and the inner hash are treated as
+		// integers, so leading zero bytes are dropped.
+		ih := new(big.Int).SetBytes(identityHash(s, username, password))
+		return hashInt(s, new(big.Int).SetBytes(salt).Bytes(), ih.Bytes())
+	},
+	ComputeU:            pysrpU,
+	ComputeKey:          pysrpKey,
+	ClientAuthenticator: pysrpClientAuthenticator,
+	ServerAuthenticator: pysrpServerAuthenticator,
+}
+
+var csrp_profile *Profile = &Profile{
+	Name:        "csrp",
+	IntegerSalt: true,
+	ComputeK:    pysrpK,
+	ComputeX: func(s *SRP, username, salt, password []byte) *big.Int {
+		// x = H(s | H(I | ":" | P)) where only s is treated as an integer.
+		return hashInt(s, new(big.Int).SetBytes(salt).Bytes(), identityHash(s, username, password))
+	},
+	ComputeU:            pysrpU,
+	ComputeKey:          pysrpKey,
+	ClientAuthenticator: pysrpClientAuthenticator,
+	ServerAuthenticator: pysrpServerAuthenticator,
+}
+
+var bouncycastle_profile *Profile = &Profile{
+	Name: "bouncycastle",
+	ComputeK: func(s *SRP) *big.Int {
+		// k = H(PAD(N) | PAD(g))
+		return hashInt(s, s.pad(s.Group.Prime), s.pad(s.Group.Generator))
+	},
+	ComputeX: func(s *SRP, username, salt, password []byte) *big.Int {
+		// x = H(s | H(I | ":" | P))
+		return hashInt(s, salt, identityHash(s, username, password))
+	},
+	ComputeU: func(s *SRP, A, B *big.Int) *big.Int {
+		// u = H(PAD(A) | PAD(B))
+		return hashInt(s, s.pad(A), s.pad(B))
+	},
+	ComputeKey: func(s *SRP, S, u *big.Int) []byte {
+		// K = H(PAD(S))
+		return hashBytes(s, s.pad(S))
+	},
+	ClientAuthenticator: func(s *SRP, p *ProofValues) []byte {
+		// M1 = H(PAD(A) | PAD(B) | PAD(S))
+		return hashBytes(s, s.pad(p.A), s.pad(p.B), s.pad(p.S))
+	},
+	ServerAuthenticator: func(s *SRP, p *ProofValues) []byte {
+		// M2 = H(PAD(A) | PAD(M1) | PAD(S))
+		return hashBytes(s, s.pad(p.A), s.pad(new(big.Int).SetBytes(p.M1)), s.pad(p.S))
+	},
+}
+
+// Thinbus exchanges values as hex strings, so authenticators passed to and
+// from it must be decoded to the full hash size.
+var thinbus_profile *Profile = &Profile{
+	Name: "thinbus",
+	ComputeK: func(s *SRP) *big.Int {
+		// k = H(hex(N) | hex(g))
+		return new(big.Int).SetBytes(hashHex(s, s.Group.Prime, s.Group.Generator))
+	},
+	ComputeX: func(s *SRP, username, salt, password []byte) *big.Int {
+		// x = H(upper(hex(s) | hex(H(I | ":" | P)))) mod N where leading zeros
+		// of the inner hex string are trimmed.
+		ih := strings.TrimLeft(hex.EncodeToString(identityHash(s, username, password)), "0")
+		x := hashInt(s, []byte(strings.ToUpper(hex.EncodeToString(salt)+ih)))
+		return x.Mod(x, s.Group.Prime)
+	},
+	ComputeU: func(s *SRP, A, B *big.Int) *big.Int {
+		// u = H(hex(A) | hex(B))
+		return new(big.Int).SetBytes(hashHex(s, A, B))
+	},
+	ComputeKey: func(s *SRP, S, u *big.Int) []byte {
+		// K = H(hex(S))
+		return hashHex(s, S)
+	},
+	ClientAuthenticator: func(s *SRP, p *ProofValues) []byte {
+		// M1 = H(hex(A) | hex(B) | hex(S))
+		return hashHex(s, p.A, p.B, p.S)
+	},
+	ServerAuthenticator: func(s *SRP, p *ProofValues) []byte {
+		// M2 = H(hex(A) | hex(M1) | hex(S))
+		return hashHex(s, p.A, new(big.Int).SetBytes(p.M1), p.S)
+	},
+}
+
+func rfc2945ClientAuthenticator(s *SRP, p *ProofValues) []byte {
+	// M = H(H(N) xor H(g) | H(I) | s | A | B | K)
+	return hashBytes(s, hashNxorg(s), hashBytes(s, p.Username), p.Salt, p.A.Bytes(), p.B.Bytes(), p.K)
+}
+
+func rfc2945ServerAuthenticator(s *SRP, p *ProofValues) []byte {
+	// H(A | M | K)
+	return hashBytes(s, p.A.Bytes(), p.M1, p.K)
+}
+
+// sha_interleave implements the SHA_Interleave function from RFC2945 using
+// the configured hash.
+func sha_interleave(s *SRP, S *big.Int) []byte {
+	T := S.Bytes()
+	if len(T)%2 == 1 {
+		T = T[1:]
+	}
+	E := make([]byte, len(T)/2)
+	F := make([]byte, len(T)/2)
+	for i := range E {
+		E[i] = T[2*i]
+		F[i] = T[2*i+1]
+	}
+	G := hashBytes(s, E)
+	H := hashBytes(s, F)
+	K := make([]byte, 0, len(G)+len(H))
+	for i := range G {
+		K = append(K, G[i], H[i])
+	}
+	return K
+}
+
+var srp6_profile *Profile = &Profile{
+	Name:   "srp6",
+	Legacy: true,
+	ComputeK: func(s *SRP) *big.Int {
+		return big.NewInt(3)
+	},
+	ComputeKey:          pysrpKey,
+	ClientAuthenticator: rfc2945ClientAuthenticator,
+	ServerAuthenticator: rfc2945ServerAuthenticator,
+}
+
+var srp3_profile *Profile = &Profile{
+	Name:   "srp3",
+	Legacy: true,
+	ComputeK: func(s *SRP) *big.Int {
+		return big.NewInt(1)
+	},
+	ComputeX: func(s *SRP, username, salt, password []byte) *big.Int {
+		// x = H(s | H(I | ":" | P))
+		return hashInt(s, salt, identityHash(s, username, password))
+	},
+	ComputeU: func(s *SRP, A, B *big.Int) *big.Int {
+		// u = the first 32 bits of H(B)
+		hb := hashBytes(s, B.Bytes())
+		return new(big.Int).SetUint64(uint64(binary.BigEndian.Uint32(hb)))
+	},
+	ComputeKey: func(s *SRP, S, u *big.Int) []byte {
+		return sha_interleave(s, S)
+	},
+	ClientAuthenticator: rfc2945ClientAuthenticator,
+	ServerAuthenticator: rfc2945ServerAuthenticator,
+}
+
+var srp_profiles map[string]*Profile = map[string]*Profile{
+	"pysrp":        pysrp_profile,
+	"csrp":         csrp_profile,
+	"bouncycastle": bouncycastle_profile,
+	"thinbus":      thinbus_profile,
+	"srp6":         srp6_profile,
+	"srp3":         srp3_profile,
+	"tuple":        tuple_profile,
+}
+
+// GetProfile retrieves a registered Profile.
+// The pre-registered profiles are: pysrp, csrp, bouncycastle, thinbus, the
+// legacy srp6 and srp3 profiles and the tuple profile (see srp_tuple.go).
+// This function must be called by only one goroutine at a time.
+func GetProfile(name string) (*Profile, error) {
+	p, ok := srp_profiles[name]
+	if !ok {
+		return nil, fmt.Errorf("Invalid SRP Profile: %s", name)
+	}
+	return p, nil
+}
+
+// RegisterProfile will register a Profile for use with SRP.
+// This function must be called by only one goroutine at a time.
+func RegisterProfile(name string, profile *Profile) {
+	srp_profiles[name] = profile
+}
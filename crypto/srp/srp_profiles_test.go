@@ -0,0 +1,276 @@
+// Copyright 2013 Tad Glines
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+package srp
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// profileTranscript is a handshake recorded from the arithmetic of another
+// SRP library. The files in testdata hold two transcripts (SHA-1 and SHA-256)
+// per profile. The passwords were chosen so that H(I | ":" | P) starts with a
+// zero byte and the salt starts with a zero byte, which are the cases where
+// the libraries disagree.
+type profileTranscript struct {
+	Profile  string
+	Group    string
+	Hash     string
+	Username string
+	Password string
+	Salt     string
+	Sa       string `json:"a"`
+	Sb       string `json:"b"`
+	V        string `json:"v"`
+	A        string
+	B        string
+	K        string
+	M1       string
+	M2       string
+}
+
+func hexInt(t *testing.T, s string) *big.Int {
+	n, ok := new(big.Int).SetString(s, 16)
+	if !ok {
+		t.Fatalf("Invalid hex value: %s", s)
+	}
+	return n
+}
+
+func hexBytes(t *testing.T, s string) []byte {
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+// setEphemerals replaces the random a and b of a session pair with fixed
+// values and recomputes A and B.
+func setEphemerals(cs *ClientSession, ss *ServerSession, a, b *big.Int) {
+	s := cs.SRP
+	cs._a = a
+	cs._A = new(big.Int).Exp(s.Group.Generator, a, s.Group.Prime)
+	ss._b = b
+	ss._B = new(big.Int).Mul(s.get_k(), ss._v)
+	ss._B.Add(ss._B, new(big.Int).Exp(s.Group.Generator, b, s.Group.Prime))
+	ss._B.Mod(ss._B, s.Group.Prime)
+}
+
+func testProfileTranscript(t *testing.T, tr *profileTranscript) {
+	h := sha1.New
+	if tr.Hash == "sha256" {
+		h = sha256.New
+	}
+	s, err := NewSRP(tr.Group, h, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Profile, err = GetProfile(tr.Profile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	username, password := []byte(tr.Username), []byte(tr.Password)
+	salt := hexBytes(t, tr.Salt)
+	x := s.compute_x(username, salt, password)
+	v := new(big.Int).Exp(s.Group.Generator, x, s.Group.Prime)
+	if v.Cmp(hexInt(t, tr.V)) != 0 {
+		t.Fatalf("%s/%s: verifier mismatch", tr.Profile, tr.Hash)
+	}
+
+	cs := s.NewClientSession(username, password)
+	ss := s.NewServerSession(username, salt, v.Bytes())
+	setEphemerals(cs, ss, hexInt(t, tr.Sa), hexInt(t, tr.Sb))
+	if cs._A.Cmp(hexInt(t, tr.A)) != 0 {
+		t.Fatalf("%s/%s: A mismatch", tr.Profile, tr.Hash)
+	}
+	if ss._B.Cmp(hexInt(t, tr.B)) != 0 {
+		t.Fatalf("%s/%s: B mismatch", tr.Profile, tr.Hash)
+	}
+
+	ckey, err := cs.ComputeKey(salt, ss.GetB())
+	if err != nil {
+		t.Fatal(err)
+	}
+	skey, err := ss.ComputeKey(cs.GetA())
+	if err != nil {
+		t.Fatal(err)
+	}
+	K := hexBytes(t, tr.K)
+	if !bytes.Equal(ckey, K) || !bytes.Equal(skey, K) {
+		t.Fatalf("%s/%s: K mismatch", tr.Profile, tr.Hash)
+	}
+
+	M1 := hexBytes(t, tr.M1)
+	if cauth := cs.ComputeAuthenticator(); !bytes.Equal(cauth, M1) {
+		t.Fatalf("%s/%s: M1 mismatch", tr.Profile, tr.Hash)
+	}
+	if !ss.VerifyClientAuthenticator(M1) {
+		t.Fatalf("%s/%s: M1 not accepted by server", tr.Profile, tr.Hash)
+	}
+	M2 := hexBytes(t, tr.M2)
+	if sauth := ss.ComputeAuthenticator(M1); !bytes.Equal(sauth, M2) {
+		t.Fatalf("%s/%s: M2 mismatch", tr.Profile, tr.Hash)
+	}
+	if !cs.VerifyServerAuthenticator(M2) {
+		t.Fatalf("%s/%s: M2 not accepted by client", tr.Profile, tr.Hash)
+	}
+}
+
+func TestProfileTranscripts(t *testing.T) {
+	files, err := filepath.Glob(filepath.Join("testdata", "*.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) == 0 {
+		t.Fatal("No transcripts found")
+	}
+	for _, f := range files {
+		data, err := os.ReadFile(f)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var trs []*profileTranscript
+		if err := json.Unmarshal(data, &trs); err != nil {
+			t.Fatalf("%s: %v", f, err)
+		}
+		for _, tr := range trs {
+			testProfileTranscript(t, tr)
+		}
+	}
+}
+
+func TestProfilesRoundTrip(t *testing.T) {
+	for name := range srp_profiles {
+		p, err := GetProfile(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		s, err := NewSRP("rfc5054.1024", sha256.New, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		s.Profile = p
+
+		username, password := []byte("test"), []byte("password")
+		salt, v, err := s.ComputeUserVerifier(username, password)
+		if err != nil {
+			t.Fatal(err)
+		}
+		cs := s.NewClientSession(username, password)
+		ss := s.NewServerSession(username, salt, v)
+		if _, err := cs.ComputeKey(salt, ss.GetB()); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := ss.ComputeKey(cs.GetA()); err != nil {
+			t.Fatal(err)
+		}
+		cauth := cs.ComputeAuthenticator()
+		if !ss.VerifyClientAuthenticator(cauth) {
+			t.Fatalf("%s: Client Authenticator is not valid", name)
+		}
+		if !cs.VerifyServerAuthenticator(ss.ComputeAuthenticator(cauth)) {
+			t.Fatalf("%s: Server Authenticator is not valid", name)
+		}
+	}
+}
+
+func TestIntegerSalt(t *testing.T) {
+	for _, name := range []string{"pysrp", "csrp"} {
+		s, err := NewSRP("rfc5054.1024", sha256.New, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		s.Profile, _ = GetProfile(name)
+		// Salts drawn with a leading zero byte are drawn again.
+		s.Rand = io.MultiReader(bytes.NewReader(make([]byte, s.SaltLength+2)), rand.Reader)
+		username, password := []byte("test"), []byte("password")
+		salt, v, err := s.ComputeUserVerifier(username, password)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if salt[0] == 0 {
+			t.Fatalf("%s: salt starts with a zero byte: %x", name, salt)
+		}
+		// The verifier is the one of a peer hashing the salt as bytes.
+		var x *big.Int
+		if name == "pysrp" {
+			x = hashInt(s, salt, new(big.Int).SetBytes(identityHash(s, username, password)).Bytes())
+		} else {
+			x = hashInt(s, salt, identityHash(s, username, password))
+		}
+		if new(big.Int).Exp(s.Group.Generator, x, s.Group.Prime).Cmp(new(big.Int).SetBytes(v)) != 0 {
+			t.Fatalf("%s: verifier depends on how the salt is hashed", name)
+		}
+	}
+}
+
+func TestLegacyProfiles(t *testing.T) {
+	for name, k := range map[string]int64{"srp6": 3, "srp3": 1} {
+		p, err := GetProfile(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !p.Legacy {
+			t.Fatalf("%s is not flagged as legacy", name)
+		}
+		s, err := NewSRP("rfc5054.1024", sha1.New, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		s.Profile = p
+
+		// B = kv + g^b
+		ss := s.NewServerSession([]byte("test"), []byte("salt"), []byte{7})
+		B := new(big.Int).Exp(s.Group.Generator, ss._b, s.Group.Prime)
+		B.Add(B, big.NewInt(7*k))
+		B.Mod(B, s.Group.Prime)
+		if B.Cmp(ss._B) != 0 {
+			t.Fatalf("%s: B != %dv + g^b", name, k)
+		}
+	}
+
+	p, _ := GetProfile("srp3")
+	s, _ := NewSRP("rfc5054.1024", sha1.New, nil)
+	if u := p.ComputeU(s, big.NewInt(1), big.NewInt(2)); u.BitLen() > 32 {
+		t.Fatalf("srp3: u is %d bits", u.BitLen())
+	}
+}
+
+func TestSHAInterleave(t *testing.T) {
+	s, _ := NewSRP("rfc5054.1024", sha1.New, nil)
+	// The leading zero is dropped, then the first byte since the length is odd.
+	K := sha_interleave(s, new(big.Int).SetBytes([]byte{0, 9, 1, 2, 3, 4}))
+	G := sha1.Sum([]byte{1, 3})
+	H := sha1.Sum([]byte{2, 4})
+	if len(K) != 40 {
+		t.Fatalf("Expected a key size of %d, got %d", 40, len(K))
+	}
+	for i := range G {
+		if K[2*i] != G[i] || K[2*i+1] != H[i] {
+			t.Fatalf("Unexpected interleaved key: %x", K)
+		}
+	}
+}
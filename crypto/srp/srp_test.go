@@ -20,6 +20,7 @@ import (
 	"crypto/sha256"
 	"crypto/sha512"
 	"hash"
+	"math/big"
 	"testing"
 )
 
@@ -61,6 +62,10 @@ func testSRP(t *testing.T, group string, h func() hash.Hash, username, password
 	if err != nil {
 		t.Fatal(err)
 	}
+	testSession(t, srp, username, password)
+}
+
+func testSession(t *testing.T, srp *SRP, username, password []byte) {
 	cs := srp.NewClientSession(username, password)
 	salt, v, err := srp.ComputeVerifier(password)
 	if err != nil {
@@ -88,8 +93,8 @@ func testSRP(t *testing.T, group string, h func() hash.Hash, username, password
 		if cs._u.Cmp(ss._u) != 0 {
 			t.Logf("u isn't the same for client and server")
 		}
-		t.Fatalf("Keys don't match(%s:%d):\n    Ckey: %v\n    Skey: %v\n",
-			group, h().Size(), ckey, skey)
+		t.Fatalf("Keys don't match(%d:%d):\n    Ckey: %v\n    Skey: %v\n",
+			srp.Group.Size, srp.HashFunc().Size(), ckey, skey)
 	}
 
 	cauth := cs.ComputeAuthenticator()
@@ -112,3 +117,87 @@ func TestSRPSimple(t *testing.T) {
 		}
 	}
 }
+
+func isZero(b []byte) bool {
+	for _, v := range b {
+		if v != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// limbsOf returns the limbs of x including unused capacity, which Destroy
+// must also wipe.
+func limbsOf(x *big.Int) []big.Word {
+	w := x.Bits()
+	return w[:cap(w)]
+}
+
+func isZeroInt(w []big.Word) bool {
+	for _, v := range w {
+		if v != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+func TestDestroy(t *testing.T) {
+	srp, err := NewSRP("rfc5054.1024", sha256.New, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	username, password := []byte("test"), []byte("password")
+	salt, v, err := srp.ComputeVerifier(password)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cs := srp.NewClientSession(username, password)
+	ss := srp.NewServerSession(username, salt, v)
+
+	pw := cs.password
+	if _, err := cs.ComputeKey(salt, ss.GetB()); err != nil {
+		t.Fatal(err)
+	}
+	if cs.password != nil || !isZero(pw) {
+		t.Fatal("Password was not wiped after computing x")
+	}
+	if string(password) != "password" {
+		t.Fatal("The caller's password was modified")
+	}
+	if _, err := ss.ComputeKey(cs.GetA()); err != nil {
+		t.Fatal(err)
+	}
+	cauth := cs.ComputeAuthenticator()
+	if !ss.VerifyClientAuthenticator(cauth) {
+		t.Fatal("Client Authenticator is not valid")
+	}
+
+	cint := [][]big.Word{limbsOf(cs._a), limbsOf(cs._S)}
+	cbytes := [][]byte{cs.key, cs._M}
+	sint := [][]big.Word{limbsOf(ss._b), limbsOf(ss._v), limbsOf(ss._S)}
+	sbytes := [][]byte{ss.key}
+	cs.Destroy()
+	ss.Destroy()
+
+	for i, w := range append(cint, sint...) {
+		if !isZeroInt(w) {
+			t.Errorf("Secret integer %d was not wiped", i)
+		}
+	}
+	for i, b := range append(cbytes, sbytes...) {
+		if !isZero(b) {
+			t.Errorf("Secret bytes %d were not wiped", i)
+		}
+	}
+	if cs.password != nil || cs._a != nil || cs._S != nil || cs.key != nil || cs._M != nil {
+		t.Error("ClientSession still references its secrets")
+	}
+	if ss.verifier != nil || ss._b != nil || ss._v != nil || ss._S != nil || ss.key != nil {
+		t.Error("ServerSession still references its secrets")
+	}
+	if isZero(v) {
+		t.Error("The caller's verifier was modified")
+	}
+}
@@ -0,0 +1,110 @@
+// Copyright 2013 Tad Glines
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+package srp
+
+/*
+	The tuple profile is an opt-in variant of SRP-6a in which no hash input
+	is a plain concatenation. The other formulas concatenate values of
+	variable length, so different values can hash the same: the default
+	x = H(s | P) is the same for the salt "ab" and the password "c" as for
+	the salt "a" and the password "bc". In the tuple profile every input is
+	prefixed with its length and every hash with a label naming the value it
+	computes, so a hash determines the label and the sequence of inputs it
+	was computed from.
+
+	The transcript, where H is the configured hash and KDF the configured
+	key derivation function:
+
+		enc(v)            = len(v) | v
+		TH(label, v1..vn) = H(enc("srp tuple " | label) | enc(v1) | ... | enc(vn))
+		PAD(n)            = n big endian, left padded with zeros to the size of N
+
+		k  = TH("k", N, PAD(g))
+		x  = TH("x", I, s, KDF(s, P))
+		u  = TH("u", PAD(A), PAD(B))
+		K  = TH("K", PAD(S))
+		M1 = TH("M1", N, PAD(g), I, s, PAD(A), PAD(B), K)
+		M2 = TH("M2", PAD(A), M1, K)
+
+	with len as a big endian uint32, N without leading zeros, I the username
+	and s the salt as they were sent. A, B, S, v and the checks on them are
+	those of SRP-6a. Values bound to the session are mixed into M1 and M2
+	as for the other formulas (see bind.go), which is unambiguous as well
+	since M has the size of the hash and the bound values are length
+	prefixed.
+
+	x depends on the username, so verifiers must be created with
+	ComputeUserVerifier. Unlike the other profiles, x is derived from the
+	output of the KeyDerivationFunc, so the profile can be combined with
+	PBKDF2 or scrypt and is allowed by ApprovedPolicy.
+*/
+
+import (
+	"encoding/binary"
+	"math/big"
+)
+
+// tupleLabel prefixes the labels of the tuple profile.
+const tupleLabel = "srp tuple "
+
+// tupleHash returns TH(label, values).
+func tupleHash(s *SRP, label string, values ...[]byte) []byte {
+	h := s.HashFunc()
+	var l [4]byte
+	write := func(v []byte) {
+		binary.BigEndian.PutUint32(l[:], uint32(len(v)))
+		h.Write(l[:])
+		h.Write(v)
+	}
+	write([]byte(tupleLabel + label))
+	for _, v := range values {
+		write(v)
+	}
+	return h.Sum(nil)
+}
+
+var tuple_profile *Profile = &Profile{
+	Name:    "tuple",
+	UsesKDF: true,
+	ComputeK: func(s *SRP) *big.Int {
+		// k = TH("k", N, PAD(g))
+		return new(big.Int).SetBytes(tupleHash(s, "k", s.Group.Prime.Bytes(), s.pad(s.Group.Generator)))
+	},
+	ComputeX: func(s *SRP, username, salt, password []byte) *big.Int {
+		// x = TH("x", I, s, KDF(s, P))
+		key := s.KeyDerivationFunc(salt, password)
+		defer wipeBytes(key)
+		return new(big.Int).SetBytes(tupleHash(s, "x", username, salt, key))
+	},
+	ComputeU: func(s *SRP, A, B *big.Int) *big.Int {
+		// u = TH("u", PAD(A), PAD(B))
+		return new(big.Int).SetBytes(tupleHash(s, "u", s.pad(A), s.pad(B)))
+	},
+	ComputeKey: func(s *SRP, S, u *big.Int) []byte {
+		// K = TH("K", PAD(S))
+		Sb := s.pad(S)
+		defer wipeBytes(Sb)
+		return tupleHash(s, "K", Sb)
+	},
+	ClientAuthenticator: func(s *SRP, p *ProofValues) []byte {
+		// M1 = TH("M1", N, PAD(g), I, s, PAD(A), PAD(B), K)
+		return tupleHash(s, "M1", s.Group.Prime.Bytes(), s.pad(s.Group.Generator),
+			p.Username, p.Salt, s.pad(p.A), s.pad(p.B), p.K)
+	},
+	ServerAuthenticator: func(s *SRP, p *ProofValues) []byte {
+		// M2 = TH("M2", PAD(A), M1, K)
+		return tupleHash(s, "M2", s.pad(p.A), p.M1, p.K)
+	},
+}
@@ -0,0 +1,149 @@
+// Copyright 2013 Tad Glines
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+package srp
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"math/big"
+	"testing"
+)
+
+func tupleSRP(t *testing.T, params map[string]string) *SRP {
+	p := map[string]string{ParamProfile: "tuple"}
+	for k, v := range params {
+		p[k] = v
+	}
+	s, err := NewSRPWithParams("rfc5054.1024", p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func TestTupleProfile(t *testing.T) {
+	for _, params := range []map[string]string{
+		nil,
+		{ParamHash: "sha1"},
+		{ParamKDF: "pbkdf2", ParamIter: "1000"},
+	} {
+		s := tupleSRP(t, params)
+		salt, v, err := s.ComputeUserVerifier([]byte("alice"), []byte("password123"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		cs := s.NewClientSession([]byte("alice"), []byte("password123"))
+		ss := s.NewServerSession([]byte("alice"), salt, v)
+		if _, err := ss.ComputeKey(cs.GetA()); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := cs.ComputeKey(salt, ss.GetB()); err != nil {
+			t.Fatal(err)
+		}
+		M1 := cs.ComputeAuthenticator()
+		if !ss.VerifyClientAuthenticator(M1) {
+			t.Fatalf("%v: Client Authenticator is not valid", params)
+		}
+		if !cs.VerifyServerAuthenticator(ss.ComputeAuthenticator(M1)) {
+			t.Fatalf("%v: Server Authenticator is not valid", params)
+		}
+	}
+}
+
+// TestTupleVector checks the tuple profile against values computed from the
+// transcript in srp_tuple.go by an independent implementation.
+func TestTupleVector(t *testing.T) {
+	s := tupleSRP(t, nil)
+	I, P := []byte("alice"), []byte("password123")
+	salt := hexBytes(t, "beb25379d1a8581eb5a727673a2441ee")
+	a := hexInt(t, "60975527035cf2ad1989806f0407210bc81edc04e2762a56afd529ddda2d4393")
+	b := hexInt(t, "e487cb59d31ac550471e81f00f6928e01dda08e974a004f49e61f5d105284d20")
+
+	v := new(big.Int).Exp(s.Group.Generator, s.ComputeX(I, salt, P), s.Group.Prime)
+	cs := s.NewClientSession(I, P)
+	ss := s.NewServerSession(I, salt, v.Bytes())
+	setEphemerals(cs, ss, a, b)
+	K, err := ss.ComputeKey(cs.GetA())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := cs.ComputeKey(salt, ss.GetB()); err != nil {
+		t.Fatal(err)
+	}
+	M1 := cs.ComputeAuthenticator()
+	M2 := ss.ComputeAuthenticator(M1)
+
+	for _, test := range []struct {
+		name  string
+		value []byte
+		hex   string
+	}{
+		{"k", s.ComputeK().Bytes(), "57c3fd2cc38678cc58f587a67628e5d737fd01ebc79abace60b845b683d4b1dd"},
+		{"x", s.ComputeX(I, salt, P).Bytes(), "e2a2efe4710f720003b19359ac6311ffbe282cdd8cad99ee4118ba15f86a2d3d"},
+		{"u", s.ComputeU(cs._A, ss._B).Bytes(), "9293528a9e0fcf946d1c9250b622ea16a8f4ed7646c79ed8fe57c1db02e73953"},
+		{"K", K, "7093775648aa90721eaf3dd50163815a747aecfde95e79947512ed9a0a40f3b6"},
+		{"M1", M1, "e17494a3d82195fd4d9c5e45b526ff0a40db5fa94acbc7a41a6ddc1f80bdde12"},
+		{"M2", M2, "15247065a8656a16f2ef110cd4b617f5153b6c5cc635bbc7ab2fa3f764b65b08"},
+	} {
+		if hex.EncodeToString(test.value) != test.hex {
+			t.Errorf("%s: expected %s, got %x", test.name, test.hex, test.value)
+		}
+	}
+}
+
+// TestTupleUnambiguous checks that moving bytes between adjacent inputs
+// changes the values of the tuple profile, where it does not change those of
+// the default formulas.
+func TestTupleUnambiguous(t *testing.T) {
+	s, err := NewSRP("rfc5054.1024", sha256.New, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.ComputeX(nil, []byte("ab"), []byte("c")).Cmp(s.ComputeX(nil, []byte("a"), []byte("bc"))) != 0 {
+		t.Fatal("Expected the default x to be ambiguous")
+	}
+
+	s = tupleSRP(t, nil)
+	for _, pair := range [][2][3]string{
+		{{"alice", "ab", "c"}, {"alice", "a", "bc"}},
+		{{"ab", "c", "pw"}, {"a", "bc", "pw"}},
+		{{"ab", "", "pw"}, {"a", "b", "pw"}},
+	} {
+		x1 := s.ComputeX([]byte(pair[0][0]), []byte(pair[0][1]), []byte(pair[0][2]))
+		x2 := s.ComputeX([]byte(pair[1][0]), []byte(pair[1][1]), []byte(pair[1][2]))
+		if x1.Cmp(x2) == 0 {
+			t.Errorf("x of %q and %q are equal", pair[0], pair[1])
+		}
+	}
+
+	p := &ProofValues{
+		Username: []byte("ab"),
+		Salt:     []byte("c"),
+		A:        big.NewInt(2),
+		B:        big.NewInt(3),
+		K:        []byte("key"),
+	}
+	M1 := s.ComputeClientAuthenticator(p)
+	p.Username, p.Salt = []byte("a"), []byte("bc")
+	if bytes.Equal(M1, s.ComputeClientAuthenticator(p)) {
+		t.Error("M1 of different usernames and salts are equal")
+	}
+
+	// The labels separate values computed from the same inputs.
+	if bytes.Equal(tupleHash(s, "u", []byte("a"), []byte("b")), tupleHash(s, "k", []byte("a"), []byte("b"))) {
+		t.Error("Hashes with different labels are equal")
+	}
+}
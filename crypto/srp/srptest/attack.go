@@ -0,0 +1,330 @@
+// Copyright 2013 Tad Glines
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+package srptest
+
+import (
+	"github.com/lann/go-pkgs/crypto/srp"
+	"math/big"
+	"testing"
+)
+
+// Server is the server side of one handshake. Code under test is adapted to
+// it, for example by relaying the messages over a connection.
+type Server interface {
+	// Challenge handles the client's hello.
+	Challenge(hello *srp.ClientHello) (*srp.ServerChallenge, error)
+	// Verify handles the client's proof and returns the server's proof if
+	// the client is authenticated, or an error otherwise.
+	Verify(proof *srp.ClientProof) (*srp.ServerProof, error)
+}
+
+// Client is the client side of one handshake.
+type Client interface {
+	Hello() (*srp.ClientHello, error)
+	// Proof handles the server's challenge.
+	Proof(challenge *srp.ServerChallenge) (*srp.ClientProof, error)
+	// Verify returns an error unless the server's proof is valid.
+	Verify(proof *srp.ServerProof) error
+}
+
+// NewServer returns a Server using package srp for the users in store. s
+// must use the group and parameters of the records.
+func NewServer(s *srp.SRP, store *Store) Server {
+	return &refServer{s: s, store: store}
+}
+
+type refServer struct {
+	s     *srp.SRP
+	store *Store
+	ss    *srp.ServerSession
+	key   []byte
+}
+
+func (r *refServer) Challenge(hello *srp.ClientHello) (*srp.ServerChallenge, error) {
+	if err := hello.Validate(r.s); err != nil {
+		return nil, err
+	}
+	rec, _ := r.store.Lookup(string(hello.Username))
+	if rec == nil {
+		return nil, errorf("unknown user: %s", hello.Username)
+	}
+	r.ss = r.s.NewServerSession(rec.Username, rec.Salt, rec.Verifier)
+	key, err := r.ss.ComputeKey(hello.A)
+	if err != nil {
+		return nil, err
+	}
+	r.key = key
+	return &srp.ServerChallenge{Salt: rec.Salt, B: r.ss.GetB(), Group: rec.Group, Params: rec.Params}, nil
+}
+
+func (r *refServer) Verify(proof *srp.ClientProof) (*srp.ServerProof, error) {
+	if r.ss == nil {
+		return nil, errorf("no challenge")
+	}
+	if err := proof.Validate(r.s); err != nil {
+		return nil, err
+	}
+	if !r.ss.VerifyClientAuthenticator(proof.M1) {
+		return nil, errorf("client proof rejected")
+	}
+	return &srp.ServerProof{M2: r.ss.ComputeAuthenticator(proof.M1)}, nil
+}
+
+// NewClient returns a Client using package srp for the user.
+func NewClient(s *srp.SRP, username, password string) Client {
+	return &refClient{s: s, username: []byte(username), password: []byte(password)}
+}
+
+type refClient struct {
+	s        *srp.SRP
+	username []byte
+	password []byte
+	cs       *srp.ClientSession
+	key      []byte
+}
+
+func (r *refClient) Hello() (*srp.ClientHello, error) {
+	r.cs = r.s.NewClientSession(r.username, r.password)
+	return &srp.ClientHello{Username: r.username, A: r.cs.GetA()}, nil
+}
+
+func (r *refClient) Proof(challenge *srp.ServerChallenge) (*srp.ClientProof, error) {
+	if r.cs == nil {
+		return nil, errorf("no hello")
+	}
+	if err := challenge.Validate(r.s); err != nil {
+		return nil, err
+	}
+	key, err := r.cs.ComputeKey(challenge.Salt, challenge.B)
+	if err != nil {
+		return nil, err
+	}
+	r.key = key
+	return &srp.ClientProof{M1: r.cs.ComputeAuthenticator()}, nil
+}
+
+func (r *refClient) Verify(proof *srp.ServerProof) error {
+	if r.cs == nil || !r.cs.VerifyServerAuthenticator(proof.M2) {
+		return errorf("server proof rejected")
+	}
+	return nil
+}
+
+// Malicious is a public value chosen by an attacker.
+type Malicious struct {
+	Name  string
+	Value []byte
+}
+
+// MaliciousValues returns values of A or B that are 0 mod N and so force
+// the premaster secret S to 0, or that are out of range: 0, N, 2N, 3N, N+1
+// and N padded with a leading zero.
+func MaliciousValues(s *srp.SRP) []Malicious {
+	N := s.Group.Prime
+	kN := func(k int64) []byte {
+		return new(big.Int).Mul(N, big.NewInt(k)).Bytes()
+	}
+	return []Malicious{
+		{"0", []byte{0}},
+		{"N", kN(1)},
+		{"2N", kN(2)},
+		{"3N", kN(3)},
+		{"N+1", new(big.Int).Add(N, big.NewInt(1)).Bytes()},
+		{"0|N", append([]byte{0}, N.Bytes()...)},
+	}
+}
+
+// forged returns the proof values an attacker who sent a value that is 0
+// mod N can compute: S is then 0 whatever the password.
+func forged(s *srp.SRP, username, salt, A, B []byte) *srp.ProofValues {
+	a, b := new(big.Int).SetBytes(A), new(big.Int).SetBytes(B)
+	S := new(big.Int)
+	return &srp.ProofValues{
+		Username: username,
+		Salt:     salt,
+		A:        a,
+		B:        b,
+		S:        S,
+		K:        s.ComputeSessionKey(S, s.ComputeU(a, b)),
+	}
+}
+
+// CheckServer attacks servers created by newServer and fails tb for every
+// attack that is not rejected. The server must hold a record for username
+// and password using the group and parameters. The attacks are:
+//
+//	A = 0, N, 2N, 3N with the proof for S = 0, and other out of range A
+//	a truncated, an empty and a wrong proof
+//	a proof replayed from an earlier handshake
+//	a proof made with the wrong password
+func CheckServer(tb testing.TB, group string, params map[string]string, newServer func() Server, username, password string) {
+	tb.Helper()
+	s := NewSRP(tb, group, params, "attacker")
+
+	// An honest handshake, which must succeed.
+	honest := func() (*srp.ClientHello, *srp.ClientProof, error) {
+		c := NewClient(s, username, password)
+		hello, _ := c.Hello()
+		server := newServer()
+		challenge, err := server.Challenge(hello)
+		if err != nil {
+			return nil, nil, err
+		}
+		proof, err := c.Proof(challenge)
+		if err != nil {
+			return nil, nil, err
+		}
+		sproof, err := server.Verify(proof)
+		if err != nil {
+			return nil, nil, err
+		}
+		return hello, proof, c.Verify(sproof)
+	}
+	hello, proof, err := honest()
+	if err != nil {
+		tb.Fatalf("srptest: honest handshake failed: %v", err)
+	}
+
+	for _, m := range MaliciousValues(s) {
+		server := newServer()
+		challenge, err := server.Challenge(&srp.ClientHello{Username: []byte(username), A: m.Value})
+		if err != nil {
+			continue
+		}
+		p := forged(s, []byte(username), challenge.Salt, m.Value, challenge.B)
+		if _, err := server.Verify(&srp.ClientProof{M1: s.ComputeClientAuthenticator(p)}); err == nil {
+			tb.Errorf("srptest: A=%s: forged proof accepted", m.Name)
+		}
+	}
+
+	wrong := func(name string, M1 []byte) {
+		c := NewClient(s, username, password)
+		hello, _ := c.Hello()
+		server := newServer()
+		if _, err := server.Challenge(hello); err != nil {
+			tb.Errorf("srptest: %s: hello rejected: %v", name, err)
+			return
+		}
+		if _, err := server.Verify(&srp.ClientProof{M1: M1}); err == nil {
+			tb.Errorf("srptest: %s accepted", name)
+		}
+	}
+	wrong("truncated proof", proof.M1[:len(proof.M1)-1])
+	wrong("empty proof", nil)
+	wrong("wrong proof", make([]byte, len(proof.M1)))
+
+	// The attacker replays the whole handshake it observed.
+	server := newServer()
+	if _, err := server.Challenge(hello); err == nil {
+		if _, err := server.Verify(proof); err == nil {
+			tb.Errorf("srptest: replayed proof accepted")
+		}
+	}
+
+	c := NewClient(s, username, password+"!")
+	hello, _ = c.Hello()
+	server = newServer()
+	if challenge, err := server.Challenge(hello); err == nil {
+		if proof, err := c.Proof(challenge); err == nil {
+			if _, err := server.Verify(proof); err == nil {
+				tb.Errorf("srptest: proof with the wrong password accepted")
+			}
+		}
+	}
+}
+
+// CheckClient attacks clients created by newClient and fails tb for every
+// attack that is not rejected. The clients must use the group and
+// parameters and the given password. The attacks are:
+//
+//	B = 0, N, 2N, 3N and other out of range B, which the client must
+//	reject before it sends a proof
+//	a truncated, an empty and a wrong server proof
+//	a server proof replayed from an earlier handshake
+func CheckClient(tb testing.TB, group string, params map[string]string, newClient func() Client, password string) {
+	tb.Helper()
+	s := NewSRP(tb, group, params, "attacker")
+	store := NewStore(group, params)
+
+	// start runs an honest server up to the challenge.
+	start := func() (Client, Server, *srp.ServerChallenge, bool) {
+		c := newClient()
+		hello, err := c.Hello()
+		if err != nil {
+			tb.Fatalf("srptest: hello failed: %v", err)
+		}
+		if _, err := store.Add(string(hello.Username), password); err != nil {
+			tb.Fatalf("srptest: %v", err)
+		}
+		server := NewServer(s, store)
+		challenge, err := server.Challenge(hello)
+		if err != nil {
+			tb.Errorf("srptest: hello rejected: %v", err)
+			return nil, nil, nil, false
+		}
+		return c, server, challenge, true
+	}
+
+	c, server, challenge, ok := start()
+	if !ok {
+		return
+	}
+	proof, err := c.Proof(challenge)
+	if err != nil {
+		tb.Fatalf("srptest: honest handshake failed: %v", err)
+	}
+	sproof, err := server.Verify(proof)
+	if err != nil {
+		tb.Fatalf("srptest: honest handshake failed: %v", err)
+	}
+	if err := c.Verify(sproof); err != nil {
+		tb.Fatalf("srptest: honest handshake failed: %v", err)
+	}
+
+	for _, m := range MaliciousValues(s) {
+		c := newClient()
+		hello, err := c.Hello()
+		if err != nil {
+			tb.Fatalf("srptest: hello failed: %v", err)
+		}
+		rec, _ := store.Lookup(string(hello.Username))
+		if rec == nil {
+			tb.Fatalf("srptest: client changed its username")
+		}
+		// S is not 0 for a client accepting B = 0 mod N, so no server
+		// proof can be forged; the client must reject the challenge.
+		if _, err := c.Proof(&srp.ServerChallenge{Salt: rec.Salt, B: m.Value, Group: group, Params: params}); err == nil {
+			tb.Errorf("srptest: B=%s: challenge accepted", m.Name)
+		}
+	}
+
+	wrong := func(name string, M2 []byte) {
+		c, _, challenge, ok := start()
+		if !ok {
+			return
+		}
+		if _, err := c.Proof(challenge); err != nil {
+			tb.Errorf("srptest: %s: challenge rejected: %v", name, err)
+			return
+		}
+		if c.Verify(&srp.ServerProof{M2: M2}) == nil {
+			tb.Errorf("srptest: %s accepted", name)
+		}
+	}
+	wrong("truncated server proof", sproof.M2[:len(sproof.M2)-1])
+	wrong("empty server proof", nil)
+	wrong("wrong server proof", make([]byte, len(sproof.M2)))
+	wrong("replayed server proof", sproof.M2)
+}
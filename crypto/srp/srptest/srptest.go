@@ -0,0 +1,164 @@
+// Copyright 2013 Tad Glines
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+// Package srptest provides utilities for testing code built on package srp:
+// deterministic SRP contexts, an in-memory verifier store, reproducible
+// handshake transcripts, and peers that attack the code under test.
+//
+// Everything here is deterministic and therefore insecure. It must only be
+// used in tests.
+package srptest
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"github.com/lann/go-pkgs/crypto/srp"
+	"io"
+	"sync"
+	"testing"
+)
+
+// The group and user used when none is given.
+const (
+	Group    = "rfc5054.1024"
+	Username = "alice"
+	Password = "password123"
+)
+
+// Rand returns an endless stream of bytes determined by seed, for use as
+// srp.SRP.Rand. Block i of the stream is SHA-256(seed | i) with i a big
+// endian uint64. The reader is not safe for concurrent use, and neither is
+// an SRP using it.
+func Rand(seed string) io.Reader {
+	return &randReader{seed: []byte(seed)}
+}
+
+type randReader struct {
+	seed  []byte
+	block uint64
+	buf   []byte
+}
+
+func (r *randReader) Read(p []byte) (int, error) {
+	n := 0
+	for n < len(p) {
+		if len(r.buf) == 0 {
+			h := sha256.New()
+			h.Write(r.seed)
+			var i [8]byte
+			binary.BigEndian.PutUint64(i[:], r.block)
+			h.Write(i[:])
+			r.buf = h.Sum(nil)
+			r.block++
+		}
+		c := copy(p[n:], r.buf)
+		r.buf = r.buf[c:]
+		n += c
+	}
+	return n, nil
+}
+
+// NewSRP returns an SRP context for the group and parameters (see
+// srp.NewSRPWithParams) whose salts and private values are read from
+// Rand(seed). Contexts created with the same arguments produce the same
+// sessions in the same order, which is why the context is not safe for
+// concurrent use. tb is failed if the arguments are invalid.
+func NewSRP(tb testing.TB, group string, params map[string]string, seed string) *srp.SRP {
+	tb.Helper()
+	s, err := srp.NewSRPWithParams(group, params)
+	if err != nil {
+		tb.Fatalf("srptest: %v", err)
+	}
+	s.Rand = Rand(seed)
+	return s
+}
+
+// Store is an in-memory store of verifier records. It implements the Store
+// interface of package authd.
+// Instances of Store are safe for concurrent use.
+type Store struct {
+	Group   string
+	Params  map[string]string
+	mu      sync.RWMutex
+	records map[string]*srp.VerifierRecord
+}
+
+// NewStore creates an empty store adding users with the group and
+// parameters.
+func NewStore(group string, params map[string]string) *Store {
+	return &Store{
+		Group:   group,
+		Params:  params,
+		records: make(map[string]*srp.VerifierRecord),
+	}
+}
+
+// Add computes and stores the record of a user, replacing any previous one.
+// The salt is derived from the username, so the record is always the same.
+func (s *Store) Add(username, password string) (*srp.VerifierRecord, error) {
+	ctx, err := srp.NewSRPWithParams(s.Group, s.Params)
+	if err != nil {
+		return nil, err
+	}
+	ctx.Rand = Rand("salt:" + username)
+	salt, v, err := ctx.ComputeUserVerifier([]byte(username), []byte(password))
+	if err != nil {
+		return nil, err
+	}
+	rec := &srp.VerifierRecord{
+		Username: []byte(username),
+		Group:    s.Group,
+		Params:   s.Params,
+		Salt:     salt,
+		Verifier: v,
+	}
+	s.Put(rec)
+	return rec, nil
+}
+
+// Put stores a record.
+func (s *Store) Put(rec *srp.VerifierRecord) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.records[string(rec.Username)] = rec
+}
+
+// Delete removes the record of a user.
+func (s *Store) Delete(username string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.records, username)
+}
+
+// Lookup returns the record of a user, or nil if there is none.
+func (s *Store) Lookup(username string) (*srp.VerifierRecord, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.records[username], nil
+}
+
+// MustAdd is like Add but fails tb on error.
+func (s *Store) MustAdd(tb testing.TB, username, password string) *srp.VerifierRecord {
+	tb.Helper()
+	rec, err := s.Add(username, password)
+	if err != nil {
+		tb.Fatalf("srptest: %v", err)
+	}
+	return rec
+}
+
+func errorf(format string, v ...interface{}) error {
+	return fmt.Errorf("srptest: "+format, v...)
+}
@@ -0,0 +1,173 @@
+// Copyright 2013 Tad Glines
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+package srptest
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/lann/go-pkgs/crypto/srp"
+	"math/big"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestHandshake(t *testing.T) {
+	t1 := Handshake(t, Group, nil)
+	if !reflect.DeepEqual(t1, Handshake(t, Group, nil)) {
+		t.Fatal("Expected the same transcript twice")
+	}
+	// The private values are those used by the sessions.
+	s := NewSRP(t, Group, nil, "")
+	A := new(big.Int).Exp(s.Group.Generator, t1.PrivateA(), s.Group.Prime)
+	if !bytes.Equal(A.Bytes(), t1.Hello.A) {
+		t.Fatal("PrivateA does not match A")
+	}
+	x := s.ComputeX(t1.Username, t1.Salt, t1.Password)
+	v := new(big.Int).Exp(s.Group.Generator, x, s.Group.Prime)
+	B := new(big.Int).Exp(s.Group.Generator, t1.PrivateB(), s.Group.Prime)
+	B.Add(B, v.Mul(v, s.ComputeK())).Mod(B, s.Group.Prime)
+	if !bytes.Equal(B.Bytes(), t1.Challenge.B) {
+		t.Fatal("PrivateB does not match B")
+	}
+
+	t2 := Handshake(t, "rfc5054.2048", map[string]string{"profile": "srp6"})
+	if bytes.Equal(t1.K, t2.K) {
+		t.Fatal("Expected different transcripts for different groups")
+	}
+}
+
+func TestStore(t *testing.T) {
+	store := NewStore(Group, nil)
+	rec := store.MustAdd(t, Username, Password)
+	if err := rec.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	if again := store.MustAdd(t, Username, Password); !reflect.DeepEqual(rec, again) {
+		t.Fatal("Expected the same record twice")
+	}
+	rec = store.MustAdd(t, Username, "new")
+	if got, _ := store.Lookup(Username); got != rec {
+		t.Fatalf("Lookup returned %v", got)
+	}
+	store.Delete(Username)
+	if got, _ := store.Lookup(Username); got != nil {
+		t.Fatalf("Lookup returned %v after Delete", got)
+	}
+}
+
+func TestCheckReference(t *testing.T) {
+	for _, params := range []map[string]string{nil, {"profile": "srp6"}, {"profile": "srp3"}} {
+		s := NewSRP(t, Group, params, "server")
+		store := NewStore(Group, params)
+		store.MustAdd(t, Username, Password)
+		CheckServer(t, Group, params, func() Server { return NewServer(s, store) }, Username, Password)
+
+		c := NewSRP(t, Group, params, "client")
+		CheckClient(t, Group, params, func() Client { return NewClient(c, Username, Password) }, Password)
+	}
+}
+
+// recorder records the failures of a check instead of failing the test.
+type recorder struct {
+	*testing.T
+	errors []string
+}
+
+func (r *recorder) Helper() {}
+
+func (r *recorder) Errorf(format string, v ...interface{}) {
+	r.errors = append(r.errors, fmt.Sprintf(format, v...))
+}
+
+func (r *recorder) Fatalf(format string, v ...interface{}) {
+	r.T.Fatalf(format, v...)
+}
+
+func (r *recorder) expect(t *testing.T, attacks ...string) {
+	got := strings.Join(r.errors, "\n")
+	for _, attack := range attacks {
+		if !strings.Contains(got, attack) {
+			t.Errorf("Expected %q to be reported, got:\n%s", attack, got)
+		}
+	}
+}
+
+// unchecked does not check A, which lets a value that is 0 mod N through.
+type unchecked struct {
+	Server
+	s     *srp.SRP
+	store *Store
+	rec   *srp.VerifierRecord
+	A     []byte
+}
+
+func (u *unchecked) Challenge(hello *srp.ClientHello) (*srp.ServerChallenge, error) {
+	if new(big.Int).Mod(new(big.Int).SetBytes(hello.A), u.s.Group.Prime).Sign() != 0 {
+		return u.Server.Challenge(hello)
+	}
+	// S = (A * v^u)^b = 0 whatever the password.
+	u.rec, _ = u.store.Lookup(string(hello.Username))
+	u.A = hello.A
+	return &srp.ServerChallenge{Salt: u.rec.Salt, B: []byte{2}, Group: u.rec.Group}, nil
+}
+
+func (u *unchecked) Verify(proof *srp.ClientProof) (*srp.ServerProof, error) {
+	if u.A == nil {
+		return u.Server.Verify(proof)
+	}
+	p := forged(u.s, u.rec.Username, u.rec.Salt, u.A, []byte{2})
+	if !bytes.Equal(proof.M1, u.s.ComputeClientAuthenticator(p)) {
+		return nil, errorf("client proof rejected")
+	}
+	return &srp.ServerProof{}, nil
+}
+
+// gullible accepts any server proof.
+type gullible struct {
+	Client
+}
+
+func (gullible) Verify(*srp.ServerProof) error {
+	return nil
+}
+
+func TestCheckBroken(t *testing.T) {
+	s := NewSRP(t, Group, nil, "server")
+	store := NewStore(Group, nil)
+	store.MustAdd(t, Username, Password)
+	r := &recorder{T: t}
+	CheckServer(r, Group, nil, func() Server {
+		return &unchecked{Server: NewServer(s, store), s: s, store: store}
+	}, Username, Password)
+	r.expect(t, "A=0:", "A=N:", "A=2N:", "A=3N:", "A=0|N:")
+
+	// A server whose b never changes accepts replayed proofs.
+	r = &recorder{T: t}
+	CheckServer(r, Group, nil, func() Server {
+		return NewServer(NewSRP(t, Group, nil, "fixed"), store)
+	}, Username, Password)
+	r.expect(t, "replayed proof")
+	if len(r.errors) != 1 {
+		t.Errorf("Expected only the replay to be reported, got %q", r.errors)
+	}
+
+	c := NewSRP(t, Group, nil, "client")
+	r = &recorder{T: t}
+	CheckClient(r, Group, nil, func() Client {
+		return gullible{NewClient(c, Username, Password)}
+	}, Password)
+	r.expect(t, "truncated server proof", "empty server proof", "wrong server proof", "replayed server proof")
+}
@@ -0,0 +1,119 @@
+// Copyright 2013 Tad Glines
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+package srptest
+
+import (
+	"bytes"
+	"crypto/rand"
+	"github.com/lann/go-pkgs/crypto/srp"
+	"math/big"
+	"testing"
+)
+
+// Transcript is a complete handshake between Username and a server, with the
+// secrets of both sides. Transcripts for the same group and parameters are
+// always the same.
+type Transcript struct {
+	Group    string
+	Params   map[string]string
+	Username []byte
+	Password []byte
+	Salt     []byte
+	Verifier []byte
+	a, b     *big.Int // Private values of the client and the server
+	K        []byte   // Session key
+	M1       []byte
+	M2       []byte
+
+	Hello       *srp.ClientHello
+	Challenge   *srp.ServerChallenge
+	ClientProof *srp.ClientProof
+	ServerProof *srp.ServerProof
+}
+
+// PrivateA returns the client's private value a.
+func (t *Transcript) PrivateA() *big.Int {
+	return new(big.Int).Set(t.a)
+}
+
+// PrivateB returns the server's private value b.
+func (t *Transcript) PrivateB() *big.Int {
+	return new(big.Int).Set(t.b)
+}
+
+// Handshake runs a handshake between the client Username with Password and
+// a server holding its record, using the group and parameters, and returns
+// the transcript. tb is failed if the handshake fails.
+func Handshake(tb testing.TB, group string, params map[string]string) *Transcript {
+	tb.Helper()
+	t, err := handshake(tb, group, params, Username, Password)
+	if err != nil {
+		tb.Fatalf("srptest: %s %v: %v", group, params, err)
+	}
+	return t
+}
+
+func handshake(tb testing.TB, group string, params map[string]string, username, password string) (*Transcript, error) {
+	store := NewStore(group, params)
+	rec, err := store.Add(username, password)
+	if err != nil {
+		return nil, err
+	}
+	t := &Transcript{
+		Group:    group,
+		Params:   params,
+		Username: rec.Username,
+		Password: []byte(password),
+		Salt:     rec.Salt,
+		Verifier: rec.Verifier,
+	}
+
+	// Sessions take their private value first from their Rand, so it can
+	// be read again from a copy of the stream.
+	cseed, sseed := "client:"+group, "server:"+group
+	cs := NewSRP(tb, group, params, cseed)
+	ss := NewSRP(tb, group, params, sseed)
+	max := new(big.Int).Lsh(big.NewInt(1), cs.ABSize)
+	if t.a, err = rand.Int(Rand(cseed), max); err != nil {
+		return nil, err
+	}
+	if t.b, err = rand.Int(Rand(sseed), max); err != nil {
+		return nil, err
+	}
+
+	client := NewClient(cs, username, password)
+	server := NewServer(ss, store)
+	if t.Hello, err = client.Hello(); err != nil {
+		return nil, err
+	}
+	if t.Challenge, err = server.Challenge(t.Hello); err != nil {
+		return nil, err
+	}
+	if t.ClientProof, err = client.Proof(t.Challenge); err != nil {
+		return nil, err
+	}
+	if t.ServerProof, err = server.Verify(t.ClientProof); err != nil {
+		return nil, err
+	}
+	if err := client.Verify(t.ServerProof); err != nil {
+		return nil, err
+	}
+	t.M1, t.M2 = t.ClientProof.M1, t.ServerProof.M2
+	t.K = client.(*refClient).key
+	if !bytes.Equal(t.K, server.(*refServer).key) {
+		return nil, errorf("session keys differ")
+	}
+	return t, nil
+}
@@ -0,0 +1,54 @@
+# Copyright 2013 Tad Glines
+#
+#   Licensed under the Apache License, Version 2.0 (the "License");
+#   you may not use this file except in compliance with the License.
+#   You may obtain a copy of the License at
+#
+#       http://www.apache.org/licenses/LICENSE-2.0
+#
+#   Unless required by applicable law or agreed to in writing, software
+#   distributed under the License is distributed on an "AS IS" BASIS,
+#   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+#   See the License for the specific language governing permissions and
+#   limitations under the License.
+
+# Computes pysrp.json by running pysrp (pip install srp==1.0.22), with the
+# inputs of transcribe.py:
+#
+#	python3 pysrp_vectors.py > pysrp.json
+
+import json
+from srp import _pysrp as p
+
+I = b'alice'
+PW = {'sha1': b'password60', 'sha256': b'password147'}
+salt = bytes.fromhex('00beb25379d1a8581eb5a727673a2441ee')
+a = int('60975527035cf2ad1989806f0407210bc81edc04e2762a56afd529ddda2d4393', 16)
+b = int('e487cb59d31ac550471e81f00f6928e01dda08e974a004f49e61f5d105284d20', 16)
+
+
+def vector(hname):
+    halg = {'sha1': p.SHA1, 'sha256': p.SHA256}[hname]
+    P = PW[hname]
+    N, g = p.get_ng(p.NG_2048, None, None)
+    # User and Verifier hash the salt as an integer (bytes_to_long), so the
+    # verifier is computed the same way.
+    x = p.gen_x(p._hash_map[halg], p.bytes_to_long(salt), I, P)
+    v = p.long_to_bytes(pow(g, x, N))
+
+    usr = p.User(I, P, hash_alg=halg, ng_type=p.NG_2048, bytes_a=p.long_to_bytes(a))
+    _, A = usr.start_authentication()
+    svr = p.Verifier(I, salt, v, A, hash_alg=halg, ng_type=p.NG_2048, bytes_b=p.long_to_bytes(b))
+    s, B = svr.get_challenge()
+    M = usr.process_challenge(s, B)
+    HAMK = svr.verify_session(M)
+    usr.verify_session(HAMK)
+    assert usr.authenticated()
+    return dict(profile='pysrp', group='rfc5054.2048', hash=hname, username=I.decode(),
+                password=P.decode(), salt=salt.hex(), a='%x' % a, b='%x' % b,
+                v='%x' % p.bytes_to_long(v), A='%x' % p.bytes_to_long(A),
+                B='%x' % p.bytes_to_long(B), K=usr.get_session_key().hex(),
+                M1=M.hex(), M2=HAMK.hex())
+
+
+print(json.dumps([vector('sha1'), vector('sha256')], indent=2))
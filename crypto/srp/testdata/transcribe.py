@@ -0,0 +1,108 @@
+# Copyright 2013 Tad Glines
+#
+#   Licensed under the Apache License, Version 2.0 (the "License");
+#   you may not use this file except in compliance with the License.
+#   You may obtain a copy of the License at
+#
+#       http://www.apache.org/licenses/LICENSE-2.0
+#
+#   Unless required by applicable law or agreed to in writing, software
+#   distributed under the License is distributed on an "AS IS" BASIS,
+#   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+#   See the License for the specific language governing permissions and
+#   limitations under the License.
+
+# Computes the profile transcripts from a transcription of the arithmetic of
+# each library (see README), not by running the libraries:
+#
+#	python3 transcribe.py .
+import hashlib, json, os, re, sys
+
+src = open(os.path.join(os.path.dirname(os.path.abspath(__file__)), '..', 'srp_groups.go')).read()
+def prime(name):
+    m = re.search(r'var %s \[\]byte = \[\]byte\{(.*?)\}' % name, src, re.S)
+    return int(''.join(x[2:] for x in re.findall(r'0x[0-9A-F]{2}', m.group(1))), 16)
+
+N = prime('rfc5054_prime2048data'); g = 2
+def lb(n):  # long_to_bytes
+    return n.to_bytes((n.bit_length() + 7) // 8, 'big') if n else b''
+def bl(b): return int.from_bytes(b, 'big')
+nlen = len(lb(N))
+def pad(n): return n.to_bytes(nlen, 'big')
+
+I = b'alice'
+PW = {'sha1': b'password60', 'sha256': b'password147'}  # H(I:P) starts with a zero byte
+salt = bytes.fromhex('00beb25379d1a8581eb5a727673a2441ee')  # leading zero on purpose
+a = int('60975527035cf2ad1989806f0407210bc81edc04e2762a56afd529ddda2d4393', 16)
+b = int('e487cb59d31ac550471e81f00f6928e01dda08e974a004f49e61f5d105284d20', 16)
+
+def run(name, hname, k, x, u, K, M1, M2):
+    global P
+    P = PW[hname]
+    H = lambda *d: hashlib.new(hname, b''.join(d)).digest()
+    kk = k(H); xx = x(H)
+    v = pow(g, xx, N)
+    A = pow(g, a, N)
+    B = (kk * v + pow(g, b, N)) % N
+    uu = u(H, A, B)
+    S = pow((B - kk * pow(g, xx, N)) % N, a + uu * xx, N)
+    assert S == pow(A * pow(v, uu, N), b, N)
+    KK = K(H, S)
+    m1 = M1(H, A, B, S, KK)
+    m2 = M2(H, A, m1, S, KK)
+    return dict(profile=name, group='rfc5054.2048', hash=hname, username=I.decode(), password=P.decode(),
+                salt=salt.hex(), a='%x' % a, b='%x' % b, v='%x' % v, A='%x' % A, B='%x' % B,
+                K=KK.hex(), M1=m1.hex(), M2=m2.hex())
+
+def hnxorg(H):
+    hn, hg = H(lb(N)), H(lb(g))
+    return bytes(p ^ q for p, q in zip(hn, hg))
+
+def pysrp(hname):
+    return run('pysrp', hname,
+        lambda H: bl(H(lb(N), lb(g))),
+        lambda H: bl(H(lb(bl(salt)), lb(bl(H(I + b':' + P))))),
+        lambda H, A, B: bl(H(lb(A), lb(B))),
+        lambda H, S: H(lb(S)),
+        lambda H, A, B, S, K: H(hnxorg(H), H(I), lb(bl(salt)), lb(A), lb(B), K),
+        lambda H, A, m, S, K: H(lb(A), m, K))
+
+def csrp(hname):
+    return run('csrp', hname,
+        lambda H: bl(H(lb(N), lb(g))),
+        lambda H: bl(H(lb(bl(salt)), H(I + b':' + P))),
+        lambda H, A, B: bl(H(lb(A), lb(B))),
+        lambda H, S: H(lb(S)),
+        lambda H, A, B, S, K: H(hnxorg(H), H(I), lb(bl(salt)), lb(A), lb(B), K),
+        lambda H, A, m, S, K: H(lb(A), m, K))
+
+def bc(hname):
+    return run('bouncycastle', hname,
+        lambda H: bl(H(pad(N), pad(g))),
+        lambda H: bl(H(salt, H(I + b':' + P))),
+        lambda H, A, B: bl(H(pad(A), pad(B))),
+        lambda H, S: H(pad(S)),
+        lambda H, A, B, S, K: H(pad(A), pad(B), pad(S)),
+        lambda H, A, m, S, K: H(pad(A), pad(bl(m)), pad(S)))
+
+def thinbus(hname):
+    hx = lambda n: '%x' % n
+    def Hs(H, s):
+        return H(s.encode())
+    def x(H):
+        h1 = Hs(H, (I + b':' + P).decode()).hex().lstrip('0')
+        return bl(Hs(H, (salt.hex() + h1).upper())) % N
+    return run('thinbus', hname,
+        lambda H: bl(Hs(H, hx(N) + hx(g))),
+        x,
+        lambda H, A, B: bl(Hs(H, hx(A) + hx(B))),
+        lambda H, S: Hs(H, hx(S)),
+        lambda H, A, B, S, K: Hs(H, hx(A) + hx(B) + hx(S)),
+        lambda H, A, m, S, K: Hs(H, hx(A) + hx(bl(m)) + hx(S)))
+
+
+os.makedirs(sys.argv[1], exist_ok=True)
+for f in (pysrp, csrp, bc, thinbus):
+    vs = [f('sha1'), f('sha256')]
+    json.dump(vs, open(os.path.join(sys.argv[1], vs[0]['profile'] + '.json'), 'w'), indent=2)
+    print(vs[0]['profile'], vs[0]['M1'])
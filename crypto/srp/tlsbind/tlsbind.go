@@ -0,0 +1,118 @@
+// Copyright 2013 Tad Glines
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+// Package tlsbind extracts the channel bindings of TLS connections, for
+// srp.ClientSession.BindChannel and srp.ServerSession.BindChannel. It is kept
+// out of package srp so that srp does not import crypto/tls and net/http.
+//
+// Two types of binding are supported:
+//
+//	tls-exporter           RFC 9266: 32 bytes exported with the label
+//	                       "EXPORTER-Channel-Binding" and no context. It is
+//	                       unique to the connection, but only available with
+//	                       TLS 1.3 or with the extended master secret of
+//	                       TLS 1.2.
+//	tls-server-end-point   RFC 5929: the hash of the certificate of the
+//	                       server. It only ties the handshake to the server's
+//	                       certificate, so it stops a man in the middle that
+//	                       cannot present that certificate.
+//
+// A server does not see its own certificate in its tls.ConnectionState, so
+// servers compute tls-server-end-point with ServerEndPoint.
+package tlsbind
+
+import (
+	"crypto"
+	_ "crypto/sha256"
+	_ "crypto/sha512"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+)
+
+// Types of channel binding.
+const (
+	TypeExporter       = "tls-exporter"
+	TypeServerEndPoint = "tls-server-end-point"
+)
+
+// ExporterLabel is the label of the keying material exported for
+// tls-exporter.
+const ExporterLabel = "EXPORTER-Channel-Binding"
+
+// Binding returns the channel binding of type typ of the connection seen by
+// state. tls-server-end-point uses the first of PeerCertificates, so it is
+// only valid on a client.
+func Binding(state *tls.ConnectionState, typ string) ([]byte, error) {
+	if state == nil || !state.HandshakeComplete {
+		return nil, fmt.Errorf("No TLS connection")
+	}
+	switch typ {
+	case TypeExporter:
+		return state.ExportKeyingMaterial(ExporterLabel, nil, 32)
+	case TypeServerEndPoint:
+		if len(state.PeerCertificates) == 0 {
+			return nil, fmt.Errorf("No server certificate")
+		}
+		return ServerEndPoint(state.PeerCertificates[0])
+	}
+	return nil, fmt.Errorf("Unknown channel binding type: %s", typ)
+}
+
+// ServerEndPoint returns the tls-server-end-point binding of the certificate
+// of a server: its hash with the hash function of its signature, or SHA-256
+// if that is MD5 or SHA-1.
+func ServerEndPoint(cert *x509.Certificate) ([]byte, error) {
+	var h crypto.Hash
+	switch cert.SignatureAlgorithm {
+	case x509.MD5WithRSA, x509.SHA1WithRSA, x509.DSAWithSHA1, x509.ECDSAWithSHA1,
+		x509.SHA256WithRSA, x509.SHA256WithRSAPSS, x509.DSAWithSHA256, x509.ECDSAWithSHA256:
+		h = crypto.SHA256
+	case x509.SHA384WithRSA, x509.SHA384WithRSAPSS, x509.ECDSAWithSHA384:
+		h = crypto.SHA384
+	case x509.SHA512WithRSA, x509.SHA512WithRSAPSS, x509.ECDSAWithSHA512:
+		h = crypto.SHA512
+	default:
+		// RFC 5929 leaves algorithms without a single hash, such as
+		// Ed25519, undefined.
+		return nil, fmt.Errorf("No tls-server-end-point hash for %s", cert.SignatureAlgorithm)
+	}
+	d := h.New()
+	d.Write(cert.Raw)
+	return d.Sum(nil), nil
+}
+
+// Conn returns the channel binding of type typ of a client connection,
+// completing its handshake first if needed.
+func Conn(conn *tls.Conn, typ string) ([]byte, error) {
+	if err := conn.Handshake(); err != nil {
+		return nil, err
+	}
+	state := conn.ConnectionState()
+	return Binding(&state, typ)
+}
+
+// Request returns the tls-exporter binding of the connection a server
+// received r on. For tls-server-end-point the server uses ServerEndPoint with
+// its certificate.
+func Request(r *http.Request) ([]byte, error) {
+	return Binding(r.TLS, TypeExporter)
+}
+
+// Response returns the channel binding of type typ of the connection a client
+// received resp on.
+func Response(resp *http.Response, typ string) ([]byte, error) {
+	return Binding(resp.TLS, typ)
+}
@@ -0,0 +1,193 @@
+// Copyright 2013 Tad Glines
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+package tlsbind
+
+import (
+	"bytes"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"github.com/lann/go-pkgs/crypto/srp"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// server runs the server side of handshakes over HTTP, binding them to the
+// TLS connection with typ.
+type server struct {
+	t        *testing.T
+	typ      string
+	rec      *srp.VerifierRecord
+	ts       *httptest.Server
+	mu       sync.Mutex
+	sessions map[string]*srp.ServerSession
+}
+
+func newServer(t *testing.T, typ string) *server {
+	rec, err := srp.NewVerifierRecord("rfc5054.2048", nil, []byte("test"), []byte("password"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &server{t: t, typ: typ, rec: rec, sessions: make(map[string]*srp.ServerSession)}
+	s.ts = httptest.NewTLSServer(s)
+	t.Cleanup(s.ts.Close)
+	return s
+}
+
+func (s *server) binding(r *http.Request) ([]byte, error) {
+	if s.typ == TypeServerEndPoint {
+		return ServerEndPoint(s.ts.Certificate())
+	}
+	return Request(r)
+}
+
+func (s *server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	cb, err := s.binding(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	switch r.URL.Path {
+	case "/hello":
+		var hello srp.ClientHello
+		json.NewDecoder(r.Body).Decode(&hello)
+		_, ss, err := s.rec.NewServerSession()
+		if err == nil {
+			_, err = ss.ComputeKey(hello.A)
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		ss.BindChannel(s.typ, cb)
+		s.sessions[string(hello.Username)] = ss
+		json.NewEncoder(w).Encode(&srp.ServerChallenge{Salt: s.rec.Salt, B: ss.GetB(), Group: s.rec.Group})
+	case "/proof":
+		var proof srp.ClientProof
+		json.NewDecoder(r.Body).Decode(&proof)
+		ss := s.sessions[r.URL.Query().Get("username")]
+		if ss == nil || !ss.VerifyClientAuthenticator(proof.M1) {
+			http.Error(w, "Authentication failed", http.StatusForbidden)
+			return
+		}
+		json.NewEncoder(w).Encode(&srp.ServerProof{M2: ss.ComputeAuthenticator(proof.M1)})
+	}
+}
+
+func post(c *http.Client, url string, in, out interface{}) (*http.Response, error) {
+	body, _ := json.Marshal(in)
+	resp, err := c.Post(url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(resp.Body)
+		return nil, fmt.Errorf("%s: %s", resp.Status, bytes.TrimSpace(msg))
+	}
+	return resp, json.NewDecoder(resp.Body).Decode(out)
+}
+
+// login runs the client side of a handshake with the server at url.
+func login(c *http.Client, url, typ string) error {
+	s, err := srp.NewSRPWithParams("rfc5054.2048", nil)
+	if err != nil {
+		return err
+	}
+	cs := s.NewClientSession([]byte("test"), []byte("password"))
+	challenge := new(srp.ServerChallenge)
+	resp, err := post(c, url+"/hello", &srp.ClientHello{Username: []byte("test"), A: cs.GetA()}, challenge)
+	if err != nil {
+		return err
+	}
+	cb, err := Response(resp, typ)
+	if err != nil {
+		return err
+	}
+	cs.BindChannel(typ, cb)
+	if _, err := cs.ComputeKey(challenge.Salt, challenge.B); err != nil {
+		return err
+	}
+	proof := new(srp.ServerProof)
+	if _, err := post(c, url+"/proof?username=test", &srp.ClientProof{M1: cs.ComputeAuthenticator()}, proof); err != nil {
+		return err
+	}
+	if !cs.VerifyServerAuthenticator(proof.M2) {
+		return fmt.Errorf("Server authenticator is not valid")
+	}
+	return nil
+}
+
+func TestChannelBinding(t *testing.T) {
+	for _, typ := range []string{TypeExporter, TypeServerEndPoint} {
+		s := newServer(t, typ)
+		if err := login(s.ts.Client(), s.ts.URL, typ); err != nil {
+			t.Errorf("%s: %v", typ, err)
+		}
+	}
+}
+
+func TestChannelBindingRelay(t *testing.T) {
+	s := newServer(t, TypeExporter)
+	// The relay terminates TLS and forwards the requests over its own
+	// connection to the server.
+	relay := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		resp, err := s.ts.Client().Post(s.ts.URL+r.URL.RequestURI(), "application/json", r.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadGateway)
+			return
+		}
+		defer resp.Body.Close()
+		w.WriteHeader(resp.StatusCode)
+		io.Copy(w, resp.Body)
+	}))
+	defer relay.Close()
+	if err := login(relay.Client(), relay.URL, TypeExporter); err == nil || !strings.Contains(err.Error(), "Authentication failed") {
+		t.Fatalf("Expected the relayed handshake to fail, got %v", err)
+	}
+}
+
+func TestConn(t *testing.T) {
+	s := newServer(t, TypeServerEndPoint)
+	config := s.ts.Client().Transport.(*http.Transport).TLSClientConfig
+	conn, err := tls.Dial("tcp", s.ts.Listener.Addr().String(), config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	got, err := Conn(conn, TypeServerEndPoint)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, _ := ServerEndPoint(s.ts.Certificate())
+	if !bytes.Equal(got, want) {
+		t.Fatal("The bindings of client and server differ")
+	}
+	if cb, err := Conn(conn, TypeExporter); err != nil || len(cb) != 32 {
+		t.Fatalf("Unexpected tls-exporter binding %x: %v", cb, err)
+	}
+	if _, err := Conn(conn, "tls-unique"); err == nil {
+		t.Fatal("Expected an unknown type to be rejected")
+	}
+	if _, err := Binding(nil, TypeExporter); err == nil {
+		t.Fatal("Expected a missing connection to be rejected")
+	}
+}
@@ -0,0 +1,170 @@
+// Copyright 2013 Tad Glines
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+package srp
+
+/*
+	When SRP.Debug is set, sessions record the values they compute in a
+	Transcript, to find out why a peer built on another implementation
+	fails to authenticate. Diagnose compares a transcript with the values
+	the peer reports and points to the first one that differs.
+
+	The values are named as in the vectors written by cmd/srp-vectors:
+
+		N, g       the group
+		k          the multiplier
+		username   I
+		salt       s
+		a, b       the private values (secret)
+		A, B       the public values
+		u          the scrambling parameter
+		S          the premaster secret (secret)
+		K          the session key (secret)
+		M1, M2     the authenticators computed by this side; the one
+		           expected from the peer is secret
+
+	The authenticator received from the peer is recorded as "received M1"
+	or "received M2". Integers are recorded in big endian without leading
+	zeros, other values as they were used. x and v are never recorded:
+	either allows a dictionary attack on the password.
+
+	Transcripts of sessions that are not used for testing must be redacted
+	before they leave the process. Destroy wipes the secret values of the
+	transcript of a session.
+*/
+
+import (
+	"encoding/hex"
+	"fmt"
+	"strings"
+)
+
+// Transcript is the record of the values of a session.
+type Transcript struct {
+	Role    string            `json:"role"`
+	Group   string            `json:"group"`
+	Hash    string            `json:"hash"`
+	Profile string            `json:"profile,omitempty"`
+	Values  []TranscriptValue `json:"values"`
+}
+
+// TranscriptValue is a value of a Transcript. A secret value that was
+// redacted or wiped has no Value.
+type TranscriptValue struct {
+	Name   string `json:"name"`
+	Value  []byte `json:"value,omitempty"`
+	Secret bool   `json:"secret,omitempty"`
+}
+
+func (s *SRP) newTranscript(role string) *Transcript {
+	if !s.Debug {
+		return nil
+	}
+	t := &Transcript{Role: role, Group: groupName(s.Group), Hash: hashName(s.HashFunc)}
+	if s.Profile != nil {
+		t.Profile = s.Profile.Name
+	}
+	t.add("N", s.Group.Prime.Bytes(), false)
+	t.add("g", s.Group.Generator.Bytes(), false)
+	t.add("k", s.get_k().Bytes(), false)
+	return t
+}
+
+// add records a copy of value, replacing a previous value of the same name.
+// It does nothing on a nil Transcript.
+func (t *Transcript) add(name string, value []byte, secret bool) {
+	if t == nil {
+		return
+	}
+	v := TranscriptValue{Name: name, Value: append([]byte{}, value...), Secret: secret}
+	for i := range t.Values {
+		if t.Values[i].Name == name {
+			t.Values[i] = v
+			return
+		}
+	}
+	t.Values = append(t.Values, v)
+}
+
+// Get returns the value recorded under name, or nil.
+func (t *Transcript) Get(name string) *TranscriptValue {
+	for i := range t.Values {
+		if t.Values[i].Name == name {
+			return &t.Values[i]
+		}
+	}
+	return nil
+}
+
+// Redact returns a copy of the transcript without the secret values.
+func (t *Transcript) Redact() *Transcript {
+	r := *t
+	r.Values = make([]TranscriptValue, len(t.Values))
+	for i, v := range t.Values {
+		if v.Secret {
+			v.Value = nil
+		}
+		r.Values[i] = v
+	}
+	return &r
+}
+
+// Wipe overwrites the secret values of the transcript and removes them.
+// It does nothing on a nil Transcript.
+func (t *Transcript) Wipe() {
+	if t == nil {
+		return
+	}
+	for i := range t.Values {
+		if t.Values[i].Secret {
+			wipeBytes(t.Values[i].Value)
+			t.Values[i].Value = nil
+		}
+	}
+}
+
+// String formats the transcript with one value per line.
+func (t *Transcript) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s transcript, group %s, hash %s", t.Role, t.Group, t.Hash)
+	if t.Profile != "" {
+		fmt.Fprintf(&b, ", profile %s", t.Profile)
+	}
+	for _, v := range t.Values {
+		fmt.Fprintf(&b, "\n  %-11s %s", v.Name, v)
+	}
+	return b.String()
+}
+
+func (v TranscriptValue) String() string {
+	if v.Secret && v.Value == nil {
+		return "redacted"
+	}
+	if v.Name == "username" {
+		return fmt.Sprintf("%q", v.Value)
+	}
+	return hex.EncodeToString(v.Value)
+}
+
+// Transcript returns the values recorded by the session, or nil if SRP.Debug
+// was not set when it was created. Destroy wipes its secret values.
+func (cs *ClientSession) Transcript() *Transcript {
+	return cs.transcript
+}
+
+// Transcript returns the values recorded by the session, or nil if SRP.Debug
+// was not set when it was created. Destroy wipes its secret values.
+func (ss *ServerSession) Transcript() *Transcript {
+	return ss.transcript
+}
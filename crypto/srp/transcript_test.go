@@ -0,0 +1,183 @@
+// Copyright 2013 Tad Glines
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+package srp
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+// debugHandshake runs a handshake between a client using profile and a
+// server using the default formulas, and returns their transcripts.
+func debugHandshake(t *testing.T, profile string) (client, server *Transcript) {
+	username, password := []byte("test"), []byte("password")
+	ss, err := NewSRP("rfc5054.1024", sha256.New, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ss.Debug = true
+	cs, _ := NewSRP("rfc5054.1024", sha256.New, nil)
+	cs.Debug = true
+	if profile != "" {
+		cs.Profile, _ = GetProfile(profile)
+	}
+	salt, v, err := ss.ComputeUserVerifier(username, password)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := cs.NewClientSession(username, password)
+	s := ss.NewServerSession(username, salt, v)
+	if _, err := s.ComputeKey(c.GetA()); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.ComputeKey(salt, s.GetB()); err != nil {
+		t.Fatal(err)
+	}
+	M1 := c.ComputeAuthenticator()
+	if s.VerifyClientAuthenticator(M1) == (profile != "") {
+		t.Fatalf("Unexpected result with profile %q", profile)
+	}
+	c.VerifyServerAuthenticator(s.ComputeAuthenticator(M1))
+	return c.Transcript(), s.Transcript()
+}
+
+func transcriptValues(t *Transcript) map[string][]byte {
+	values := make(map[string][]byte)
+	for _, v := range t.Values {
+		values[v.Name] = v.Value
+	}
+	return values
+}
+
+// containsAll returns true if all of want are in got. Formulas that only
+// differ in padding match too when values happen to have full length.
+func containsAll(got, want []string) bool {
+	for _, w := range want {
+		found := false
+		for _, g := range got {
+			found = found || g == w
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+func TestTranscript(t *testing.T) {
+	client, server := debugHandshake(t, "")
+	if client.Role != RoleClient || server.Role != RoleServer || server.Group != "rfc5054.1024" || server.Hash != "sha256" {
+		t.Fatalf("Unexpected transcripts: %v\n%v", client, server)
+	}
+	for _, name := range []string{"N", "g", "k", "username", "salt", "A", "B", "u", "S", "K", "M1", "M2"} {
+		c, s := client.Get(name), server.Get(name)
+		if c == nil || s == nil || !bytes.Equal(c.Value, s.Value) || len(c.Value) == 0 {
+			t.Fatalf("%s: %v != %v", name, c, s)
+		}
+	}
+	if !bytes.Equal(server.Get("received M1").Value, server.Get("M1").Value) {
+		t.Fatal("Expected the received M1 to be recorded")
+	}
+	// x and v would allow a dictionary attack on the password.
+	if client.Get("x") != nil || server.Get("v") != nil {
+		t.Fatal("Expected x and v not to be recorded")
+	}
+
+	r := server.Redact()
+	data, err := json.Marshal(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, secret := range []string{"b", "S", "K", "M1"} {
+		if v := r.Get(secret); v.Value != nil {
+			t.Fatalf("%s not redacted: %v", secret, v)
+		}
+		if bytes.Contains(data, server.Get(secret).Value) {
+			t.Fatalf("%s found in %s", secret, data)
+		}
+	}
+	if !strings.Contains(r.String(), "K           redacted") {
+		t.Fatalf("Unexpected redacted K:\n%v", r)
+	}
+
+	K := server.Get("K").Value
+	server.Wipe()
+	if server.Get("K").Value != nil || !bytes.Equal(K, make([]byte, len(K))) {
+		t.Fatal("K not wiped")
+	}
+
+	// Destroy wipes the transcript of a session.
+	s, _ := NewSRP("rfc5054.1024", sha256.New, nil)
+	s.Debug = true
+	cs := s.NewClientSession([]byte("test"), []byte("password"))
+	cs.Destroy()
+	if a := cs.Transcript().Get("a"); a == nil || a.Value != nil {
+		t.Fatalf("Expected a to be wiped, got %v", a)
+	}
+
+	s.Debug = false
+	if s.NewClientSession([]byte("test"), []byte("password")).Transcript() != nil {
+		t.Fatal("Expected no transcript without Debug")
+	}
+}
+
+func TestDiagnose(t *testing.T) {
+	client, server := debugHandshake(t, "")
+	if d := Diagnose(server, transcriptValues(client)); d != nil {
+		t.Fatalf("Expected no divergence, got %v", d)
+	}
+
+	// The peer pads A.
+	peer := transcriptValues(client)
+	peer["A"] = append([]byte{0}, peer["A"]...)
+	d := Diagnose(server, peer)
+	if d == nil || d.Name != "A" || !strings.Contains(d.Cause, "leading zero") {
+		t.Fatalf("Expected A to be padded, got %v", d)
+	}
+
+	// The peer hashes S directly.
+	peer = transcriptValues(client)
+	peer["K"] = hashBytes(&SRP{HashFunc: sha256.New}, peer["S"])
+	d = Diagnose(server, peer)
+	if d == nil || d.Name != "K" || !containsAll(d.Matches, []string{"profile csrp", "profile pysrp", "profile srp6"}) {
+		t.Fatalf("Expected K = H(S), got %v", d)
+	}
+
+	for _, test := range []struct {
+		profile string
+		name    string
+		cause   string
+		matches []string
+	}{
+		{"pysrp", "k", "k", []string{"profile csrp", "profile pysrp"}},
+		// A difference in x shows in S, as the verifier of the peer's x.
+		{"bouncycastle", "S", "v", []string{"profile bouncycastle"}},
+		{"thinbus", "k", "k", []string{"profile thinbus"}},
+	} {
+		client, server := debugHandshake(t, test.profile)
+		peer := transcriptValues(client)
+		peer["password"] = []byte("password")
+		d := Diagnose(server, peer)
+		if d == nil || d.Name != test.name || !containsAll(d.Matches, test.matches) {
+			t.Fatalf("%s: expected %s matching %v, got %v", test.profile, test.name, test.matches, d)
+		}
+		if !strings.Contains(d.String(), "Likely cause: "+diagnoseHints[test.cause]) {
+			t.Fatalf("%s: unexpected diagnosis:\n%v", test.profile, d)
+		}
+	}
+}